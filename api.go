@@ -26,13 +26,11 @@
 package gorest
 
 import (
-	"compress/gzip"
 	"github.com/rmullinnix/logger"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
 	"time"
 )
 
@@ -197,6 +195,21 @@ type Context struct {
 	responseMimeType   string
 	dataHasBeenWritten bool
 	encodeGzip	   bool
+	compression	   *compressionPolicy
+	contentEncoding	   string
+	encodingChosen	   bool
+	problem		   *Problem
+	stream		   *responseStream
+	events		   EventSource
+	produceMime	   string
+	autoETag	   bool
+	etag		   string
+	lastModified	   time.Time
+	cacheControl	   string
+	binary		   *binaryContent
+	pageRequest	   PageRequest
+	principal	   *Principal
+	jsonOptions	   JSONOptions
 }
 
 //This will write to the response and then call Overide(true), even if it had been set to "false" in a previous call.
@@ -213,11 +226,25 @@ func (this *ResponseBuilder) WriteAndContinue(data []byte) *ResponseBuilder {
 
 //This will write to the response and then call Overide(false), even if it had been set to "true" in a previous call.
 func (this *ResponseBuilder) WritePacket() *ResponseBuilder {
+	//Binary content is closed however the response ends, 304 Not Modified included
+	if this.ctx.binary != nil {
+		defer this.ctx.binary.close()
+	}
+
 	if !this.ctx.dataHasBeenWritten {
 		if this.ctx.responseCode == 0 {
 			this.SetResponseCode(getDefaultResponseCode(this.ctx.request.Method))
 		}
 
+		//An entity encoded as it is written is encoded up front when its etag is generated
+		if this.ctx.autoETag && this.ctx.etag == "" && this.ctx.responseCode == http.StatusOK && this.ctx.problem == nil && this.ctx.respPacket != nil && this.ctx.stream == nil && this.ctx.events == nil {
+			this.entityBytes()
+		}
+
+		if this.ctx.problem != nil {
+			this.formatProblem()
+		}
+
 		if this.ctx.responseMimeSet {
 			this.writer().Header().Set("Content-Type", this.ctx.responseMimeType)
 		}
@@ -227,18 +254,22 @@ func (this *ResponseBuilder) WritePacket() *ResponseBuilder {
 			this.writer().Header().Set("Access-Control-Allow-Origin", value.(string))
 		}
 
-		if this.ctx.respPacket == nil {
+		this.writeCacheControl()
+
+		if this.notModified() {
+			this.SetResponseCode(http.StatusNotModified)
+			this.writer().WriteHeader(http.StatusNotModified)
+		} else if this.ctx.events != nil {
+			this.writeEvents()
+		} else if this.ctx.stream != nil {
+			this.writeStream()
+		} else if this.ctx.binary != nil {
+			this.writeBinary()
+		} else if this.ctx.respPacket == nil {
 			this.writer().WriteHeader(this.ctx.responseCode)
 			this.writer().Write([]byte(this.ctx.responseMsg))
-		} else if this.ctx.encodeGzip && strings.Contains(this.ctx.request.Header.Get("Accept-Encoding"), "gzip") {
-			this.writer().Header().Set("Content-Encoding", "gzip")
-			this.writer().WriteHeader(this.ctx.responseCode)
-			gzipWriter := gzip.NewWriter(this.writer())
-			defer gzipWriter.Close()
-			io.Copy(gzipWriter, this.ctx.respPacket)
 		} else {
-			this.writer().WriteHeader(this.ctx.responseCode)
-			io.Copy(this.writer(), this.ctx.respPacket)
+			this.writeEntity()
 		}
 		this.ctx.dataHasBeenWritten = true
 	}
@@ -266,11 +297,6 @@ func (this *ResponseBuilder) Write(data []byte) *ResponseBuilder {
 	return this
 }
 
-func (this *ResponseBuilder) LongPoll(delay int, producer func(interface{}) interface{}) *ResponseBuilder {
-
-	return this
-}
-
 func (this *ResponseBuilder) SetHeader(key string, value string) *ResponseBuilder {
 	this.writer().Header().Set(key, value)
 	return this
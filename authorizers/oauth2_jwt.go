@@ -18,7 +18,20 @@ type signingKey struct {
 
 var curScheme		string
 
+//Authorizes with the JWT of the Authorization header, registered with gorest.RegisterAuthorizer
 func Oauth2Jwt(token string, scheme string, scopes []string, method string, rb *gorest.ResponseBuilder) bool {
+	return Oauth2JwtPrincipal(token, scheme, scopes, method, rb).Decision == gorest.Allowed
+}
+
+//Authorizes with the JWT of the Authorization header, registered with gorest.RegisterPrincipalAuthorizer.
+//The principal is the user claim of the token, with its scope claims. Requests without a token are
+//challenged without an error code, invalid tokens leave the caller unauthenticated and valid ones
+//without the scopes of the endpoint are forbidden.
+func Oauth2JwtPrincipal(token string, scheme string, scopes []string, method string, rb *gorest.ResponseBuilder) gorest.AuthResult {
+	if token == "" {
+		logger.Error.Println("[sec] oauth2-jwt userid: unknown useruuid: unknown active: true locked: false auth: false failcnt: 0 response: 401 reason: no token")
+		return gorest.AuthResult{Decision: gorest.Unauthenticated}
+	}
 
 	curScheme = scheme
 
@@ -28,28 +41,41 @@ func Oauth2Jwt(token string, scheme string, scopes []string, method string, rb *
 
 	if err != nil {
 		logger.Error.Println("[sec] oauth2-jwt userid: unknown useruuid: unknown active: true locked: false auth: false failcnt: 0 response: 401 reason: jwt parse error", err)
-		return false
+		return gorest.AuthResult{Decision: gorest.Unauthenticated, Reason: "Invalid token"}
 	}
 
+	principal := &gorest.Principal{Claims: jwtToken.Claims}
+
 	uid := "unknown"
 	uuid := "unknown"
-	if user, ufnd := jwtToken.Claims["user"]; ufnd {
-		uid = user.(string)
+	if user, ufnd := jwtToken.Claims["user"].(string); ufnd {
+		uid = user
+		principal.Subject = uid
 		rb.Session().Set("UserId", uid)
 	}
 
-	if userUUID, uifnd := jwtToken.Claims["useruuid"]; uifnd {
-		uuid = userUUID.(string)
+	if userUUID, uifnd := jwtToken.Claims["useruuid"].(string); uifnd {
+		uuid = userUUID
 		rb.Session().Set("UserUUID", uuid)
 	}
 
 	claim, found := jwtToken.Claims["scope"]
 	if !found {
-		logger.Error.Println("[sec] oauth2-jwt userid: " + uid + " useruuid: " + uuid + " active: true locked: false auth: false failcnt: 0 response: 401 reason: No scope claims in the token")
-		return false
+		logger.Error.Println("[sec] oauth2-jwt userid: " + uid + " useruuid: " + uuid + " active: true locked: false auth: false failcnt: 0 response: 403 reason: No scope claims in the token")
+		return gorest.AuthResult{Decision: gorest.Forbidden, Principal: principal, Reason: "No scope claims in the token"}
 	}
 	
-	arrClaim := claim.([]interface{})
+	arrClaim, valid := claim.([]interface{})
+	for j := 0; valid && j < len(arrClaim); j++ {
+		var scope string
+		if scope, valid = arrClaim[j].(string); valid {
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+	}
+	if !valid {
+		logger.Error.Println("[sec] oauth2-jwt userid: " + uid + " useruuid: " + uuid + " active: true locked: false auth: false failcnt: 0 response: 401 reason: scope claim is not a list of strings")
+		return gorest.AuthResult{Decision: gorest.Unauthenticated, Reason: "Invalid token"}
+	}
 	rb.Session().Set("Scope", arrClaim)
 
 	authorized := false
@@ -68,8 +94,8 @@ func Oauth2Jwt(token string, scheme string, scopes []string, method string, rb *
 			scopeName = scopes[i][:contextAuth]
 		}
 
-		for j := range arrClaim {
-			arrStr := arrClaim[j].(string)
+		for j := range principal.Scopes {
+			arrStr := principal.Scopes[j]
 
 			if strings.HasPrefix(arrStr, scopeName) {
 				if contextAuth = strings.Index(arrStr, "["); contextAuth > -1 {
@@ -99,7 +125,7 @@ func Oauth2Jwt(token string, scheme string, scopes []string, method string, rb *
 			}
 			
 			if len(contextKey) > 0 {
-				if scopes[i] == arrClaim[j].(string) {
+				if scopes[i] == arrStr {
 					authorized = true
 					break
 				}
@@ -108,14 +134,11 @@ func Oauth2Jwt(token string, scheme string, scopes []string, method string, rb *
 	}
 
 	if !authorized {
-		arr := make([]string, len(arrClaim))
-		for j := range arrClaim {
-			arr[j] = arrClaim[j].(string)
-		}
-		logger.Error.Println("[sec] oauth2-jwt userid: " + uid + " useruuid: " + uuid + " active: true locked: false auth: false failcnt: 0 response: 401 reason: user not authorized for scope " + strings.Join(arr, ", "))
+		logger.Error.Println("[sec] oauth2-jwt userid: " + uid + " useruuid: " + uuid + " active: true locked: false auth: false failcnt: 0 response: 403 reason: user not authorized for scope " + strings.Join(principal.Scopes, ", "))
+		return gorest.AuthResult{Decision: gorest.Forbidden, Principal: principal, Reason: "Not authorized for scope " + strings.Join(scopes, ", ")}
 	}
 
-	return authorized
+	return gorest.AuthResult{Decision: gorest.Allowed, Principal: principal}
 }
 
 func AddKey(scheme string, keyid string, key interface{}, signType string) {
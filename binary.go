@@ -0,0 +1,280 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//The entity of an output:"binary" endpoint. Service methods return the content as a []byte or
+//an io.ReadSeeker, such as an *os.File, which is closed once the response is written:
+//
+//	type MediaService struct {
+//	    gorest.RestService `root:"/media/"`
+//	    video gorest.EndPoint `method:"GET" path:"/videos/{id:string}" output:"binary" produces:"video/mp4"`
+//	}
+//	func(serv MediaService) Video(id string) (io.ReadSeeker, error) {
+//	    return os.Open(filepath.Join(videoDir, filepath.Base(id) + ".mp4"))
+//	}
+//
+//Byte ranges of the content can be requested with the Range and If-Range headers.
+type binaryContent struct {
+	content	io.ReadSeeker
+	size	int64
+}
+
+var byteSliceType = reflect.TypeOf([]byte(nil))
+var readSeekerType = reflect.TypeOf((*io.ReadSeeker)(nil)).Elem()
+
+//Whether the type can be returned by an output:"binary" endpoint
+func isBinaryType(t reflect.Type) bool {
+	return t == byteSliceType || t.Implements(readSeekerType)
+}
+
+//Wraps the value returned by the service method. Files give the Last-Modified time of the
+//response, unless the method has set it.
+func (this *ResponseBuilder) newBinaryContent(v reflect.Value) (*binaryContent, error) {
+	if v.Type() == byteSliceType {
+		return &binaryContent{content: bytes.NewReader(v.Bytes()), size: int64(v.Len())}, nil
+	}
+
+	content, _ := v.Interface().(io.ReadSeeker)
+	if content == nil || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return &binaryContent{content: bytes.NewReader(nil)}, nil
+	}
+
+	if file, ok := content.(interface{ Stat() (os.FileInfo, error) }); ok && this.ctx.lastModified.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			this.SetLastModified(info.ModTime())
+		}
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	bin := &binaryContent{content: content, size: size}
+	if err != nil {
+		bin.close()
+		return nil, err
+	}
+	return bin, nil
+}
+
+func (this *binaryContent) close() {
+	if closer, ok := this.content.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+//Computes the entity tag of the content, rewinding it for the response
+func (this *binaryContent) etag(mimeType string) (string, error) {
+	etag, err := computeETagReader(mimeType, this.content)
+	if err == nil {
+		_, err = this.content.Seek(0, io.SeekStart)
+	}
+	return etag, err
+}
+
+type byteRange struct {
+	start	int64
+	length	int64
+}
+
+func (this byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", this.start, this.start + this.length - 1, size)
+}
+
+var errUnsatisfiableRange = errors.New("None of the requested ranges can be satisfied")
+
+//The most ranges served from a single request
+const maxRanges = 32
+
+//Parses a Range header (RFC 7233) against content of the size. A malformed header is
+//ignored by returning no ranges, ranges starting past the end of the content are dropped
+//and errUnsatisfiableRange is returned if none remain. So that a request can not make the
+//response much larger than the content, the header is also ignored when it lists more than
+//maxRanges ranges or overlapping ones; the ranges served never add up to more than the content.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return nil, nil
+	}
+
+	specs := strings.Split(header[len("bytes="):], ",")
+	if len(specs) > maxRanges {
+		return nil, nil
+	}
+
+	ranges := make([]byteRange, 0)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		dash := strings.Index(spec, "-")
+		if dash < 0 {
+			return nil, nil
+		}
+		first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+		var r	byteRange
+		if first == "" {
+			// suffix range, the final bytes of the content
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+
+	sorted := append([]byteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].start < sorted[i-1].start + sorted[i-1].length {
+			return nil, nil
+		}
+	}
+	return ranges, nil
+}
+
+//Whether the Range of the request still applies: an If-Range entity tag must strongly match
+//the ETag of the response, an If-Range date must equal its Last-Modified time
+func (this *ResponseBuilder) ifRangeMatches() bool {
+	ifRange := strings.TrimSpace(this.ctx.request.Header.Get("If-Range"))
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		etag := this.writer().Header().Get("ETag")
+		return !strings.HasPrefix(ifRange, "W/") && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+
+	if t, err := http.ParseTime(ifRange); err == nil && !this.ctx.lastModified.IsZero() {
+		return this.ctx.lastModified.Equal(t.UTC().Truncate(time.Second))
+	}
+	return false
+}
+
+//Writes the binary content of the response, or the ranges of it requested by the client: a
+//single range as 206 Partial Content, several as a multipart/byteranges document
+func (this *ResponseBuilder) writeBinary() {
+	bin := this.ctx.binary
+
+	header := this.writer().Header()
+	header.Set("Accept-Ranges", "bytes")
+
+	var ranges	[]byteRange
+	if rangeHeader := this.ctx.request.Header.Get("Range"); rangeHeader != "" && this.ctx.responseCode == http.StatusOK && this.ifRangeMatches() {
+		var err		error
+		if ranges, err = parseRange(rangeHeader, bin.size); err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", bin.size))
+			this.SetProblem(NewProblem(http.StatusRequestedRangeNotSatisfiable, err.Error()))
+			this.formatProblem()
+			header.Set("Content-Type", this.ctx.responseMimeType)
+			this.writer().WriteHeader(this.ctx.responseCode)
+			io.Copy(this.writer(), this.ctx.respPacket)
+			return
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		header.Set("Content-Length", strconv.FormatInt(bin.size, 10))
+		this.writer().WriteHeader(this.ctx.responseCode)
+		io.Copy(this.writer(), bin.content)
+	case 1:
+		this.SetResponseCode(http.StatusPartialContent)
+		header.Set("Content-Range", ranges[0].contentRange(bin.size))
+		header.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		this.writer().WriteHeader(http.StatusPartialContent)
+		if _, err := bin.content.Seek(ranges[0].start, io.SeekStart); err == nil {
+			io.CopyN(this.writer(), bin.content, ranges[0].length)
+		}
+	default:
+		this.SetResponseCode(http.StatusPartialContent)
+		parts := multipart.NewWriter(this.writer())
+		header.Set("Content-Type", "multipart/byteranges; boundary=" + parts.Boundary())
+		this.writer().WriteHeader(http.StatusPartialContent)
+
+		for _, r := range ranges {
+			part, err := parts.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {this.ctx.responseMimeType},
+				"Content-Range": {r.contentRange(bin.size)},
+			})
+			if err != nil {
+				return
+			}
+			if _, err := bin.content.Seek(r.start, io.SeekStart); err != nil {
+				return
+			}
+			if _, err := io.CopyN(part, bin.content, r.length); err != nil {
+				return
+			}
+		}
+		parts.Close()
+	}
+}
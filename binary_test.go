@@ -0,0 +1,196 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const binaryPayload = "0123456789abcdefghij"
+
+func writeTestBinary(t *testing.T, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/media/1", nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetContentType(Application_OctetStream)
+	rb.SetETag("v1")
+
+	bin, err := rb.newBinaryContent(reflect.ValueOf([]byte(binaryPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb.ctx.binary = bin
+	rb.WritePacket()
+	return rec
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		ranges []byteRange
+	}{
+		{"bytes=0-4", []byteRange{{0, 5}}},
+		{"bytes=15-", []byteRange{{15, 5}}},
+		{"bytes=-3", []byteRange{{17, 3}}},
+		{"bytes=18-100", []byteRange{{18, 2}}},
+		{"bytes=0-1, 5-6", []byteRange{{0, 2}, {5, 2}}},
+		{"bytes=0-1, 50-60", []byteRange{{0, 2}}},
+		{"items=0-1", nil},
+		{"bytes=4-2", nil},
+		{"bytes=x-", nil},
+		{"bytes=0-9, 5-", nil},
+		{"bytes=0-, -1", nil},
+		{"bytes=" + strings.Repeat("0-0,", maxRanges) + "1-1", nil},
+		{"bytes=5-6, 0-1", []byteRange{{5, 2}, {0, 2}}},
+	}
+
+	for _, c := range cases {
+		ranges, err := parseRange(c.header, int64(len(binaryPayload)))
+		if err != nil || !reflect.DeepEqual(ranges, c.ranges) {
+			t.Error("Range:", c.header, "expecting:", c.ranges, "got:", ranges, err)
+		}
+	}
+
+	if _, err := parseRange("bytes=20-30", int64(len(binaryPayload))); err != errUnsatisfiableRange {
+		t.Error("Expecting a range past the end to be unsatisfiable, got:", err)
+	}
+}
+
+func TestBinaryRanges(t *testing.T) {
+	rec := writeTestBinary(t, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != binaryPayload || rec.Header().Get("Accept-Ranges") != "bytes" || rec.Header().Get("Content-Length") != "20" {
+		t.Error("Expecting the full content, got:", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = writeTestBinary(t, map[string]string{"Range": "bytes=5-9"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "56789" || rec.Header().Get("Content-Range") != "bytes 5-9/20" {
+		t.Error("Expecting a partial response, got:", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = writeTestBinary(t, map[string]string{"Range": "bytes=5-9", "If-Range": `"v1"`})
+	if rec.Code != http.StatusPartialContent {
+		t.Error("Expecting a matching If-Range to give a partial response, got:", rec.Code)
+	}
+
+	rec = writeTestBinary(t, map[string]string{"Range": "bytes=5-9", "If-Range": `"v0"`})
+	if rec.Code != http.StatusOK || rec.Body.String() != binaryPayload {
+		t.Error("Expecting a stale If-Range to give the full content, got:", rec.Code)
+	}
+
+	rec = writeTestBinary(t, map[string]string{"Range": "bytes=30-"})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable || rec.Header().Get("Content-Range") != "bytes */20" || !strings.Contains(rec.Header().Get("Content-Type"), "problem") {
+		t.Error("Expecting a 416 problem, got:", rec.Code, rec.Header())
+	}
+}
+
+func TestBinaryMultipleRanges(t *testing.T) {
+	rec := writeTestBinary(t, map[string]string{"Range": "bytes=0-1,-2"})
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if rec.Code != http.StatusPartialContent || err != nil || mediaType != "multipart/byteranges" {
+		t.Fatal("Expecting multipart/byteranges, got:", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	expected := []struct{ contentRange, data string }{{"bytes 0-1/20", "01"}, {"bytes 18-19/20", "ij"}}
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for _, e := range expected {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(part)
+		if part.Header.Get("Content-Range") != e.contentRange || part.Header.Get("Content-Type") != Application_OctetStream || string(data) != e.data {
+			t.Error("Expecting part", e.contentRange, "got:", part.Header, string(data))
+		}
+	}
+}
+
+type closingReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (this *closingReader) Close() error {
+	this.closed = true
+	return nil
+}
+
+func TestBinaryClosedWhenNotModified(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/media/1", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetETag("v1")
+
+	content := &closingReader{Reader: strings.NewReader(binaryPayload)}
+	bin, err := rb.newBinaryContent(reflect.ValueOf(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb.ctx.binary = bin
+	rb.WritePacket()
+
+	if rec.Code != http.StatusNotModified || !content.closed {
+		t.Error("Expecting the content to be closed on a 304, got:", rec.Code, content.closed)
+	}
+}
+
+func TestBinaryFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "gorest-binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(binaryPayload)
+
+	if !isBinaryType(reflect.TypeOf(file)) || !isBinaryType(byteSliceType) || isBinaryType(reflect.TypeOf("")) {
+		t.Error("Expecting files and byte slices to be binary content")
+	}
+
+	rb := &ResponseBuilder{&Context{}}
+	bin, err := rb.newBinaryContent(reflect.ValueOf(file))
+	if err != nil || bin.size != int64(len(binaryPayload)) || rb.ctx.lastModified.IsZero() {
+		t.Fatal("Expecting the size and modification time of the file, got:", err, bin, rb.ctx.lastModified)
+	}
+
+	bin.close()
+	if _, err := file.Write([]byte("x")); err == nil {
+		t.Error("Expecting the file to be closed once written")
+	}
+}
@@ -0,0 +1,398 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"container/list"
+	"github.com/rmullinnix/logger"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Server side caching of an endpoint, declared with the servercache tag:
+//
+//	servercache:"30s"              cache for 30 seconds
+//	servercache:"true"             cache for the s-maxage or max-age of the cache tag
+//	servercache:"30s,credentials"  also cache responses to requests carrying credentials
+//
+//Responses to requests with credentials (an Authorization header, a cookie or a session token)
+//are cached only with the credentials option, keyed by the Subject of the Principal the authorizer
+//established, or on endpoints without a security scheme by the principal of the session; see
+//SetCachePrincipalKey. The values of the request headers the response varies on are part of the key.
+type cachePolicy struct {
+	ttl		time.Duration // 0 disables the server side cache
+	credentials	bool
+}
+
+type cacheEntry struct {
+	key		string
+	path		string
+	mimeType	string
+	header		http.Header
+	data		[]byte
+	etag		string // set by the method, validating the cached response as it did the original
+	lastModified	time.Time
+	stored		time.Time
+	expires		time.Time
+}
+
+//An LRU of marshalled responses, shared by all endpoints
+type responseCache struct {
+	lock		sync.Mutex
+	size		int
+	entries		map[string]*list.Element
+	lru		*list.List // front is the most recently used
+}
+
+var cache = &responseCache{size: 1000, entries: make(map[string]*list.Element), lru: list.New()}
+
+var cachePrincipalKey = "UserUUID"
+
+//Headers describing the exchange with one client rather than the resource, never replayed from the cache
+var uncachedHeaders = []string{"Set-Cookie", "Authorization", "Www-Authenticate", "Access-Control-Allow-Origin", "Date", "Age"}
+
+//Sets the maximum number of responses held in the server side cache, the least recently used
+//are evicted beyond it. Defaults to 1000.
+func SetResponseCacheSize(size int) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.size = size
+	cache.evict()
+}
+
+//Sets the SessionData key identifying the principal of a request to an endpoint without a security
+//scheme, usually set by the authorizer. Cached responses to requests with credentials are only served
+//to the same principal. Defaults to "UserUUID".
+func SetCachePrincipalKey(key string) {
+	cachePrincipalKey = key
+}
+
+//Removes the cached responses whose request path matches the pattern, returning how many were
+//removed. A pattern ending in "*" matches any path with that prefix, otherwise the pattern
+//follows path.Match, e.g. "/users/*/orders". Successful POST, PUT, PATCH and DELETE requests
+//invalidate the responses cached for their own path.
+func InvalidateCache(pattern string) int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	removed := 0
+	for e := cache.lru.Front(); e != nil; {
+		next := e.Next()
+		if matchCachePath(pattern, e.Value.(*cacheEntry).path) {
+			cache.remove(e)
+			removed++
+		}
+		e = next
+	}
+	return removed
+}
+
+//Removes the cached responses of exactly the path, which is not taken as a pattern
+func invalidateCachePath(p string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for e := cache.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*cacheEntry).path == p {
+			cache.remove(e)
+		}
+		e = next
+	}
+}
+
+func matchCachePath(pattern string, p string) bool {
+	if strings.HasSuffix(pattern, "*") && strings.HasPrefix(p, strings.TrimSuffix(pattern, "*")) {
+		return true
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
+
+func (this *responseCache) get(key string) *cacheEntry {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	e, found := this.entries[key]
+	if !found {
+		return nil
+	}
+	entry := e.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		this.remove(e)
+		return nil
+	}
+	this.lru.MoveToFront(e)
+	return entry
+}
+
+func (this *responseCache) put(entry *cacheEntry) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if e, found := this.entries[entry.key]; found {
+		this.remove(e)
+	}
+	this.entries[entry.key] = this.lru.PushFront(entry)
+	this.evict()
+}
+
+func (this *responseCache) remove(e *list.Element) {
+	delete(this.entries, e.Value.(*cacheEntry).key)
+	this.lru.Remove(e)
+}
+
+func (this *responseCache) evict() {
+	for this.lru.Len() > this.size && this.lru.Len() > 0 {
+		this.remove(this.lru.Back())
+	}
+}
+
+//Parses the servercache tag, taking the ttl from the Cache-Control directives when it is "true"
+func parseCachePolicy(tag string, cacheControl string, sign string) cachePolicy {
+	var policy	cachePolicy
+
+	for _, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		if item == "credentials" {
+			policy.credentials = true
+		} else if item == "true" {
+			policy.ttl = cacheControlMaxAge(cacheControl)
+		} else if ttl, err := time.ParseDuration(item); err == nil && ttl > 0 {
+			policy.ttl = ttl
+		} else {
+			logger.Error.Fatalln("[fatal]", "Invalid servercache:[" + tag + "], expecting a duration, 'true' and/or 'credentials': " + sign)
+		}
+	}
+
+	if strings.Contains(cacheControl, "no-store") {
+		logger.Error.Fatalln("[fatal]", "The servercache tag can not be combined with a no-store cache tag: " + sign)
+	}
+	if policy.ttl == 0 {
+		logger.Error.Fatalln("[fatal]", "The servercache tag needs a duration, or a cache tag with max-age or s-maxage: " + sign)
+	}
+	return policy
+}
+
+//The shared cache lifetime of the Cache-Control directives, s-maxage taking precedence over max-age
+func cacheControlMaxAge(cacheControl string) time.Duration {
+	var maxAge	time.Duration
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		secs, err := strconv.Atoi(strings.Trim(parts[1], "\""))
+		if err != nil {
+			continue
+		}
+		if name := strings.ToLower(parts[0]); name == "s-maxage" {
+			return time.Duration(secs) * time.Second
+		} else if name == "max-age" {
+			maxAge = time.Duration(secs) * time.Second
+		}
+	}
+	return maxAge
+}
+
+//Adds the request headers to the Vary header of the response, skipping those already listed
+func (this *ResponseBuilder) addVary(fields ...string) {
+	header := this.writer().Header()
+
+	for _, field := range fields {
+		if headerHasToken(header, "Vary", field) {
+			continue
+		}
+		if current := header.Get("Vary"); current == "" {
+			header.Set("Vary", field)
+		} else {
+			header.Set("Vary", current + ", " + field)
+		}
+	}
+}
+
+//Sets the Cache-Control and Vary headers declared by the cache and vary tags of the endpoint
+func (this *ResponseBuilder) setCacheHeaders(ep EndPointStruct) {
+	this.addVary(ep.vary...)
+	this.ctx.cacheControl = ep.cacheControl
+}
+
+//Whether the request carries credentials, making its response specific to the client
+func hasCredentials(rb *ResponseBuilder) bool {
+	r := rb.ctx.request
+	return rb.ctx.xsrftoken != "" || r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+//The key of the response to the request in the server side cache, false if it may not be cached
+func cacheKey(rb *ResponseBuilder, ep EndPointStruct, mimeType string) (string, bool) {
+	r := rb.ctx.request
+	if r.Method != GET && r.Method != HEAD {
+		return "", false
+	}
+
+	principal := ""
+	if hasCredentials(rb) {
+		if !ep.serverCache.credentials {
+			return "", false
+		}
+		if rb.ctx.principal != nil {
+			principal = rb.ctx.principal.Subject
+		} else if ep.SecurityScheme == nil {
+			principal, _ = rb.Session().GetString(cachePrincipalKey)
+		}
+		if principal == "" {
+			// never share a response to a client we can not tell apart
+			return "", false
+		}
+	}
+
+	// json is indented for clients sending X-Pretty as well as ?pretty
+	pretty := ""
+	if prettyRequested(r) {
+		pretty = " pretty"
+	}
+
+	key := r.Method + " " + r.URL.RequestURI() + " " + mimeType + " " + principal + pretty
+	for _, field := range varyFields(rb, ep) {
+		switch field {
+		case "*":
+			return "", false
+		case "Accept", "Accept-Encoding", "X-Pretty":
+			// already in the key, or applied as the cached response is written
+		default:
+			key += "\n" + field + ": " + strings.Join(r.Header[field], ", ")
+		}
+	}
+	return key, true
+}
+
+//The request headers the response varies on: those of the vary tag and of the Vary header so far
+func varyFields(rb *ResponseBuilder, ep EndPointStruct) []string {
+	fields := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(field string) {
+		if field = http.CanonicalHeaderKey(strings.TrimSpace(field)); field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range ep.vary {
+		add(field)
+	}
+	for _, value := range rb.writer().Header()["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			add(field)
+		}
+	}
+	return fields
+}
+
+//Prepares the response from the server side cache, returning false on a miss
+func (this *ResponseBuilder) serveCached(key string) bool {
+	entry := cache.get(key)
+	if entry == nil {
+		return false
+	}
+
+	header := this.writer().Header()
+	for name, values := range entry.header {
+		if name != "Vary" {
+			header[name] = values
+		}
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.stored) / time.Second)))
+
+	this.SetResponseCode(http.StatusOK)
+	this.SetContentType(entry.mimeType)
+	this.ctx.responseMimeType = entry.mimeType
+	this.ctx.respPacket = newBytesPacket(entry.data)
+	this.ctx.etag = entry.etag
+	this.ctx.lastModified = entry.lastModified
+	return true
+}
+
+//Stores the marshalled response in the server side cache, unless the method set another status,
+//wrote the response itself, set a cookie or asked for it not to be stored
+func (this *ResponseBuilder) storeCached(key string, ep EndPointStruct) {
+	if this.ctx.respPacket == nil || this.ctx.dataHasBeenWritten || this.ctx.problem != nil {
+		return
+	}
+	if this.ctx.responseCode != 0 && this.ctx.responseCode != http.StatusOK {
+		return
+	}
+	if headerHasToken(this.writer().Header(), "Cache-Control", "no-store") || len(this.writer().Header()["Set-Cookie"]) > 0 {
+		return
+	}
+
+	data, ok := this.entityBytes()
+	if !ok {
+		return
+	}
+
+	header := cloneHeader(this.writer().Header())
+	for _, name := range uncachedHeaders {
+		header.Del(name)
+	}
+
+	now := time.Now()
+	cache.put(&cacheEntry{
+		key:          key,
+		path:         this.ctx.request.URL.Path,
+		mimeType:     this.ctx.responseMimeType,
+		header:       header,
+		data:         data,
+		etag:         this.ctx.etag,
+		lastModified: this.ctx.lastModified,
+		stored:       now,
+		expires:      now.Add(ep.serverCache.ttl),
+	})
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for name, values := range h {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+//Writes the Cache-Control header of successful and not modified responses; errors are not
+//given the freshness of the resource
+func (this *ResponseBuilder) writeCacheControl() {
+	if this.ctx.cacheControl == "" || this.ctx.problem != nil || this.ctx.responseCode >= 400 {
+		return
+	}
+	if this.writer().Header().Get("Cache-Control") == "" {
+		this.writer().Header().Set("Cache-Control", this.ctx.cacheControl)
+	}
+}
@@ -0,0 +1,260 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type CacheTestService struct {
+	RestService `root:"/cache-test/"`
+	item        EndPoint `method:"GET" path:"/items/{id:string}" output:"string" cache:"public, max-age=60" servercache:"true"`
+	updateItem  EndPoint `method:"PUT" path:"/items/{id:string}" postdata:"string"`
+}
+
+var cacheTestRegister sync.Once
+var cacheTestCalls int32
+
+func (serv CacheTestService) Item(id string) string {
+	atomic.AddInt32(&cacheTestCalls, 1)
+	return "item " + id
+}
+
+func (serv CacheTestService) UpdateItem(data string, id string) {
+}
+
+func TestServerCache(t *testing.T) {
+	cacheTestRegister.Do(func() { RegisterService(new(CacheTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	get := func(auth string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/cache-test/items/1", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	start := atomic.LoadInt32(&cacheTestCalls)
+	first := get("")
+	second := get("")
+	if calls := atomic.LoadInt32(&cacheTestCalls) - start; calls != 1 {
+		t.Fatal("Expecting the second request to be served from the cache, method called:", calls)
+	}
+	if first.Header.Get("Cache-Control") != "public, max-age=60" || second.Header.Get("Cache-Control") != "public, max-age=60" {
+		t.Error("Expecting the declared Cache-Control, got:", first.Header.Get("Cache-Control"), second.Header.Get("Cache-Control"))
+	}
+	if second.Header.Get("Age") == "" || second.Header.Get("Content-Type") != Application_Json {
+		t.Error("Expecting a cached json response with an Age, got:", second.Header)
+	}
+
+	get("Bearer abc")
+	if calls := atomic.LoadInt32(&cacheTestCalls) - start; calls != 2 {
+		t.Error("Responses to requests with credentials must not be cached, method called:", calls)
+	}
+
+	req, _ := http.NewRequest("PUT", server.URL+"/cache-test/items/1", strings.NewReader(`"changed"`))
+	req.Header.Set("Content-Type", Application_Json)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	get("")
+	if calls := atomic.LoadInt32(&cacheTestCalls) - start; calls != 3 {
+		t.Error("Expecting the PUT to invalidate the cached response, method called:", calls)
+	}
+}
+
+func TestResponseCacheLRU(t *testing.T) {
+	defer SetResponseCacheSize(1000)
+	InvalidateCache("*")
+	SetResponseCacheSize(2)
+
+	for _, p := range []string{"/a", "/b"} {
+		cache.put(&cacheEntry{key: p, path: p, expires: time.Now().Add(time.Minute)})
+	}
+	cache.get("/a")
+	cache.put(&cacheEntry{key: "/c", path: "/c", expires: time.Now().Add(time.Minute)})
+
+	if cache.get("/b") != nil || cache.get("/a") == nil || cache.get("/c") == nil {
+		t.Error("Expecting the least recently used entry to be evicted")
+	}
+
+	cache.put(&cacheEntry{key: "/d", path: "/d", expires: time.Now().Add(-time.Second)})
+	if cache.get("/d") != nil {
+		t.Error("Expecting expired entries to be dropped")
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	InvalidateCache("*")
+	for _, p := range []string{"/users/1", "/users/1/orders", "/users/2/orders", "/items/1"} {
+		cache.put(&cacheEntry{key: p, path: p, expires: time.Now().Add(time.Minute)})
+	}
+
+	if n := InvalidateCache("/users/*/orders"); n != 2 {
+		t.Error("Expecting path.Match patterns, removed:", n)
+	}
+	if n := InvalidateCache("/users/*"); n != 1 {
+		t.Error("Expecting a trailing * to match the prefix, removed:", n)
+	}
+	if cache.get("/items/1") == nil {
+		t.Error("Expecting other paths to remain cached")
+	}
+
+	cache.put(&cacheEntry{key: "/items/[1]", path: "/items/[1]", expires: time.Now().Add(time.Minute)})
+	invalidateCachePath("/items/[1]")
+	if cache.get("/items/[1]") != nil || cache.get("/items/1") == nil {
+		t.Error("Expecting the exact path, and only it, to be invalidated")
+	}
+	InvalidateCache("*")
+}
+
+func TestCacheKeyPretty(t *testing.T) {
+	key := func(pretty string) string {
+		req, _ := http.NewRequest("GET", "/items/1", nil)
+		if pretty != "" {
+			req.Header.Set("X-Pretty", pretty)
+		}
+		k, _ := cacheKey(&ResponseBuilder{&Context{writer: httptest.NewRecorder(), request: req}}, EndPointStruct{}, Application_Json)
+		return k
+	}
+	if key("") == key("true") || key("") != key("false") {
+		t.Error("Expecting X-Pretty to be part of the cache key:", key(""), key("true"))
+	}
+}
+
+func TestCacheKeyVary(t *testing.T) {
+	ep := EndPointStruct{vary: []string{"Accept-Language"}, serverCache: cachePolicy{ttl: time.Minute, credentials: true}}
+	key := func(language string, principal *Principal) (string, bool) {
+		req, _ := http.NewRequest("GET", "/items/1", nil)
+		req.Header.Set("Accept-Language", language)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Vary", "Accept-Encoding, X-Tenant")
+		if principal != nil {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		rb := &ResponseBuilder{&Context{writer: rec, request: req, principal: principal}}
+		rb.ctx.sessData.relSessionData = map[string]interface{}{"UserUUID": "shared"}
+		return cacheKey(rb, ep, Application_Json)
+	}
+
+	en, _ := key("en", nil)
+	if de, _ := key("de", nil); en == de {
+		t.Error("Expecting the vary headers to be part of the cache key:", en)
+	}
+	if !strings.Contains(en, "X-Tenant: ") || strings.Contains(en, "Accept-Encoding") {
+		t.Error("Expecting the Vary header of the response, but not Accept-Encoding, in the key:", en)
+	}
+
+	ann, _ := key("en", &Principal{Subject: "ann"})
+	bob, _ := key("en", &Principal{Subject: "bob"})
+	if ann == bob {
+		t.Error("Expecting principals sharing a session to be cached apart:", ann)
+	}
+	if _, cached := key("en", &Principal{}); cached {
+		t.Error("Expecting a principal without a subject not to be cached")
+	}
+}
+
+func TestCachedValidators(t *testing.T) {
+	InvalidateCache("*")
+	defer InvalidateCache("*")
+	ep := EndPointStruct{serverCache: cachePolicy{ttl: time.Minute}}
+	modified := time.Date(2014, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	req, _ := http.NewRequest("GET", "/items/1", nil)
+	rb := &ResponseBuilder{&Context{writer: httptest.NewRecorder(), request: req}}
+	rb.ctx.respPacket = newBytesPacket([]byte("data"))
+	rb.SetETag("v1").SetLastModified(modified)
+	rb.storeCached("validators", ep)
+
+	req, _ = http.NewRequest("GET", "/items/1", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	rb = &ResponseBuilder{&Context{writer: rec, request: req}}
+	if !rb.serveCached("validators") || !rb.notModified() {
+		t.Error("Expecting a cached response to be validated by the etag of the method")
+	}
+	if rec.Header().Get("ETag") != `"v1"` || rec.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+		t.Error("Expecting the validators with the cached response, got:", rec.Header())
+	}
+}
+
+func TestStoreCachedHeaders(t *testing.T) {
+	InvalidateCache("*")
+	defer InvalidateCache("*")
+	ep := EndPointStruct{serverCache: cachePolicy{ttl: time.Minute}}
+
+	store := func(key string, header http.Header) {
+		req, _ := http.NewRequest("GET", "/items/"+key, nil)
+		rec := httptest.NewRecorder()
+		for name, values := range header {
+			rec.Header()[name] = values
+		}
+		rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+		rb.ctx.respPacket = ioutil.NopCloser(strings.NewReader("data"))
+		rb.storeCached(key, ep)
+	}
+
+	store("a", http.Header{"Authorization": {"Bearer abc"}, "Etag": {`"1"`}})
+	if entry := cache.get("a"); entry == nil || entry.header.Get("Authorization") != "" || entry.header.Get("Etag") != `"1"` {
+		t.Error("Expecting per-client headers to be left out of the cached response, got:", entry)
+	}
+
+	store("b", http.Header{"Set-Cookie": {"session=1"}})
+	if cache.get("b") != nil {
+		t.Error("Expecting responses setting cookies not to be cached")
+	}
+}
+
+func TestCacheControlMaxAge(t *testing.T) {
+	if ttl := cacheControlMaxAge("public, max-age=60, stale-while-revalidate=30"); ttl != time.Minute {
+		t.Error("Expecting max-age, got:", ttl)
+	}
+	if ttl := cacheControlMaxAge("max-age=60, s-maxage=10"); ttl != 10*time.Second {
+		t.Error("Expecting s-maxage to take precedence, got:", ttl)
+	}
+	if policy := parseCachePolicy("5m, credentials", "", "test"); policy.ttl != 5*time.Minute || !policy.credentials {
+		t.Error("Expecting a 5 minute policy with credentials, got:", policy)
+	}
+}
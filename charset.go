@@ -0,0 +1,106 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"errors"
+	"golang.org/x/text/encoding/htmlindex"
+	"io"
+	"mime"
+	"strings"
+)
+
+var errUnsupportedCharset = errors.New("Unsupported charset")
+
+//The charset parameter of a Content-Type, lower case. Returns "" when there is none or the header can
+//not be parsed.
+func contentCharset(contentType string) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		return strings.ToLower(strings.TrimSpace(params["charset"]))
+	}
+	return ""
+}
+
+//Whether the media type is text, to which a charset applies: text/*, json, xml, yaml and forms.
+//Binary types such as application/msgpack or application/octet-stream are not.
+func isTextMediaType(contentType string) bool {
+	key := marshallerKey(contentType)
+	switch {
+	case strings.HasPrefix(key, "text/"), baseMediaType(key) != "":
+		return true
+	case key == Application_Json, key == Application_Xml, key == Application_Yaml, key == Application_Form_UrlEncoded:
+		return true
+	}
+	return false
+}
+
+//Transcodes body from the charset of the Content-Type to utf-8, which is what the marshallers read.
+//Bodies in utf-8, us-ascii or without a charset, and bodies of binary media types, are read as they
+//are. Charsets are known by their WHATWG names and labels (iso-8859-1, windows-1252, shift_jis,
+//utf-16le ...), others fail with errUnsupportedCharset.
+func newCharsetReader(contentType string, body io.Reader) (io.Reader, error) {
+	if !isTextMediaType(contentType) {
+		return body, nil
+	}
+	switch charset := contentCharset(contentType); charset {
+	case "":
+		return body, nil
+	case "utf-8", "utf8", "us-ascii":
+		return utf8Reader{body}, nil
+	default:
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, errUnsupportedCharset
+		}
+		return utf8Reader{encoding.NewDecoder().Reader(body)}, nil
+	}
+}
+
+//Text known to be utf-8 from the charset of its Content-Type, which overrides the encoding an xml
+//declaration names
+type utf8Reader struct {
+	io.Reader
+}
+
+func (utf8Reader) isUTF8() {}
+
+//Whether r was transcoded to utf-8 by newCharsetReader
+func isUTF8Reader(r io.Reader) bool {
+	_, isUTF8 := r.(interface{ isUTF8() })
+	return isUTF8
+}
+
+//Decodes xml documents declaring an encoding other than utf-8, for input whose charset was not
+//given by a Content-Type, such as request bodies without a charset, client responses and WebSocket
+//messages
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, errUnsupportedCharset
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
@@ -0,0 +1,76 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCharsetReader(t *testing.T) {
+	cases := map[string]string{
+		"text/plain; charset=ISO-8859-1":             "M\xfcnchen",
+		"application/json; charset=\"windows-1252\"": "M\xfcnchen",
+		"text/plain; charset=utf-16le":               "M\x00\xfc\x00n\x00c\x00h\x00e\x00n\x00",
+		"text/plain; charset=utf-8":                  "München",
+		"text/plain":                                 "München",
+	}
+	for contentType, body := range cases {
+		reader, err := newCharsetReader(contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(contentType, err)
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != "München" {
+			t.Error("Unexpected utf-8 for", contentType, "got:", string(data))
+		}
+	}
+
+	if reader, _ := newCharsetReader(Application_MsgPack+"; charset=iso-8859-1", strings.NewReader("\xfc")); reader == nil {
+		t.Error("Expecting a reader for msgpack")
+	} else if data, _ := ioutil.ReadAll(reader); string(data) != "\xfc" {
+		t.Error("Expecting binary types not to be transcoded, got:", data)
+	}
+
+	var item struct {
+		City string `xml:"city"`
+	}
+	reader, _ := newCharsetReader("application/xml; charset=iso-8859-1", strings.NewReader(`<?xml version="1.0" encoding="ISO-8859-1"?><item><city>M`+"\xfc"+`nchen</city></item>`))
+	if err := decodeXML(reader, &item); err != nil || item.City != "München" {
+		t.Error("Expecting transcoded xml to be decoded despite its declaration, got:", item.City, err)
+	}
+
+	if _, err := newCharsetReader("text/plain; charset=klingon", strings.NewReader("")); err != errUnsupportedCharset {
+		t.Error("Expecting an unsupported charset, got:", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("x"))
+	req.Header.Set("Content-Type", "text/plain; charset=klingon")
+	if _, code, err := readRequestBody(req); code != http.StatusUnsupportedMediaType || err == nil || !strings.HasSuffix(err.Error(), "klingon") {
+		t.Error("Expecting 415 for an unsupported charset, got:", code, err)
+	}
+}
@@ -106,11 +106,29 @@ type RequestBuilder struct {
 func (this *RequestBuilder) Request() *http.Request {
 	return this._req
 }
+//Sets the mime type entities are marshalled with, application/json by default. It is sent as the
+//Content-Type of posts and as the Accept header, unless the request already has them.
 func (this *RequestBuilder) UseContentType(mime string) *RequestBuilder {
 	this.defaultContentType = mime
 	return this
 }
 
+//Asks for the content type in use, unless an Accept header was set on the request
+func (this *RequestBuilder) setAccept() {
+	if this._req.Header.Get("Accept") == "" {
+		this._req.Header.Set("Accept", this.defaultContentType)
+	}
+}
+
+//The mime type to unmarshal the response with: its Content-Type when there is a Marshaller for
+//it, otherwise the content type in use
+func (this *RequestBuilder) responseMime(res *http.Response) string {
+	if mime := res.Header.Get("Content-Type"); mime != "" && marshallerFor(mime) != nil {
+		return mime
+	}
+	return this.defaultContentType
+}
+
 func (this *RequestBuilder) AddCookie(cookie *http.Cookie) *RequestBuilder {
 	this._req.AddCookie(cookie)
 	return this
@@ -150,6 +168,7 @@ func (this *RequestBuilder) Options(opts *[]string) (*http.Response, error) {
 func (this *RequestBuilder) Get(i interface{}, expecting int) (*http.Response, error) {
 	//this._req.URL = u
 	this._req.Method = GET
+	this.setAccept()
 
 	res, err := this.client.Do(this._req)
 	if err != nil {
@@ -160,8 +179,8 @@ func (this *RequestBuilder) Get(i interface{}, expecting int) (*http.Response, e
 		buf := new(bytes.Buffer)
 		io.Copy(buf, res.Body)
 		res.Body.Close()
-		err = bytesToInterface(buf, i, this.defaultContentType)
-		return res, nil
+		err = bytesToInterface(buf, i, this.responseMime(res))
+		return res, err
 	}
 
 	return res, errors.New(res.Status)
@@ -178,6 +197,10 @@ func (this *RequestBuilder) PostWithResponse(i interface{}, output interface{})
 		return nil, err
 	}
 	this._req.Body = bb
+	if this._req.Header.Get("Content-Type") == "" {
+		this._req.Header.Set("Content-Type", this.defaultContentType)
+	}
+	this.setAccept()
 
 	res, err := this.client.Do(this._req)
 	if err != nil {
@@ -189,7 +212,7 @@ func (this *RequestBuilder) PostWithResponse(i interface{}, output interface{})
 	io.Copy(buf, res.Body)
 	res.Body.Close()
 	if buf.Len() > 0 && output != nil {
-		err = bytesToInterface(buf, output, this.defaultContentType)
+		err = bytesToInterface(buf, output, this.responseMime(res))
 		return res, err
 	}
 	return res, nil
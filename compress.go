@@ -0,0 +1,493 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/rmullinnix/logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultMaxDecompressedSize = 10 << 20
+
+var maxDecompressedSize int64 = defaultMaxDecompressedSize
+
+var (
+	errUnsupportedEncoding = errors.New("Unsupported Content-Encoding")
+	errBodyTooLarge        = errors.New("Request entity exceeds the maximum allowed size")
+)
+
+//Sets the maximum number of bytes a compressed (Content-Encoding: gzip or deflate) request body
+//may expand to. Requests that exceed the limit are rejected with 413 Request Entity Too Large.
+//The default is 10MB; a value <= 0 removes the limit.
+func SetMaxDecompressedSize(size int64) {
+	maxDecompressedSize = size
+}
+
+//Reads the body of the request, transparently decoding any Content-Encoding applied by the client
+//and transcoding it to utf-8.
+//On failure the http status code that should be returned to the client is given along with the error.
+func readRequestBody(r *http.Request) ([]byte, int, error) {
+	if r.Body == nil {
+		return []byte{}, http.StatusOK, nil
+	}
+
+	body, err := openRequestBody(r)
+	var data	[]byte
+	if err == nil {
+		defer body.Close()
+		data, err = ioutil.ReadAll(body)
+	}
+	if err != nil {
+		code, err := bodyError(err, r)
+		return nil, code, err
+	}
+
+	return data, http.StatusOK, nil
+}
+
+//Decodes the body of the request into a new value of type t with the StreamMarshaller, reading it
+//as it is decoded. An empty body gives the zero value. On failure the http status code that should
+//be returned to the client is given along with the error.
+func decodeRequestBody(r *http.Request, t reflect.Type, m StreamMarshaller) (reflect.Value, int, error) {
+	v := reflect.New(t)
+	if r.Body == nil {
+		return v.Elem(), http.StatusOK, nil
+	}
+
+	body, err := openRequestBody(r)
+	if err == nil {
+		defer body.Close()
+		err = m.Decode(body, v.Interface())
+	}
+	if err != nil && err != io.EOF {
+		code, err := bodyError(err, r)
+		return reflect.Value{}, code, err
+	}
+
+	return v.Elem(), http.StatusOK, nil
+}
+
+//The http status code for an error reading the request body
+func bodyError(err error, r *http.Request) (int, error) {
+	switch err {
+	case errUnsupportedEncoding:
+		return http.StatusUnsupportedMediaType, errors.New(err.Error() + ": " + r.Header.Get("Content-Encoding"))
+	case errBodyTooLarge:
+		return http.StatusRequestEntityTooLarge, err
+	case errUnsupportedCharset:
+		return http.StatusUnsupportedMediaType, errors.New(err.Error() + ": " + contentCharset(r.Header.Get("Content-Type")))
+	}
+	return http.StatusBadRequest, err
+}
+
+//Opens the body of the request, removing its Content-Encoding and transcoding it to utf-8
+func openRequestBody(r *http.Request) (io.ReadCloser, error) {
+	body, err := newBodyReader(r.Header.Get("Content-Encoding"), r.Body, maxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := newCharsetReader(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if utf8, isUTF8 := reader.(utf8Reader); isUTF8 {
+		return struct {
+			utf8Reader
+			io.Closer
+		}{utf8, body}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, body}, nil
+}
+
+//Opens a reader that removes the Content-Encoding from body and fails with errBodyTooLarge once
+//more than limit bytes have been decompressed. Bodies sent without a coding are not limited.
+//Codings are listed in the order they were applied, so they are removed in reverse order.
+func newBodyReader(contentEncoding string, body io.Reader, limit int64) (io.ReadCloser, error) {
+	codings := strings.Split(contentEncoding, ",")
+
+	reader := &bodyReader{Reader: body}
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch strings.ToLower(strings.TrimSpace(codings[i])) {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(reader.Reader)
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			reader.Reader = gz
+			reader.closers = append(reader.closers, gz)
+		case "deflate":
+			fl, err := newDeflateReader(reader.Reader)
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			reader.Reader = fl
+			reader.closers = append(reader.closers, fl)
+		default:
+			reader.Close()
+			return nil, errUnsupportedEncoding
+		}
+	}
+
+	if limit > 0 && len(reader.closers) > 0 {
+		reader.Reader = &limitedBody{reader.Reader, limit}
+	}
+
+	return reader, nil
+}
+
+//The decoded request body, closing the decompressors when done
+type bodyReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (this *bodyReader) Close() error {
+	for i := len(this.closers) - 1; i >= 0; i-- {
+		this.closers[i].Close()
+	}
+	return nil
+}
+
+//Reads at most n bytes, failing with errBodyTooLarge if the body holds more
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (this *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > this.n+1 {
+		p = p[:this.n+1]
+	}
+	n, err := this.r.Read(p)
+	this.n -= int64(n)
+	if this.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+//HTTP "deflate" is defined as the zlib format, however a number of clients send a raw deflate
+//stream instead. Peek at the header to decide which one we have been given.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+
+	header, err := buf.Peek(2)
+	if err != nil {
+		if err == io.EOF {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buf)
+	}
+
+	return flate.NewReader(buf), nil
+}
+
+//Response compression settings of a service, declared with the compression tag:
+//
+//	type UserService struct {
+//	    gorest.RestService `root:"/users/" compression:"level=6,minsize=860"`
+//	    ...
+//
+//Declaring compression enables it for the endpoints of the service, unless gzip:"false" is given.
+//Responses smaller than minsize bytes are sent as is, as are mime types that do not compress well;
+//see SetCompressibleTypes.
+type compressionPolicy struct {
+	level	int // compress/flate level, -2 (huffman only) to 9
+	minSize	int
+}
+
+const defaultCompressionMinSize = 1024
+
+var defaultCompression = compressionPolicy{level: gzip.DefaultCompression, minSize: defaultCompressionMinSize}
+
+var compressibleTypes = []string{"text/", "application/json", "application/xml", "application/javascript", Application_NDJson, Application_Yaml, "+json", "+xml", "+yaml"}
+
+//Sets the mime types of the responses that may be compressed. Entries ending in "/" match every
+//subtype (e.g. "text/"), entries starting with "+" match a structured syntax suffix (e.g. "+json"),
+//anything else must match exactly. Images, archives and other already compressed types should not
+//be listed.
+func SetCompressibleTypes(types ...string) {
+	compressibleTypes = types
+}
+
+func compressible(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	for _, t := range compressibleTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mimeType, t) {
+			return true
+		} else if strings.HasPrefix(t, "+") && strings.HasSuffix(mimeType, t) {
+			return true
+		} else if mimeType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCompression(tag string, name string) compressionPolicy {
+	policy := defaultCompression
+
+	for _, item := range strings.Split(tag, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		value := -100
+		if len(parts) == 2 {
+			if v, err := strconv.Atoi(parts[1]); err == nil {
+				value = v
+			}
+		}
+
+		if parts[0] == "level" && value >= flate.HuffmanOnly && value <= flate.BestCompression {
+			policy.level = value
+		} else if parts[0] == "minsize" && value >= 0 {
+			policy.minSize = value
+		} else {
+			logger.Error.Fatalln("[fatal]", "Invalid compression:[" + tag + "] on service " + name + ", expecting level=-2..9 and/or minsize=bytes")
+		}
+	}
+	return policy
+}
+
+//Splits an element of a header list into its value and q-value, which defaults to 1
+func parseQuality(item string) (string, float64) {
+	parts := strings.Split(item, ";")
+	q := 1.0
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") || strings.HasPrefix(param, "Q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), q
+}
+
+//Picks the content coding of the response from the Accept-Encoding of the request, weighing gzip
+//and deflate by their q-values, gzip winning ties. Returns "" for the identity coding, which is
+//also chosen when the client weighs it higher than either.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		if coding, q := parseQuality(item); coding != "" {
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			weights[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, found := weights[coding]
+		if !found {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	if q, found := weights["identity"]; found && q > bestQ {
+		return ""
+	}
+	return best
+}
+
+//A gzip or zlib writer, reset and reused across responses
+type compressWriter interface {
+	io.Writer
+	Reset(w io.Writer)
+	Flush() error
+	Close() error
+}
+
+//Writers are pooled per coding and level, indexed by level - flate.HuffmanOnly
+var (
+	gzipWriters	[flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+	deflateWriters	[flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+)
+
+func writerPool(encoding string, level int) *sync.Pool {
+	if encoding == "deflate" {
+		return &deflateWriters[level - flate.HuffmanOnly]
+	}
+	return &gzipWriters[level - flate.HuffmanOnly]
+}
+
+func newCompressWriter(w io.Writer, encoding string, level int) compressWriter {
+	if cw, ok := writerPool(encoding, level).Get().(compressWriter); ok {
+		cw.Reset(w)
+		return cw
+	}
+
+	// the level has been validated, so the constructors can not fail
+	if encoding == "deflate" {
+		cw, _ := zlib.NewWriterLevel(w, level)
+		return cw
+	}
+	cw, _ := gzip.NewWriterLevel(w, level)
+	return cw
+}
+
+//Completes the compressed stream and returns the writer to its pool
+func closeCompressWriter(cw compressWriter, encoding string, level int) {
+	cw.Close()
+	writerPool(encoding, level).Put(cw)
+}
+
+//Chooses the content coding of the response once: compression must be enabled for the endpoint,
+//accepted by the client and suit the mime type, and the entity must reach the minimum size
+//(streams, and entities whose size is not known before they are written, are always compressed).
+//Returns "" for no compression.
+func (this *ResponseBuilder) responseEncoding() string {
+	if this.ctx.encodingChosen {
+		return this.ctx.contentEncoding
+	}
+	this.ctx.encodingChosen = true
+
+	if !this.ctx.encodeGzip || this.ctx.events != nil || this.writer().Header().Get("Content-Encoding") != "" {
+		return ""
+	}
+	mimeType := this.ctx.responseMimeType
+	if this.ctx.stream != nil {
+		mimeType = this.ctx.stream.mimeType
+	}
+	if !compressible(mimeType) {
+		return ""
+	}
+
+	policy := this.compressionPolicy()
+	if this.ctx.stream == nil {
+		if this.ctx.respPacket == nil {
+			return ""
+		}
+		if size := packetSize(this.ctx.respPacket); size >= 0 && size < int64(policy.minSize) {
+			return ""
+		}
+	}
+
+	this.ctx.contentEncoding = negotiateEncoding(this.ctx.request.Header.Get("Accept-Encoding"))
+	return this.ctx.contentEncoding
+}
+
+func (this *ResponseBuilder) compressionPolicy() compressionPolicy {
+	if this.ctx.compression == nil {
+		return defaultCompression
+	}
+	return *this.ctx.compression
+}
+
+//Writes the response entity, compressed with the content coding of the response if there is one.
+//Entities are encoded straight into the response and the status line is sent with their first byte,
+//so an entity that fails to encode before anything is written is still answered with a 500.
+func (this *ResponseBuilder) writeEntity() {
+	encoding := this.responseEncoding()
+	level := this.compressionPolicy().level
+	out := &entityWriter{rb: this, encoding: encoding}
+
+	var w	io.Writer = out
+	var cw	compressWriter
+	if encoding != "" {
+		cw = newCompressWriter(out, encoding, level)
+		w = cw
+	}
+
+	_, err := io.Copy(w, this.ctx.respPacket)
+	this.ctx.respPacket.Close()
+	if err == nil && cw != nil {
+		err = cw.Close()
+	}
+	if cw != nil {
+		writerPool(encoding, level).Put(cw)
+	}
+
+	if err == nil {
+		out.start()
+		return
+	}
+
+	logger.Error.Println("[gen] could not write response: " + err.Error())
+	if !out.started {
+		this.SetProblem(NewProblem(http.StatusInternalServerError, "Internal server error. Could not Marshal/UnMarshal data: " + err.Error()))
+		this.formatProblem()
+		this.writer().Header().Set("Content-Type", this.ctx.responseMimeType)
+		this.writer().Header().Del("ETag")
+		this.writer().Header().Del("Cache-Control")
+		this.writer().WriteHeader(this.ctx.responseCode)
+		io.Copy(this.writer(), this.ctx.respPacket)
+	}
+}
+
+//Sends the status line of the response, with the Content-Encoding, before the first byte of the entity
+type entityWriter struct {
+	rb		*ResponseBuilder
+	encoding	string
+	started		bool
+}
+
+func (this *entityWriter) start() {
+	if this.started {
+		return
+	}
+	this.started = true
+
+	header := this.rb.writer().Header()
+	if this.encoding != "" {
+		header.Set("Content-Encoding", this.encoding)
+		header.Del("Content-Length")
+	}
+	this.rb.writer().WriteHeader(this.rb.ctx.responseCode)
+}
+
+func (this *entityWriter) Write(p []byte) (int, error) {
+	this.start()
+	return this.rb.writer().Write(p)
+}
@@ -0,0 +1,211 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const compressPayload = `{"Id":"1","FirstName":"David","LastName":"Coperfield","Age":20,"Weight":0}`
+
+func TestDecodeBody(t *testing.T) {
+	var gz, zl, fl bytes.Buffer
+
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(compressPayload))
+	gw.Close()
+
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(compressPayload))
+	zw.Close()
+
+	fw, _ := flate.NewWriter(&fl, flate.DefaultCompression)
+	fw.Write([]byte(compressPayload))
+	fw.Close()
+
+	cases := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"", []byte(compressPayload)},
+		{"identity", []byte(compressPayload)},
+		{"gzip", gz.Bytes()},
+		{"GZIP", gz.Bytes()},
+		{"deflate", zl.Bytes()},
+		{"deflate", fl.Bytes()},
+	}
+
+	request := func(encoding string, body []byte) *http.Request {
+		req, _ := http.NewRequest("POST", "/users", bytes.NewReader(body))
+		req.Header.Set("Content-Type", Application_Json)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		return req
+	}
+
+	for _, c := range cases {
+		data, code, err := readRequestBody(request(c.encoding, c.body))
+		if err != nil || code != http.StatusOK {
+			t.Error("Decode", c.encoding, "failed:", code, err)
+		} else if string(data) != compressPayload {
+			t.Error("Decode", c.encoding, "gave:", string(data))
+		}
+
+		v, code, err := decodeRequestBody(request(c.encoding, c.body), reflect.TypeOf(User{}), jsonMarshaller{})
+		if err != nil || code != http.StatusOK || v.Interface().(User).LastName != "Coperfield" {
+			t.Error("Decode", c.encoding, "as it is read failed:", code, err)
+		}
+	}
+
+	if _, code, err := readRequestBody(request("br", []byte(compressPayload))); code != http.StatusUnsupportedMediaType || !strings.HasSuffix(err.Error(), ": br") {
+		t.Error("Expecting 415 for an unsupported encoding, got:", code, err)
+	}
+
+	SetMaxDecompressedSize(10)
+	_, code, err := readRequestBody(request("gzip", gz.Bytes()))
+	_, streamCode, _ := decodeRequestBody(request("gzip", gz.Bytes()), reflect.TypeOf(User{}), jsonMarshaller{})
+	SetMaxDecompressedSize(defaultMaxDecompressedSize)
+	if code != http.StatusRequestEntityTooLarge || err != errBodyTooLarge || streamCode != http.StatusRequestEntityTooLarge {
+		t.Error("Expecting 413 for a body that is too large, got:", code, streamCode, err)
+	}
+
+	if _, code, err := readRequestBody(request("gzip", []byte(compressPayload))); code != http.StatusBadRequest || err == nil {
+		t.Error("Expecting 400 for a body that is not gzip encoded, got:", code, err)
+	}
+}
+
+//Reads a response body compressed with the encoding
+func readEncoded(encoding string, body *bytes.Buffer) (string, error) {
+	reader, err := newBodyReader(encoding, body, defaultMaxDecompressedSize)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	return string(data), err
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                            "",
+		"gzip":                        "gzip",
+		"gzip, deflate":               "gzip",
+		"deflate, gzip;q=0.5":         "deflate",
+		"gzip;q=0":                    "",
+		"gzip;q=0, deflate":           "deflate",
+		"*":                           "gzip",
+		"*, gzip;q=0":                 "deflate",
+		"identity, gzip;q=0.5":        "",
+		"x-gzip":                      "gzip",
+		"br;q=1.0, gzip;q=0.8, *;q=0": "gzip",
+	}
+
+	for accept, expected := range cases {
+		if encoding := negotiateEncoding(accept); encoding != expected {
+			t.Error("Accept-Encoding:", accept, "expecting:", expected, "got:", encoding)
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	for _, mimeType := range []string{"application/json", "text/html; charset=utf-8", "application/problem+json", "image/svg+xml"} {
+		if !compressible(mimeType) {
+			t.Error("Expecting", mimeType, "to be compressible")
+		}
+	}
+	for _, mimeType := range []string{"image/png", "application/zip", "application/octet-stream"} {
+		if compressible(mimeType) {
+			t.Error("Expecting", mimeType, "not to be compressed")
+		}
+	}
+}
+
+func writeCompressed(acceptEncoding string, mimeType string, body string, policy compressionPolicy) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req, encodeGzip: true, compression: &policy}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetContentType(mimeType)
+	rb.ctx.responseMimeType = mimeType
+	rb.ctx.respPacket = newBytesPacket([]byte(body))
+	rb.WritePacket()
+	return rec
+}
+
+func TestResponseCompression(t *testing.T) {
+	policy := parseCompression("level=9,minsize=32", "test")
+	if policy.level != 9 || policy.minSize != 32 {
+		t.Fatal("Expecting level 9 and minsize 32, got:", policy)
+	}
+
+	// the pooled writers must produce a complete stream every time
+	for i := 0; i < 3; i++ {
+		rec := writeCompressed("gzip", Application_Json, compressPayload, policy)
+		if rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatal("Expecting gzip encoded response")
+		}
+		if data, err := readEncoded("gzip", rec.Body); err != nil || data != compressPayload {
+			t.Fatal("Invalid gzip response:", err, data)
+		}
+	}
+
+	rec := writeCompressed("gzip;q=0.1, deflate", Application_Json, compressPayload, policy)
+	if data, err := readEncoded(rec.Header().Get("Content-Encoding"), rec.Body); err != nil || rec.Header().Get("Content-Encoding") != "deflate" || data != compressPayload {
+		t.Error("Expecting deflate encoded response, got:", rec.Header().Get("Content-Encoding"), err)
+	}
+
+	if rec = writeCompressed("gzip", Application_Json, `{"Id":"1"}`, policy); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != `{"Id":"1"}` {
+		t.Error("Expecting responses under the minimum size to be sent as is")
+	}
+
+	if rec = writeCompressed("gzip", "image/png", compressPayload, policy); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != compressPayload {
+		t.Error("Expecting images to be sent as is")
+	}
+
+	// entities whose size is not known up front are compressed
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req, encodeGzip: true, compression: &policy}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.ctx.responseMimeType = Application_Json
+	rb.ctx.respPacket = ioutil.NopCloser(strings.NewReader(`{"Id":"1"}`))
+	rb.WritePacket()
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("Expecting an entity of unknown size to be compressed")
+	}
+}
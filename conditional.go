@@ -0,0 +1,137 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Sets the entity tag of the response, for handlers that know the version of the resource cheaply.
+//The tag is quoted if it is not already, weak tags are given as W/"tag". A GET or HEAD request
+//whose If-None-Match matches the tag is answered with 304 Not Modified.
+func (this *ResponseBuilder) SetETag(etag string) *ResponseBuilder {
+	this.ctx.etag = quoteETag(etag)
+	return this
+}
+
+func quoteETag(etag string) string {
+	if !strings.HasSuffix(etag, "\"") {
+		etag = "\"" + etag + "\""
+	}
+	return etag
+}
+
+//Sets the Last-Modified time of the response. A GET or HEAD request with an If-Modified-Since
+//at or after this time (and no If-None-Match) is answered with 304 Not Modified.
+func (this *ResponseBuilder) SetLastModified(modified time.Time) *ResponseBuilder {
+	this.ctx.lastModified = modified.UTC().Truncate(time.Second)
+	return this
+}
+
+//Computes a strong entity tag for a representation, hashing the mime type along with the
+//marshalled entity so each negotiated representation gets its own tag
+func computeETag(mimeType string, data []byte) string {
+	etag, _ := computeETagReader(mimeType, bytes.NewReader(data))
+	return etag
+}
+
+//Computes the entity tag of a representation read from r, see computeETag
+func computeETagReader(mimeType string, r io.Reader) (string, error) {
+	h := sha1.New()
+	io.WriteString(h, mimeType+"\n")
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "\"" + hex.EncodeToString(h.Sum(nil)) + "\"", nil
+}
+
+//Sets the ETag and Last-Modified headers of a successful response, generating the ETag when
+//automatic etags are enabled, and evaluates the conditional headers of the request. Returns
+//true if the response should be 304 Not Modified.
+func (this *ResponseBuilder) notModified() bool {
+	if this.ctx.responseCode != http.StatusOK || this.ctx.problem != nil {
+		return false
+	}
+
+	etag := this.ctx.etag
+	if etag == "" && this.ctx.autoETag && this.ctx.respPacket != nil && this.ctx.stream == nil && this.ctx.events == nil {
+		if data, ok := this.entityBytes(); ok {
+			etag = computeETag(this.ctx.responseMimeType, data)
+		}
+	} else if etag == "" && this.ctx.autoETag && this.ctx.binary != nil {
+		etag, _ = this.ctx.binary.etag(this.ctx.responseMimeType)
+	}
+
+	// a compressed representation is a different entity, so its strong tag must differ
+	if etag != "" && this.ctx.respPacket != nil {
+		if encoding := this.responseEncoding(); encoding != "" {
+			etag = strings.TrimSuffix(etag, "\"") + "-" + encoding + "\""
+		}
+	}
+
+	if etag != "" {
+		this.writer().Header().Set("ETag", etag)
+	}
+	if !this.ctx.lastModified.IsZero() {
+		this.writer().Header().Set("Last-Modified", this.ctx.lastModified.Format(http.TimeFormat))
+	}
+
+	method := this.ctx.request.Method
+	if method != GET && method != HEAD {
+		return false
+	}
+
+	if inm := this.ctx.request.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && etagMatches(inm, etag)
+	}
+
+	if ims := this.ctx.request.Header.Get("If-Modified-Since"); ims != "" && !this.ctx.lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !this.ctx.lastModified.After(t)
+		}
+	}
+
+	return false
+}
+
+//Weak comparison of an If-None-Match list against the entity tag
+func etagMatches(list string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func writeConditional(req *http.Request, configure func(rb *ResponseBuilder)) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetContentType(Application_Json)
+	rb.ctx.respPacket = ioutil.NopCloser(bytes.NewBufferString(`{"Id":"1"}`))
+	configure(rb)
+	rb.WritePacket()
+	return rec
+}
+
+func TestAutoETag(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	auto := func(rb *ResponseBuilder) { rb.ctx.autoETag = true }
+
+	rec := writeConditional(req, auto)
+	etag := rec.Header().Get("ETag")
+	if etag != computeETag(Application_Json, []byte(`{"Id":"1"}`)) || rec.Body.String() != `{"Id":"1"}` {
+		t.Fatal("Expecting generated etag and full body, got:", etag, rec.Body.String())
+	}
+	if etag == computeETag(Application_Xml, []byte(`{"Id":"1"}`)) {
+		t.Error("Representations of different mime types must have different etags")
+	}
+
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	rec = writeConditional(req, auto)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+		t.Error("Expecting 304 with etag and no body, got:", rec.Code, rec.Body.String())
+	}
+
+	// gzip encoded representations carry their own tag
+	req.Header.Set("Accept-Encoding", "gzip")
+	gzipped := func(rb *ResponseBuilder) {
+		rb.ctx.autoETag = true
+		rb.ctx.encodeGzip = true
+		rb.ctx.compression = &compressionPolicy{level: gzip.DefaultCompression}
+	}
+	rec = writeConditional(req, gzipped)
+	gzipTag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || gzipTag != etag[:len(etag)-1]+`-gzip"` {
+		t.Error("Expecting full gzip response with gzip etag, got:", rec.Code, gzipTag)
+	}
+
+	req.Header.Set("If-None-Match", gzipTag)
+	rec = writeConditional(req, gzipped)
+	if rec.Code != http.StatusNotModified {
+		t.Error("Expecting 304 for matching gzip etag, got:", rec.Code)
+	}
+
+	post, _ := http.NewRequest("PUT", "/users/1", nil)
+	post.Header.Set("If-None-Match", etag)
+	if rec = writeConditional(post, auto); rec.Code == http.StatusNotModified {
+		t.Error("Only GET and HEAD may be answered with 304")
+	}
+}
+
+func TestSetETagAndLastModified(t *testing.T) {
+	modified := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	set := func(rb *ResponseBuilder) { rb.SetETag("v7").SetLastModified(modified) }
+
+	rec := writeConditional(req, set)
+	if rec.Header().Get("ETag") != `"v7"` || rec.Header().Get("Last-Modified") != "Sun, 01 Jun 2014 12:00:00 GMT" {
+		t.Error("Validators not set, got:", rec.Header().Get("ETag"), rec.Header().Get("Last-Modified"))
+	}
+
+	req.Header.Set("If-None-Match", `W/"v7"`)
+	if rec = writeConditional(req, set); rec.Code != http.StatusNotModified {
+		t.Error("Expecting weak comparison to match, got:", rec.Code)
+	}
+
+	req.Header.Del("If-None-Match")
+	req.Header.Set("If-Modified-Since", modified.Format(http.TimeFormat))
+	if rec = writeConditional(req, set); rec.Code != http.StatusNotModified {
+		t.Error("Expecting 304 when not modified since, got:", rec.Code)
+	}
+
+	req.Header.Set("If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+	if rec = writeConditional(req, set); rec.Code != http.StatusOK {
+		t.Error("Expecting 200 when modified since, got:", rec.Code)
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	req.Header.Set("If-None-Match", `"v6"`)
+	req.Header.Set("If-Modified-Since", modified.Format(http.TimeFormat))
+	if rec = writeConditional(req, set); rec.Code != http.StatusOK {
+		t.Error("Expecting 200 when the etag does not match, got:", rec.Code)
+	}
+}
@@ -0,0 +1,465 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//A CSVMarshaller writes a slice of structs, or of maps keyed by string, as a header row followed by a row
+//per element, and reads such a table back. Columns are named by the csv tag of a field, then its json tag,
+//then its name; a tag of "-" leaves the field out. Nested structs are flattened into "parent.child" columns
+//and embedded structs are promoted. Rows are written as they are encoded, so large slices are never held
+//in memory as text. Cells that a spreadsheet would run as a formula, starting with =, +, -, @, a tab or
+//a carriage return, are prefixed with a single quote unless AllowFormulas is set; numbers are left as
+//they are. Register a CSVMarshaller of your own to change the delimiter or quoting:
+//
+//	gorest.ReplaceMarshaller(gorest.Text_Csv, &gorest.CSVMarshaller{Comma: ';', QuoteAll: true})
+type CSVMarshaller struct {
+	Comma    rune // the field delimiter
+	QuoteAll bool // quote every field, not only those that need it
+	UseCRLF  bool // end rows with \r\n rather than \n
+
+	AllowFormulas bool // write cells that look like formulas as they are
+}
+
+//CSV: This makes the text/csv Marshaller
+func NewCSVMarshaller() *Marshaller {
+	return csvBuffered
+}
+
+//The text/csv StreamMarshaller, writing rows as they are encoded
+func NewCSVStreamMarshaller() StreamMarshaller {
+	return &CSVMarshaller{Comma: ','}
+}
+
+//TSV: This makes the text/tab-separated-values Marshaller
+func NewTSVMarshaller() *Marshaller {
+	return tsvBuffered
+}
+
+//The text/tab-separated-values StreamMarshaller, writing rows as they are encoded
+func NewTSVStreamMarshaller() StreamMarshaller {
+	return &CSVMarshaller{Comma: '\t'}
+}
+
+//A column of the table, found at index in the element struct
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func (this *CSVMarshaller) Encode(w io.Writer, v interface{}) error {
+	rows := reflect.Indirect(reflect.ValueOf(v))
+	if rows.IsValid() && rows.Type() == pageType {
+		rows = reflect.ValueOf(rows.Interface().(Page).Items)
+	}
+	for rows.Kind() == reflect.Ptr || rows.Kind() == reflect.Interface {
+		rows = rows.Elem()
+	}
+
+	switch rows.Kind() {
+	case reflect.Invalid:
+		return errors.New("CSV can not be made from a nil value")
+	case reflect.Slice, reflect.Array:
+	case reflect.Struct, reflect.Map:
+		// a single element is a table of one row
+		single := reflect.MakeSlice(reflect.SliceOf(rows.Type()), 1, 1)
+		single.Index(0).Set(rows)
+		rows = single
+	default:
+		return errors.New("CSV can only be made from a slice of structs or maps, not " + rows.Type().String())
+	}
+
+	elemType := derefType(rows.Type().Elem())
+	out := bufio.NewWriter(w)
+
+	switch {
+	case elemType.Kind() == reflect.Struct:
+		columns := csvColumns(elemType, "", nil)
+		names := make([]string, len(columns))
+		for i, col := range columns {
+			names[i] = col.name
+		}
+		if err := this.writeRecord(out, names); err != nil {
+			return err
+		}
+
+		record := make([]string, len(columns))
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i)
+			for j, col := range columns {
+				record[j] = formatCell(fieldByIndex(row, col.index))
+			}
+			if err := this.writeRecord(out, record); err != nil {
+				return err
+			}
+		}
+	case elemType.Kind() == reflect.Map && elemType.Key().Kind() == reflect.String:
+		// the columns are the keys of every row, in order
+		keys := make(map[string]bool)
+		for i := 0; i < rows.Len(); i++ {
+			row := reflect.Indirect(rows.Index(i))
+			if !row.IsValid() {
+				continue
+			}
+			for _, key := range row.MapKeys() {
+				keys[key.String()] = true
+			}
+		}
+		names := make([]string, 0, len(keys))
+		for key := range keys {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		if err := this.writeRecord(out, names); err != nil {
+			return err
+		}
+
+		record := make([]string, len(names))
+		for i := 0; i < rows.Len(); i++ {
+			row := reflect.Indirect(rows.Index(i))
+			for j, name := range names {
+				record[j] = ""
+				if row.IsValid() && !row.IsNil() {
+					record[j] = formatCell(row.MapIndex(reflect.ValueOf(name).Convert(elemType.Key())))
+				}
+			}
+			if err := this.writeRecord(out, record); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("CSV can only be made from a slice of structs or maps, not " + rows.Type().String())
+	}
+
+	return out.Flush()
+}
+
+func (this *CSVMarshaller) Decode(r io.Reader, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return errors.New("CSV can only be read into a slice of structs or maps")
+	}
+	rows := target.Elem()
+	elemType := rows.Type().Elem()
+	baseType := derefType(elemType)
+
+	reader := csv.NewReader(r)
+	reader.Comma = this.Comma
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+
+	var columns []*csvColumn
+	switch {
+	case baseType.Kind() == reflect.Struct:
+		byName := make(map[string]csvColumn)
+		for _, col := range csvColumns(baseType, "", nil) {
+			byName[col.name] = col
+		}
+		columns = make([]*csvColumn, len(header))
+		for i, name := range header {
+			// columns that are not fields of the struct are ignored
+			if col, found := byName[strings.TrimSpace(name)]; found {
+				columns[i] = &col
+			}
+		}
+	case baseType.Kind() == reflect.Map && baseType.Key().Kind() == reflect.String:
+	default:
+		return errors.New("CSV can only be read into a slice of structs or maps, not " + rows.Type().String())
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		elem := reflect.New(baseType).Elem()
+		if baseType.Kind() == reflect.Map {
+			elem = reflect.MakeMap(baseType)
+		}
+		for i, cell := range record {
+			var err error
+			if baseType.Kind() == reflect.Map {
+				value := reflect.New(baseType.Elem()).Elem()
+				if err = setCell(value, cell); err == nil {
+					elem.SetMapIndex(reflect.ValueOf(header[i]).Convert(baseType.Key()), value)
+				}
+			} else if columns[i] != nil {
+				err = setCell(allocFieldByIndex(elem, columns[i].index), cell)
+			}
+			if err != nil {
+				return errors.New("Invalid value for " + header[i] + " on line " + strconv.Itoa(line) + ": " + err.Error())
+			}
+		}
+
+		if elemType.Kind() == reflect.Ptr {
+			elem = elem.Addr()
+		}
+		rows.Set(reflect.Append(rows, elem))
+	}
+
+	return nil
+}
+
+//Writes a row, quoting the fields that hold the delimiter, a quote, a line break or leading space
+func (this *CSVMarshaller) writeRecord(out *bufio.Writer, record []string) error {
+	for i, field := range record {
+		if i > 0 {
+			out.WriteRune(this.Comma)
+		}
+		if !this.AllowFormulas && isFormula(field) {
+			field = "'" + field
+		}
+		if this.QuoteAll || this.needsQuotes(field) {
+			out.WriteByte('"')
+			out.WriteString(strings.Replace(field, `"`, `""`, -1))
+			out.WriteByte('"')
+		} else {
+			out.WriteString(field)
+		}
+	}
+	var err error
+	if this.UseCRLF {
+		_, err = out.WriteString("\r\n")
+	} else {
+		err = out.WriteByte('\n')
+	}
+	return err
+}
+
+func (this *CSVMarshaller) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if strings.ContainsRune(field, this.Comma) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	return field[0] == ' ' || field[0] == '\t'
+}
+
+//Whether a spreadsheet opening the cell would evaluate it
+func isFormula(field string) bool {
+	if field == "" || !strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return false
+	}
+	_, err := strconv.ParseFloat(field, 64)
+	return err != nil
+}
+
+//The columns of a struct type, prefix naming the struct it is nested in
+func csvColumns(t reflect.Type, prefix string, index []int) []csvColumn {
+	columns := make([]csvColumn, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := derefType(f.Type)
+		promoted := f.Anonymous && ft.Kind() == reflect.Struct
+		if f.PkgPath != "" && !promoted {
+			continue
+		}
+
+		name, tagged := csvFieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index), len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex = append(fieldIndex, i)
+
+		switch {
+		case promoted && !tagged && !isTextType(ft):
+			columns = append(columns, csvColumns(ft, prefix, fieldIndex)...)
+		case f.PkgPath != "":
+		case ft.Kind() == reflect.Struct && !isTextType(ft):
+			columns = append(columns, csvColumns(ft, prefix+name+".", fieldIndex)...)
+		default:
+			columns = append(columns, csvColumn{prefix + name, fieldIndex})
+		}
+	}
+	return columns
+}
+
+//The column name of a field, and whether a tag gave it
+func csvFieldName(f reflect.StructField) (string, bool) {
+	for _, key := range []string{"csv", "json"} {
+		if tag := f.Tag.Get(key); tag != "" {
+			if name := strings.Split(tag, ",")[0]; name != "" {
+				return name, true
+			}
+		}
+	}
+	return f.Name, false
+}
+
+//Types written as their text rather than flattened, such as time.Time
+func isTextType(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+//The field at index, or an invalid value when a nil pointer is in the way
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+//The field at index, allocating the nil pointers in the way
+func allocFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+//The text of a cell. Values without a text form of their own, such as slices, are written as json.
+func formatCell(v reflect.Value) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		text, _ := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text)
+	} else if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		text, _ := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	}
+
+	data, _ := json.Marshal(v.Interface())
+	return string(data)
+}
+
+//Sets v from the text of a cell, the reverse of formatCell. Empty cells leave v as it is.
+func setCell(v reflect.Value, cell string) error {
+	if cell == "" {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setCell(v.Elem(), cell)
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(cell))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(cell)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(cell, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return errors.New("cannot set " + v.Type().String())
+		}
+		v.Set(reflect.ValueOf(cell))
+	default:
+		return json.Unmarshal([]byte(cell), v.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type csvAddress struct {
+	City string `json:"city"`
+	Zip  string `csv:"postcode"`
+}
+
+type csvAudit struct {
+	Created time.Time `json:"created"`
+}
+
+type csvRow struct {
+	csvAudit
+	Name    string      `csv:"name" json:"fullName"`
+	Age     int         `json:"age"`
+	Address *csvAddress `json:"address"`
+	Tags    []string    `json:"tags"`
+	Secret  string      `json:"-"`
+	Note    string
+}
+
+var csvCreated = time.Date(2014, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func csvRows() []csvRow {
+	return []csvRow{
+		{csvAudit{csvCreated}, "Joe, Jr", 19, &csvAddress{"Austin", "78701"}, []string{"a"}, "x", `say "hi"`},
+		{csvAudit{csvCreated}, "Ann", 21, nil, nil, "y", "two\nlines"},
+	}
+}
+
+func encodeCSV(t *testing.T, m StreamMarshaller, v interface{}) string {
+	var buf bytes.Buffer
+	if err := m.Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCSVEncode(t *testing.T) {
+	expected := "created,name,age,address.city,address.postcode,tags,Note\n" +
+		"2014-05-01T10:00:00Z,\"Joe, Jr\",19,Austin,78701,\"[\"\"a\"\"]\",\"say \"\"hi\"\"\"\n" +
+		"2014-05-01T10:00:00Z,Ann,21,,,null,\"two\nlines\"\n"
+	if got := encodeCSV(t, NewCSVMarshaller(), csvRows()); got != expected {
+		t.Error("Unexpected csv:\n" + got)
+	}
+
+	expected = "created\tname\tage\taddress.city\taddress.postcode\ttags\tNote\r\n" +
+		"2014-05-01T10:00:00Z\tJoe, Jr\t19\tAustin\t78701\t\"[\"\"a\"\"]\"\t\"say \"\"hi\"\"\"\r\n"
+	tsv := &CSVMarshaller{Comma: '\t', UseCRLF: true}
+	if got := encodeCSV(t, tsv, csvRows()[:1]); got != expected {
+		t.Error("Unexpected tsv:\n" + got)
+	}
+
+	quoted := &CSVMarshaller{Comma: ';', QuoteAll: true}
+	if got := encodeCSV(t, quoted, []csvAddress{{"Austin", "78701"}}); got != "\"city\";\"postcode\"\n\"Austin\";\"78701\"\n" {
+		t.Error("Unexpected quoted csv:\n" + got)
+	}
+
+	maps := []map[string]interface{}{{"b": 2, "a": "x"}, {"c": true}}
+	if got := encodeCSV(t, NewCSVMarshaller(), maps); got != "a,b,c\nx,2,\n,,true\n" {
+		t.Error("Unexpected csv of maps:\n" + got)
+	}
+
+	if err := NewCSVMarshaller().Encode(ioutil.Discard, 42); err == nil {
+		t.Error("Expecting an error for a value that is not tabular")
+	}
+
+	formulas := []map[string]interface{}{{"a": "=SUM(A1:A9)", "b": "@cmd", "c": -1.5, "d": "-2+3"}}
+	if got := encodeCSV(t, NewCSVMarshaller(), formulas); got != "a,b,c,d\n'=SUM(A1:A9),'@cmd,-1.5,'-2+3\n" {
+		t.Error("Expecting formulas to be escaped:\n" + got)
+	}
+	if got := encodeCSV(t, &CSVMarshaller{Comma: ',', AllowFormulas: true}, formulas); got != "a,b,c,d\n=SUM(A1:A9),@cmd,-1.5,-2+3\n" {
+		t.Error("Expecting formulas to be kept with AllowFormulas:\n" + got)
+	}
+
+	page := &Page{Items: []csvAddress{{"Austin", "78701"}}}
+	if got := encodeCSV(t, NewCSVMarshaller(), page); got != "city,postcode\nAustin,78701\n" {
+		t.Error("Expecting the items of a *Page, got:\n" + got)
+	}
+	var nilPage *Page
+	if err := NewCSVMarshaller().Encode(ioutil.Discard, nilPage); err == nil {
+		t.Error("Expecting an error for a nil page")
+	}
+}
+
+func TestCSVDecode(t *testing.T) {
+	data := encodeCSV(t, NewCSVMarshaller(), csvRows())
+
+	var rows []csvRow
+	if err := NewCSVMarshaller().Decode(strings.NewReader(data), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Name != "Joe, Jr" || rows[0].Address.Zip != "78701" || rows[0].Note != `say "hi"` {
+		t.Error("Unexpected rows:", rows)
+	}
+	if !rows[0].Created.Equal(csvCreated) || len(rows[0].Tags) != 1 || rows[1].Note != "two\nlines" || rows[1].Secret != "" {
+		t.Error("Unexpected rows:", rows)
+	}
+
+	var ptrs []*csvAddress
+	if err := NewTSVMarshaller().Decode(strings.NewReader("city\tcountry\nAustin\tUS\n"), &ptrs); err != nil || len(ptrs) != 1 || ptrs[0].City != "Austin" {
+		t.Error("Expecting unknown columns to be ignored, got:", ptrs, err)
+	}
+
+	var maps []map[string]string
+	if err := NewCSVMarshaller().Decode(strings.NewReader("a,b\n1,2\n"), &maps); err != nil || maps[0]["b"] != "2" {
+		t.Error("Unexpected maps:", maps, err)
+	}
+
+	err := NewCSVMarshaller().Decode(strings.NewReader("age\n1\nold\n"), &rows)
+	if err == nil || !strings.Contains(err.Error(), "age on line 3") {
+		t.Error("Expecting the column and line of the invalid value, got:", err)
+	}
+}
+
+type CSVTestService struct {
+	RestService `root:"/csv-test/"`
+	listRows    EndPoint `method:"GET" path:"/rows" output:"[]csvRow" produces:"text/csv,application/json" filename:"rows.csv"`
+	addRows     EndPoint `method:"POST" path:"/rows" postdata:"[]csvAddress" consumes:"text/csv"`
+}
+
+var csvTestRegister sync.Once
+
+func (serv CSVTestService) ListRows() []csvRow {
+	return csvRows()
+}
+
+func (serv CSVTestService) AddRows(rows []csvAddress) {
+	if len(rows) != 2 || rows[1].City != "Boston" {
+		serv.ResponseBuilder().SetResponseCode(http.StatusBadRequest)
+	}
+}
+
+func TestCSVEndpoint(t *testing.T) {
+	csvTestRegister.Do(func() { RegisterService(new(CSVTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/csv-test/rows", nil)
+	req.Header.Set("Accept", Text_Csv)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != Text_Csv || !strings.HasPrefix(string(data), "created,name,age") {
+		t.Error("Expecting csv, got:", resp.Header.Get("Content-Type"), string(data))
+	}
+	if resp.Header.Get("Content-Disposition") != `attachment; filename=rows.csv` {
+		t.Error("Expecting an attachment, got:", resp.Header.Get("Content-Disposition"))
+	}
+
+	resp, err = http.Post(server.URL+"/csv-test/rows", Text_Csv, strings.NewReader("city,postcode\nAustin,78701\nBoston,02101\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		t.Error("Expecting the csv postdata to be decoded, got:", resp.StatusCode)
+	}
+}
@@ -0,0 +1,358 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"github.com/rmullinnix/logger"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//An Event is a single message of a text/event-stream (Server-Sent Events) response.
+type Event struct {
+	Id    string      // sent as the event id, clients resume from it with Last-Event-ID
+	Name  string      // the event type, empty for the default "message" event
+	Data  interface{} // strings are sent as is, other values are marshalled as json
+	Retry int         // reconnection time hint in milliseconds, 0 to leave unset
+}
+
+//An EventSource supplies the events of output:"events" endpoints and of LongPollEvents.
+type EventSource interface {
+	//Returns a channel delivering the events published after the event with id lastEventId,
+	//or only new events if lastEventId is empty or no longer known. The returned function
+	//cancels the subscription.
+	Subscribe(lastEventId string) (<-chan Event, func())
+}
+
+var eventSourceType = reflect.TypeOf((*EventSource)(nil)).Elem()
+
+var eventHeartbeat = 15 * time.Second
+
+//Sets how often a comment line is written to idle event streams, keeping proxies from timing
+//out the connection. The default is 15 seconds; a value <= 0 disables heartbeats.
+func SetEventHeartbeat(interval time.Duration) {
+	eventHeartbeat = interval
+}
+
+var longPollInterval = 500 * time.Millisecond
+
+//Sets how often LongPoll asks its producer for data. The default is half a second.
+func SetLongPollInterval(interval time.Duration) {
+	if interval > 0 {
+		longPollInterval = interval
+	}
+}
+
+//An EventBroker is an EventSource that fans published events out to all subscribers,
+//keeping a history so reconnecting clients receive the events they missed.
+//
+//	var feed = gorest.NewEventBroker(100)
+//
+//	type FeedService struct {
+//	    gorest.RestService `root:"/feed/"`
+//	    events  gorest.EndPoint `method:"GET" path:"/events" output:"events"`
+//	}
+//	func(serv FeedService) Events() gorest.EventSource {
+//	    return feed
+//	}
+//
+//	feed.Publish(gorest.Event{Name: "user", Data: user})
+type EventBroker struct {
+	mutex       sync.Mutex
+	history     []Event
+	historySize int
+	lastId      int64
+	subscribers map[chan Event]bool
+}
+
+//Creates an EventBroker remembering the last historySize events
+func NewEventBroker(historySize int) *EventBroker {
+	return &EventBroker{historySize: historySize, subscribers: make(map[chan Event]bool)}
+}
+
+//Buffered events per subscriber; subscribers that fall further behind are dropped and
+//resume from Last-Event-ID when they reconnect
+const eventBufferSize = 64
+
+//Publishes an event to all subscribers. Events without an id are numbered by the broker.
+func (this *EventBroker) Publish(event Event) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if event.Id == "" {
+		this.lastId++
+		event.Id = strconv.FormatInt(this.lastId, 10)
+	}
+
+	if this.historySize > 0 {
+		this.history = append(this.history, event)
+		if len(this.history) > this.historySize {
+			this.history = this.history[len(this.history)-this.historySize:]
+		}
+	}
+
+	for ch := range this.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(this.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (this *EventBroker) Subscribe(lastEventId string) (<-chan Event, func()) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	missed := make([]Event, 0)
+	if lastEventId != "" {
+		for i := range this.history {
+			if this.history[i].Id == lastEventId {
+				missed = append(missed, this.history[i+1:]...)
+				break
+			}
+		}
+	}
+
+	ch := make(chan Event, len(missed)+eventBufferSize)
+	for _, event := range missed {
+		ch <- event
+	}
+	this.subscribers[ch] = true
+
+	cancel := func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if this.subscribers[ch] {
+			delete(this.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+//Formats the event in the text/event-stream wire format, data other than text is written as json
+//with the options of the service
+func formatEvent(event Event, options JSONOptions) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if event.Id != "" {
+		buf.WriteString("id: " + eventField(event.Id) + "\n")
+	}
+	if event.Name != "" {
+		buf.WriteString("event: " + eventField(event.Name) + "\n")
+	}
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.Itoa(event.Retry) + "\n")
+	}
+
+	var data string
+	switch v := event.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		options.Pretty = false
+		j, err := jsonEntity{v, options}.marshal()
+		if err != nil {
+			return nil, err
+		}
+		data = string(j)
+	}
+
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+//Line breaks would end the field early
+func eventField(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+//Writes events from the EventSource as they are published, until the client goes away
+func (this *ResponseBuilder) writeEvents() {
+	events, cancel := this.ctx.events.Subscribe(this.ctx.request.Header.Get("Last-Event-ID"))
+	defer cancel()
+
+	header := this.writer().Header()
+	header.Set("Content-Type", Text_EventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	this.writer().WriteHeader(this.ctx.responseCode)
+
+	flusher, _ := this.writer().(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	var heartbeat <-chan time.Time
+	if eventHeartbeat > 0 {
+		ticker := time.NewTicker(eventHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	done := this.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := formatEvent(event, this.ctx.jsonOptions)
+			if err != nil {
+				logger.Error.Println("[gen] could not marshal event: " + err.Error())
+				continue
+			}
+			if _, err = this.writer().Write(data); err != nil {
+				return
+			}
+			flush()
+		case <-heartbeat:
+			if _, err := this.writer().Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flush()
+		}
+	}
+}
+
+//Holds the request until producer has data or delay seconds pass. The producer is called with the
+//Last-Event-ID header of the request, "" if the client sent none, every poll interval (see
+//SetLongPollInterval) and returns nil while there is nothing new. The value it returns becomes the
+//response entity, marshalled with the negotiated mime type. If no data arrives in time the response
+//is 204 No Content. Use from endpoints without an output:
+//
+//	func(serv FeedService) Poll() {
+//	    serv.ResponseBuilder().LongPoll(30, func(lastEventId interface{}) interface{} {
+//	        return messagesAfter(lastEventId.(string))
+//	    })
+//	}
+func (this *ResponseBuilder) LongPoll(delay int, producer func(interface{}) interface{}) *ResponseBuilder {
+	lastEventId := this.ctx.request.Header.Get("Last-Event-ID")
+
+	timeout := time.NewTimer(time.Duration(delay) * time.Second)
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(longPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if producer != nil {
+			if entity := producer(lastEventId); entity != nil {
+				return this.setPolledEntity(entity, "")
+			}
+		}
+
+		select {
+		case <-this.Done():
+			return this
+		case <-timeout.C:
+			this.SetResponseCode(http.StatusNoContent)
+			return this
+		case <-ticker.C:
+		}
+	}
+}
+
+//Holds the request until the EventSource publishes an event or delay seconds pass. The data of
+//the event, passed through producer if it is not nil, becomes the response entity, marshalled
+//with the negotiated mime type; the event id is returned in the Last-Event-ID header so the
+//client can resume from it on its next poll. If no event arrives in time the response is
+//204 No Content. Use from endpoints without an output:
+//
+//	func(serv FeedService) Poll() {
+//	    serv.ResponseBuilder().LongPollEvents(30, feed, nil)
+//	}
+func (this *ResponseBuilder) LongPollEvents(delay int, source EventSource, producer func(interface{}) interface{}) *ResponseBuilder {
+	events, cancel := source.Subscribe(this.ctx.request.Header.Get("Last-Event-ID"))
+	defer cancel()
+
+	timeout := time.NewTimer(time.Duration(delay) * time.Second)
+	defer timeout.Stop()
+
+	select {
+	case <-this.Done():
+		return this
+	case <-timeout.C:
+		this.SetResponseCode(http.StatusNoContent)
+		return this
+	case event, ok := <-events:
+		if !ok {
+			this.SetResponseCode(http.StatusNoContent)
+			return this
+		}
+
+		entity := event.Data
+		if producer != nil {
+			entity = producer(entity)
+		}
+		return this.setPolledEntity(entity, event.Id)
+	}
+}
+
+//Makes the data found by a long poll the response entity, marshalled with the negotiated mime type
+func (this *ResponseBuilder) setPolledEntity(entity interface{}, eventId string) *ResponseBuilder {
+	mimeType := this.ctx.produceMime
+	if mimeType == "" {
+		mimeType = Application_Json
+	}
+
+	options := this.ctx.jsonOptions
+	options.Pretty = options.Pretty || prettyRequested(this.ctx.request)
+	data, err := interfaceToBytes(options.entity(entity, mimeType), mimeType)
+	if err != nil {
+		this.SetProblem(NewProblem(http.StatusInternalServerError, "Internal server error. Could not Marshal/UnMarshal data: " + err.Error()))
+		return this
+	}
+
+	if eventId != "" {
+		this.SetHeader("Last-Event-ID", eventId)
+	}
+	this.SetContentType(mimeType)
+	this.ctx.respPacket = data
+	this.SetResponseCode(http.StatusOK)
+	return this
+}
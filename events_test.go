@@ -0,0 +1,165 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEvent(t *testing.T) {
+	data, _ := formatEvent(Event{Id: "7", Name: "user", Data: "line one\nline two", Retry: 3000}, JSONOptions{})
+	expected := "id: 7\nevent: user\nretry: 3000\ndata: line one\ndata: line two\n\n"
+	if string(data) != expected {
+		t.Error("Expecting:", expected, "got:", string(data))
+	}
+
+	data, _ = formatEvent(Event{Data: User{Id: "1"}}, JSONOptions{})
+	expected = `data: {"Id":"1","FirstName":"","LastName":"","Age":0,"Weight":0}` + "\n\n"
+	if string(data) != expected {
+		t.Error("Expecting:", expected, "got:", string(data))
+	}
+
+	data, _ = formatEvent(Event{Data: User{Id: "1"}}, JSONOptions{Naming: "camelCase", Pretty: true})
+	expected = `data: {"id":"1","firstName":"","lastName":"","age":0,"weight":0}` + "\n\n"
+	if string(data) != expected {
+		t.Error("Expecting the json options of the service, got:", string(data))
+	}
+}
+
+func TestEventBrokerResume(t *testing.T) {
+	broker := NewEventBroker(2)
+	broker.Publish(Event{Data: "a"})
+	broker.Publish(Event{Data: "b"})
+	broker.Publish(Event{Data: "c"})
+
+	events, cancel := broker.Subscribe("2")
+	if e := <-events; e.Id != "3" || e.Data != "c" {
+		t.Error("Expecting missed event 3, got:", e)
+	}
+
+	broker.Publish(Event{Id: "x", Data: "d"})
+	if e := <-events; e.Id != "x" {
+		t.Error("Expecting published event x, got:", e)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("Expecting subscription to be closed after cancel")
+	}
+	cancel()
+}
+
+func newEventTestBuilder(req *http.Request) (*ResponseBuilder, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	return rb, rec
+}
+
+func TestWriteEvents(t *testing.T) {
+	broker := NewEventBroker(10)
+	broker.Publish(Event{Data: "old"})
+	broker.Publish(Event{Name: "greeting", Data: "hello"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "/feed/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	rb, rec := newEventTestBuilder(req.WithContext(ctx))
+	rb.ctx.events = broker
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	rb.WritePacket()
+
+	if rec.Header().Get("Content-Type") != Text_EventStream {
+		t.Error("Expecting event stream content type, got:", rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.String() != "id: 2\nevent: greeting\ndata: hello\n\n" {
+		t.Error("Event stream gave:", rec.Body.String())
+	}
+}
+
+func TestLongPollEvents(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	broker := NewEventBroker(10)
+
+	req, _ := http.NewRequest("GET", "/feed/poll", nil)
+	rb, rec := newEventTestBuilder(req)
+	rb.ctx.produceMime = Application_Json
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		broker.Publish(Event{Data: 41})
+	}()
+	rb.LongPollEvents(5, broker, func(v interface{}) interface{} { return v.(int) + 1 }).WritePacket()
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "42" || rec.Header().Get("Last-Event-ID") != "1" {
+		t.Error("Long poll gave:", rec.Code, rec.Body.String(), rec.Header().Get("Last-Event-ID"))
+	}
+
+	rb, rec = newEventTestBuilder(req)
+	rb.LongPollEvents(0, broker, nil).WritePacket()
+	if rec.Code != http.StatusNoContent || strings.TrimSpace(rec.Body.String()) != "" {
+		t.Error("Expecting 204 when no event arrives, got:", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	SetLongPollInterval(5 * time.Millisecond)
+	defer SetLongPollInterval(500 * time.Millisecond)
+
+	req, _ := http.NewRequest("GET", "/feed/poll", nil)
+	req.Header.Set("Last-Event-ID", "7")
+	rb, rec := newEventTestBuilder(req)
+	rb.ctx.produceMime = Application_Json
+
+	calls := 0
+	rb.LongPoll(5, func(lastEventId interface{}) interface{} {
+		if calls++; calls < 3 {
+			return nil
+		}
+		return map[string]interface{}{"after": lastEventId}
+	}).WritePacket()
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"after":"7"}` || calls != 3 {
+		t.Error("Long poll gave:", rec.Code, rec.Body.String(), "after", calls, "calls")
+	}
+
+	rb, rec = newEventTestBuilder(req)
+	rb.LongPoll(0, func(interface{}) interface{} { return nil }).WritePacket()
+	if rec.Code != http.StatusNoContent || strings.TrimSpace(rec.Body.String()) != "" {
+		t.Error("Expecting 204 when the producer has no data, got:", rec.Code, rec.Body.String())
+	}
+}
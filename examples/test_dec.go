@@ -33,15 +33,14 @@ type ReferenceService struct {
 	getTest      gorest.EndPoint `method:"GET"  path:"/string/{name:string}/{test:string}/multiple" output:"string"`
 	getString    gorest.EndPoint `method:"GET"  path:"/string?{name:string}" output:"string"`
 	getArray     gorest.EndPoint `method:"GET"  path:"/array?{name:string}" output:"States"`
+	getStates    gorest.EndPoint `method:"GET"  path:"/states" output:"[]State" paginate:"offset,limit=2,max=10"
+			    sw.summary:"Page through the states, following the Link header"
+			    sw.response:"{200:OK:output},{400:Bad Request}"`
 }
 
 type StatesHypermedia struct{
 	hypermedia.Entity	`class:"States" href:"/galaga/dectest/states"`
 	newstate	hypermedia.Action	`class:"State" method:"POST" href:"/galaga/dectest/state"`
-	first		hypermedia.Link	`class:"State" href:"/contra/secuirty/states?page=first"`
-	last		hypermedia.Link	`class:"State" href:"/contra/secuirty/states?page=last"`
-	next		hypermedia.Link	`class:"State" href:"/contra/secuirty/states?page={page}+1"`
-	prev		hypermedia.Link	`class:"State" href:"/contra/secuirty/states?page={page}-1"`
 	Users		hypermedia.Link	`class:"State" href:"/contra/secuirty/roles"`
 	Roles		hypermedia.Link	`class:"Role" href:"/contra/secuirty/users"`
 }
@@ -107,3 +106,19 @@ func (serv ReferenceService) GetArray(name string) States {
 	states.Count = 4
 	return states
 }
+
+// the first, prev, next and last pages are sent in the Link header
+func (serv ReferenceService) GetStates(page gorest.PageRequest) gorest.Page {
+	states := serv.GetArray("").State
+
+	start := page.Offset
+	if start > len(states) {
+		start = len(states)
+	}
+	end := start + page.Limit
+	if end > len(states) {
+		end = len(states)
+	}
+
+	return gorest.Page{Items: states[start:end], Total: len(states)}
+}
@@ -0,0 +1,397 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//The field paths selected by a ?fields= query, e.g. name,address.city. A nil subtree selects
+//the whole field.
+type fieldTree map[string]fieldTree
+
+func parseFieldTree(fields string) fieldTree {
+	tree := make(fieldTree)
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		node := tree
+		parts := strings.Split(path, ".")
+		for i, name := range parts {
+			sub, found := node[name]
+			if i == len(parts)-1 {
+				node[name] = nil
+				break
+			}
+			if found && sub == nil {
+				break // the whole field is already selected
+			}
+			if !found {
+				sub = make(fieldTree)
+				node[name] = sub
+			}
+			node = sub
+		}
+	}
+	return tree
+}
+
+//How the values of a type are trimmed to the selected fields. Structs are rebuilt with
+//reflect.StructOf, keeping the tags of the selected fields so the marshallers name them as before.
+type fieldFilter struct {
+	typ	reflect.Type // the type of the trimmed values
+	elem	*fieldFilter // of pointers, slices, arrays and maps
+	fields	[]fieldSource // of structs, in the order of the trimmed type
+	tree	fieldTree // of interfaces, applied to the dynamic value
+	tagKeys	[]string // the struct tags naming the fields, see fieldTagKeys
+	strategy	string // the json naming strategy of the service, for the json marshaller
+	root	bool
+}
+
+type fieldSource struct {
+	index	[]int // in the original struct, nil for an added XMLName
+	filter	*fieldFilter
+}
+
+type namedField struct {
+	name	string
+	field	reflect.StructField
+	tagged	bool // named by its tag
+}
+
+var jsonTagKeys = []string{"json"}
+
+//The struct tags the marshaller names fields by, the first one a field has counting: msgpack and csv
+//fall back to the json tags, as does yaml, which is written through json
+func fieldTagKeys(m StreamMarshaller) []string {
+	switch m.(type) {
+	case xmlMarshaller:
+		return []string{"xml"}
+	case msgpackMarshaller:
+		return []string{"msgpack", "json"}
+	case *CSVMarshaller:
+		return []string{"csv", "json"}
+	}
+	return jsonTagKeys
+}
+
+//The tag of a struct field among the tag keys
+func fieldTag(f reflect.StructField, tagKeys []string) string {
+	for _, key := range tagKeys {
+		if tag := f.Tag.Get(key); tag != "" {
+			return tag
+		}
+	}
+	return ""
+}
+
+//The name a marshaller gives a struct field, "" if it is not marshalled
+func marshalledName(f reflect.StructField, tagKeys []string) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := fieldTag(f, tagKeys)
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+//The marshalled fields of a struct, with the fields of embedded structs promoted
+func marshalledFields(t reflect.Type, tagKeys []string, index []int) []namedField {
+	fields := make([]namedField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		f.Index = append(append([]int{}, index...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && strings.Split(fieldTag(f, tagKeys), ",")[0] == "" {
+			fields = append(fields, marshalledFields(ft, tagKeys, f.Index)...)
+			continue
+		}
+
+		if f.Type == xmlNameType {
+			continue
+		}
+		if name := marshalledName(f, tagKeys); name != "" {
+			fields = append(fields, namedField{name, f, strings.Split(fieldTag(f, tagKeys), ",")[0] != ""})
+		}
+	}
+	return fields
+}
+
+//Keeps the field a marshaller writes under each name, as encoding/json picks it: the least nested,
+//then the tagged one. Names given by several fields equally are not written at all.
+func dominantFields(fields []namedField) []namedField {
+	byName := make(map[string][]int, len(fields))
+	for i, f := range fields {
+		byName[f.name] = append(byName[f.name], i)
+	}
+
+	dominant := make([]namedField, 0, len(fields))
+	for i, f := range fields {
+		depth := len(f.field.Index)
+		isDominant := true
+		for _, j := range byName[f.name] {
+			rival := fields[j]
+			if j != i && (len(rival.field.Index) < depth || len(rival.field.Index) == depth && (rival.tagged || !f.tagged)) {
+				isDominant = false
+				break
+			}
+		}
+		if isDominant {
+			dominant = append(dominant, f)
+		}
+	}
+	return dominant
+}
+
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
+func newFieldFilter(t reflect.Type, tree fieldTree, tagKeys []string, strategy string, path string, root bool) (*fieldFilter, error) {
+	if tree == nil {
+		return &fieldFilter{typ: t}, nil
+	}
+
+	filter := &fieldFilter{tagKeys: tagKeys, strategy: strategy, root: root}
+	var err		error
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if filter.elem, err = newFieldFilter(t.Elem(), tree, tagKeys, strategy, path, root); err == nil {
+			filter.typ = reflect.PtrTo(filter.elem.typ)
+		}
+	case reflect.Slice, reflect.Array:
+		if filter.elem, err = newFieldFilter(t.Elem(), tree, tagKeys, strategy, path, root); err == nil {
+			filter.typ = reflect.SliceOf(filter.elem.typ)
+		}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, errors.New("The fields of " + t.String() + " can not be selected")
+		}
+		if filter.elem, err = newFieldFilter(t.Elem(), tree, tagKeys, strategy, path, root); err == nil {
+			filter.typ = reflect.MapOf(t.Key(), filter.elem.typ)
+		}
+	case reflect.Interface:
+		filter.typ = t
+		filter.tree = tree
+	case reflect.Struct:
+		err = filter.selectFields(t, tree, path)
+	default:
+		return nil, errors.New("Unknown field: " + path + " has no fields")
+	}
+
+	return filter, err
+}
+
+func (this *fieldFilter) selectFields(t reflect.Type, tree fieldTree, path string) error {
+	fields := marshalledFields(t, this.tagKeys, nil)
+	if this.strategy != "" {
+		for i := range fields {
+			fields[i].name = JSONFieldName(fields[i].field, this.strategy)
+		}
+	}
+	fields = dominantFields(fields)
+	byName := make(map[string]reflect.StructField, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f.field
+	}
+
+	for name := range tree {
+		if _, found := byName[name]; !found {
+			valid := make([]string, 0, len(fields))
+			for _, f := range fields {
+				valid = append(valid, f.name)
+			}
+			sort.Strings(valid)
+
+			of := ""
+			if path != "" {
+				of = " of " + path
+			}
+			return errors.New("Unknown field: " + strings.TrimPrefix(path + "." + name, ".") + ", the valid fields" + of + " are: " + strings.Join(valid, ", "))
+		}
+	}
+
+	structFields := make([]reflect.StructField, 0, len(tree) + 1)
+
+	//Trimmed structs are unnamed, the xml marshaller needs the name of the original type at the root
+	if xmlField, found := t.FieldByName("XMLName"); found && xmlField.Type == xmlNameType {
+		structFields = append(structFields, reflect.StructField{Name: "XMLName", Type: xmlNameType, Tag: xmlField.Tag})
+		this.fields = append(this.fields, fieldSource{index: xmlField.Index, filter: &fieldFilter{typ: xmlNameType}})
+	} else if this.root && this.tagKeys[0] == "xml" {
+		structFields = append(structFields, reflect.StructField{Name: "XMLName", Type: xmlNameType, Tag: reflect.StructTag(`xml:"` + t.Name() + `"`)})
+		this.fields = append(this.fields, fieldSource{})
+	}
+
+	//Fields named by their Go name keep it, tagged fields promoted from embedded structs are renamed
+	//if another field has their Go name
+	goNames := map[string]bool{"XMLName": true}
+	for _, f := range fields {
+		if _, selected := tree[f.name]; selected && !f.tagged {
+			goNames[f.field.Name] = true
+		}
+	}
+
+	for _, f := range fields {
+		sub, selected := tree[f.name]
+		if !selected {
+			continue
+		}
+
+		goName := f.field.Name
+		if f.tagged {
+			for n := 2; goNames[goName]; n++ {
+				goName = f.field.Name + strconv.Itoa(n)
+			}
+			goNames[goName] = true
+		}
+
+		filter, err := newFieldFilter(f.field.Type, sub, this.tagKeys, this.strategy, strings.TrimPrefix(path + "." + f.name, "."), false)
+		if err != nil {
+			return err
+		}
+		structFields = append(structFields, reflect.StructField{Name: goName, Type: filter.typ, Tag: f.field.Tag})
+		this.fields = append(this.fields, fieldSource{index: f.field.Index, filter: filter})
+	}
+
+	this.typ = reflect.StructOf(structFields)
+	return nil
+}
+
+//Copies the selected fields of v into a value of the trimmed type
+func (this *fieldFilter) apply(v reflect.Value) (reflect.Value, error) {
+	if this.typ == v.Type() && this.elem == nil && this.fields == nil && this.tree == nil {
+		return v, nil
+	}
+
+	out := reflect.New(this.typ).Elem()
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			elem, err := this.elem.apply(v.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.Set(reflect.New(this.elem.typ))
+			out.Elem().Set(elem)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return out, nil
+		}
+		out.Set(reflect.MakeSlice(this.typ, v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			elem, err := this.elem.apply(v.Index(i))
+			if err != nil {
+				return out, err
+			}
+			out.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return out, nil
+		}
+		out.Set(reflect.MakeMapWithSize(this.typ, v.Len()))
+		for _, key := range v.MapKeys() {
+			elem, err := this.elem.apply(v.MapIndex(key))
+			if err != nil {
+				return out, err
+			}
+			out.SetMapIndex(key, elem)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			filter, err := newFieldFilter(v.Elem().Type(), this.tree, this.tagKeys, this.strategy, "", this.root)
+			if err != nil {
+				return out, err
+			}
+			elem, err := filter.apply(v.Elem())
+			if err != nil {
+				return out, err
+			}
+			out.Set(elem)
+		}
+	case reflect.Struct:
+		for i, source := range this.fields {
+			if source.filter == nil {
+				continue // an added XMLName
+			}
+			field, err := v.FieldByIndexErr(source.index)
+			if err != nil {
+				continue // behind a nil embedded pointer
+			}
+			value, err := source.filter.apply(field)
+			if err != nil {
+				return out, err
+			}
+			out.Field(i).Set(value)
+		}
+	}
+	return out, nil
+}
+
+//Trims the output of a method to the fields selected by the ?fields= query, named as the
+//marshaller of the mime type names them. Json fields are named with the naming strategy of the service.
+func selectFields(v interface{}, fields string, mimeType string, strategy string) (interface{}, error) {
+	tree := parseFieldTree(fields)
+	if v == nil || len(tree) == 0 {
+		return v, nil
+	}
+
+	m := marshallerFor(mimeType)
+	if _, isJSON := m.(jsonMarshaller); !isJSON {
+		strategy = ""
+	}
+
+	value := reflect.ValueOf(v)
+	filter, err := newFieldFilter(value.Type(), tree, fieldTagKeys(m), strategy, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered, err := filter.apply(value)
+	if err != nil {
+		return nil, err
+	}
+	return filtered.Interface(), nil
+}
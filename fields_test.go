@@ -0,0 +1,175 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+type fieldsAddress struct {
+	Street string `json:"street" xml:"street"`
+	City   string `json:"city" xml:"town"`
+}
+
+type fieldsAudit struct {
+	Created string `json:"created"`
+}
+
+type fieldsPerson struct {
+	fieldsAudit
+	Name    string         `json:"name" xml:"name"`
+	Secret  string         `json:"-"`
+	Age     int            `json:"age,omitempty" xml:"age"`
+	Address *fieldsAddress `json:"address" xml:"address"`
+	Tags    []string       `json:"tags"`
+}
+
+func marshalSelected(t *testing.T, v interface{}, fields string, mimeType string) string {
+	selected, err := selectFields(v, fields, mimeType, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data	[]byte
+	if mimeType == Application_Xml {
+		data, err = xml.Marshal(selected)
+	} else {
+		data, err = json.Marshal(selected)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSelectFields(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	RegisterMarshaller("xml", NewXMLMarshaller())
+	person := fieldsPerson{fieldsAudit{"today"}, "Ann", "x", 30, &fieldsAddress{"Main St", "Springfield"}, []string{"a"}}
+
+	cases := map[string]string{
+		"name":                      `{"name":"Ann"}`,
+		"name,address.city":         `{"name":"Ann","address":{"city":"Springfield"}}`,
+		"address.city,address":      `{"address":{"street":"Main St","city":"Springfield"}}`,
+		"created, tags":             `{"created":"today","tags":["a"]}`,
+		" ,age":                     `{"age":30}`,
+	}
+	for fields, expected := range cases {
+		if data := marshalSelected(t, person, fields, Application_Json); data != expected {
+			t.Error("Fields:", fields, "expecting:", expected, "got:", data)
+		}
+	}
+
+	if data := marshalSelected(t, []fieldsPerson{person, {Name: "Bob"}}, "name,address.city", Application_Json); data != `[{"name":"Ann","address":{"city":"Springfield"}},{"name":"Bob","address":null}]` {
+		t.Error("Unexpected slice:", data)
+	}
+
+	if data := marshalSelected(t, map[string]*fieldsPerson{"a": &person}, "name", Application_Json); data != `{"a":{"name":"Ann"}}` {
+		t.Error("Unexpected map:", data)
+	}
+
+	if data := marshalSelected(t, person, "name,address.town", Application_Xml); data != `<fieldsPerson><name>Ann</name><address><town>Springfield</town></address></fieldsPerson>` {
+		t.Error("Unexpected xml:", data)
+	}
+
+	var items interface{} = []interface{}{person}
+	if data := marshalSelected(t, items, "age", Application_Json); data != `[{"age":30}]` {
+		t.Error("Unexpected interface items:", data)
+	}
+}
+
+type fieldsRecord struct {
+	fieldsAudit
+	Created string `json:"created_at"`
+	Name    string `json:"name" msgpack:"n" csv:"full_name"`
+	Note    string `json:"created"`
+	Total   int
+}
+
+func TestSelectFieldsNaming(t *testing.T) {
+	RegisterMarshaller(Application_Json, NewJSONMarshaller())
+	RegisterMarshaller(Application_MsgPack, NewMsgPackMarshaller())
+	RegisterMarshaller(Text_Csv, NewCSVMarshaller())
+	RegisterMarshaller(Application_Yaml, NewYAMLMarshaller())
+	record := fieldsRecord{fieldsAudit{"audit"}, "today", "Ann", "note", 2}
+
+	for mimeType, name := range map[string]string{Application_MsgPack: "n", Text_Csv: "full_name", Application_Yaml: "name"} {
+		if _, err := selectFields(record, name, mimeType, ""); err != nil {
+			t.Error("Expecting", name, "to be a field of", mimeType, "got:", err)
+		}
+		if name != "name" {
+			if _, err := selectFields(record, "name", mimeType, ""); err == nil {
+				t.Error("Expecting the json name to be unknown to", mimeType)
+			}
+		}
+	}
+	if _, err := selectFields(record, "Total", Application_Yaml, "snake_case"); err != nil {
+		t.Error("Expecting the json naming strategy to apply to the json marshaller only, got:", err)
+	}
+
+	// the outer created hides the embedded one
+	if data := marshalSelected(t, record, "created,created_at", Application_Json); data != `{"created_at":"today","created":"note"}` {
+		t.Error("Expecting the least nested field to be selected, got:", data)
+	}
+
+	// fields sharing a Go name are told apart by their names
+	stamped := struct {
+		fieldsAudit
+		Created string `json:"created_at"`
+	}{fieldsAudit{"audit"}, "today"}
+	if data := marshalSelected(t, stamped, "created,created_at", Application_Json); data != `{"created":"audit","created_at":"today"}` {
+		t.Error("Expecting both fields named Created, got:", data)
+	}
+}
+
+func TestSelectUnknownFields(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	RegisterMarshaller("xml", NewXMLMarshaller())
+	person := fieldsPerson{Name: "Ann"}
+
+	_, err := selectFields(person, "name,Secret", Application_Json, "")
+	if err == nil || err.Error() != "Unknown field: Secret, the valid fields are: address, age, created, name, tags" {
+		t.Error("Expecting the valid fields to be listed, got:", err)
+	}
+
+	_, err = selectFields([]fieldsPerson{person}, "address.zip", Application_Json, "")
+	if err == nil || !strings.Contains(err.Error(), "the valid fields of address are: city, street") {
+		t.Error("Expecting the valid nested fields to be listed, got:", err)
+	}
+
+	if _, err = selectFields(person, "name.first", Application_Json, ""); err == nil {
+		t.Error("Expecting an error selecting fields of a string")
+	}
+
+	// fields are named as the negotiated marshaller names them
+	if _, err = selectFields(person, "address.city", Application_Xml, ""); err == nil {
+		t.Error("Expecting json field names to be unknown to xml")
+	}
+}
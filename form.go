@@ -0,0 +1,97 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//Memory used to hold a multipart form before file parts are spooled to disk
+const maxFormMemory = 32 << 20
+
+//Reads the fields of an urlencoded or multipart form post. Repeated fields bind to slice arguments,
+//each value an item.
+//On failure the http status code that should be returned to the client is given along with the error.
+func readFormArgs(r *http.Request) (url.Values, int, error) {
+	data, code, err := readRequestBody(r)
+	if err != nil {
+		return nil, code, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	var values url.Values
+	if mediaType == Multipart_FormData {
+		form, err := multipart.NewReader(bytes.NewReader(data), params["boundary"]).ReadForm(maxFormMemory)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		defer form.RemoveAll()
+		values = form.Value
+	} else if values, err = url.ParseQuery(string(data)); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return values, http.StatusOK, nil
+}
+
+//The values of a form parameter. Omitted ones take the declared default, a comma separated list
+//for slices as in a query.
+func formParamValues(par Param, values url.Values) ([]string, error) {
+	if vals := values[par.Name]; len(vals) > 0 && vals[0] != "" {
+		return vals, nil
+	}
+
+	dat, err := paramValue(par, nil)
+	if err != nil || dat == "" {
+		return nil, err
+	}
+	return strings.Split(dat, ","), nil
+}
+
+//Gets the value of a query or form parameter from the request arguments. Omitted (or empty)
+//parameters take their declared default; an error is returned if a required one is missing.
+func paramValue(par Param, values map[string]string) (string, error) {
+	if str, found := values[par.Name]; found && str != "" {
+		return str, nil
+	}
+
+	if par.Required {
+		return "", errors.New("Missing required parameter: " + par.Name)
+	}
+
+	return par.Default, nil
+}
@@ -0,0 +1,135 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFormParams(t *testing.T) {
+	params := parseFormParams("{email:string!}, {age:int=18},{tags:[]string}", "/users/signup")
+	if len(params) != 3 {
+		t.Fatal("Expecting 3 form params, got:", len(params))
+	}
+
+	if params[0].Name != "email" || params[0].TypeName != "string" || !params[0].Required || params[0].Default != "" {
+		t.Error("Required param parsed incorrectly:", params[0])
+	}
+	if params[1].Name != "age" || params[1].TypeName != "int" || params[1].Required || params[1].Default != "18" {
+		t.Error("Default param parsed incorrectly:", params[1])
+	}
+	if params[2].Name != "tags" || params[2].TypeName != "[]string" || params[2].positionInPath != 2 {
+		t.Error("Slice param parsed incorrectly:", params[2])
+	}
+}
+
+func TestParamValue(t *testing.T) {
+	values := map[string]string{"email": "a@b.com", "blank": ""}
+
+	if v, err := paramValue(Param{Name: "email", Required: true}, values); err != nil || v != "a@b.com" {
+		t.Error("Expecting email value, got:", v, err)
+	}
+	if _, err := paramValue(Param{Name: "blank", Required: true}, values); err == nil {
+		t.Error("Expecting error for empty required param")
+	}
+	if v, err := paramValue(Param{Name: "age", Default: "18"}, values); err != nil || v != "18" {
+		t.Error("Expecting default value, got:", v, err)
+	}
+	if v, err := paramValue(Param{Name: "age"}, values); err != nil || v != "" {
+		t.Error("Expecting empty value for optional param, got:", v, err)
+	}
+}
+
+func TestReadFormArgs(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/users/signup", strings.NewReader("email=a%40b.com&tags=x&tags=y"))
+	req.Header.Set("Content-Type", Application_Form_UrlEncoded+"; charset=utf-8")
+
+	args, _, err := readFormArgs(req)
+	if err != nil {
+		t.Fatal("Unexpected error reading urlencoded form:", err)
+	}
+	if args.Get("email") != "a@b.com" || len(args["tags"]) != 2 || args["tags"][1] != "y" {
+		t.Error("Urlencoded form read incorrectly:", args)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("email", "c@d.com")
+	mw.WriteField("age", "30")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write([]byte("not really a png"))
+	mw.Close()
+
+	req, _ = http.NewRequest("POST", "/users/signup", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	args, _, err = readFormArgs(req)
+	if err != nil {
+		t.Fatal("Unexpected error reading multipart form:", err)
+	}
+	if args.Get("email") != "c@d.com" || args.Get("age") != "30" {
+		t.Error("Multipart form read incorrectly:", args)
+	}
+	if _, found := args["avatar"]; found {
+		t.Error("File parts should not be bound to form params")
+	}
+
+	req, _ = http.NewRequest("POST", "/users/signup", strings.NewReader("--x--"))
+	req.Header.Set("Content-Type", Multipart_FormData)
+	if _, code, err := readFormArgs(req); err == nil || code != http.StatusBadRequest {
+		t.Error("Expecting bad request for multipart body without boundary, got:", code, err)
+	}
+}
+
+func TestFormSliceArgs(t *testing.T) {
+	values, _ := url.ParseQuery(`tags=say+%22hi%22&tags=a%2Cb`)
+	vals, err := formParamValues(Param{Name: "tags"}, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, valid := makeSliceArg(vals, reflect.TypeOf([]string{}), Application_Json)
+	if tags, _ := v.Interface().([]string); !valid || len(tags) != 2 || tags[0] != `say "hi"` || tags[1] != "a,b" {
+		t.Error("Expecting each form value as an item, got:", v, valid)
+	}
+
+	if vals, _ = formParamValues(Param{Name: "ids", Default: "1,2"}, values); len(vals) != 2 {
+		t.Error("Expecting the default to be split into items, got:", vals)
+	}
+	v, valid = makeArg("1,2", reflect.TypeOf([]int{}), Application_Json)
+	if ids, _ := v.Interface().([]int); !valid || len(ids) != 2 || ids[1] != 2 {
+		t.Error("Expecting a list of ints, got:", v, valid)
+	}
+	if _, valid = makeArg("1,x", reflect.TypeOf([]int{}), Application_Json); valid {
+		t.Error("Expecting an invalid item to fail")
+	}
+}
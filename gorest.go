@@ -58,6 +58,7 @@
 package gorest
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/base64"
 	"github.com/rmullinnix/logger"
@@ -81,6 +82,7 @@ const (
 	HEAD    = "HEAD"
 	OPTIONS = "OPTIONS"
 	PATCH   = "PATCH"
+	WS      = "WS" // WebSocket upgrade of a GET request
 )
 
 type EndPointStruct struct {
@@ -93,14 +95,19 @@ type EndPointStruct struct {
 	nonParamPathPart     map[int]string
 	Params               []Param //path parameter name and position
 	QueryParams          []Param
+	FormParams           []Param // urlencoded or multipart form fields bound to arguments after the query parameters
 	signitureLen         int
 	paramLen             int
 	OutputType           string
 	OutputTypeIsArray    bool
 	OutputTypeIsMap      bool
+	OutputTypeIsStream   bool // output:"chan T", items are streamed from a channel or Iterator
+	OutputTypeIsEvents   bool // output:"events", server-sent events from an EventSource
+	OutputTypeIsBinary   bool // output:"binary", a []byte or io.ReadSeeker served with byte ranges
 	PostdataType         string
-	postdataTypeIsArray  bool
-	postdataTypeIsMap    bool
+	PostdataIsPatch      bool // postdata is a gorest.Patch (merge-patch or json-patch document)
+	PostdataTypeIsArray  bool
+	PostdataTypeIsMap    bool
 	isVariableLength     bool
 	parentTypeName       string
 	MethodNumberInParent int
@@ -108,9 +115,25 @@ type EndPointStruct struct {
 	ProducesMime 	     []string // overrides the produces mime type
 	ConsumesMime 	     []string // overrides the consumes mime type
 	allowGzip 	     int // 0 false, 1 true, 2 unitialized
+	allowETag 	     int // 0 false, 1 true, 2 unitialized
+	PreconditionRequired bool // If-Match must be sent, PUT, PATCH and DELETE endpoints only
+	versionChecker	     string // name of the VersionChecker enforcing If-Match
+	cacheControl	     string // Cache-Control of successful responses
+	vary		     []string // request headers added to Vary
+	serverCache	     cachePolicy
+	Pagination	     *Pagination // paginate tag, the method returns a Page
+	SparseFields	     bool // fields tag, ?fields= selects the fields of the output
+	Filename	     string // filename tag, the output is sent as an attachment of this name
+	XMLRoot		     string // xmlroot tag, the root element of xml slices, maps and primitives
+	XMLItem		     string // xmlitem tag, the element of each item of an xml slice or map
 	SecurityScheme	     map[string][]string // must match one of securityDef
 }
 
+//The name of the service the endpoint belongs to, its key in the service metadata given to a Documentor
+func (this EndPointStruct) ServiceName() string {
+	return this.parentTypeName
+}
+
 type restStatus struct {
 	httpCode int
 	reason   string //Especially for code in range 4XX to 5XX
@@ -128,6 +151,10 @@ type ServiceMetaData struct {
 	Root         string
 	realm        string
 	allowGzip    bool
+	allowETag    bool
+	compression  compressionPolicy
+	JSONOptions  JSONOptions // jsonoptions tag
+	XMLRoot      string // xmlroot tag, the root element of the xml collections of the endpoints
 }
 
 var restManager *manager
@@ -277,13 +304,23 @@ func (this manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		rb.ctx.sessData.relSessionData["Origin"] = _manager().allowOrigin
 	}
 	defer rb.PerfLog()
+	defer func() {
+		//Service methods may panic with a Problem, anything else is an internal error
+		if rec := recover(); rec != nil {
+			logger.Error.Println("[gen] Recovered from panic serving page: ", r.Method, r.URL.RequestURI(), rec)
+			if !rb.ctx.dataHasBeenWritten {
+				rb.SetProblem(toProblem(rec))
+				rb.WritePacket()
+			}
+		}
+	}()
 
 	url_, err := url.QueryUnescape(r.URL.RequestURI())
 
 	if err != nil {
 		logger.Warning.Println("[gen] Could not serve page: ", r.Method, r.URL.RequestURI(), "Error:", err)
-		rb.SetResponseCode(400)
-		rb.WriteAndOveride([]byte("Client sent bad request."))
+		rb.SetProblem(NewProblem(http.StatusBadRequest, "Client sent bad request."))
+		rb.WritePacket()
 		return
 	}
 
@@ -304,24 +341,46 @@ func (this manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		basePath :=  _manager().root
 		doc := GetDocumentor("swagger")
 		swagDoc := doc.Document(basePath, this.serviceTypes, this.endpoints, this.securityDef)
-		data, _ := json.Marshal(swagDoc)
+		var data []byte
+		mimeType := swaggerMime(r.Header.Get("Accept"))
+		if mimeType == Application_Yaml {
+			var buf bytes.Buffer
+			NewYAMLStreamMarshaller().Encode(&buf, swagDoc)
+			data = buf.Bytes()
+		} else {
+			data, _ = json.Marshal(swagDoc)
+		}
 		rb.SetResponseCode(http.StatusOK)
+		rb.AddHeader("Content-Type", mimeType)
+		rb.AddHeader("Vary", "Accept")
 		rb.AddHeader("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
 		rb.AddHeader("Access-Control-Allow-Origin", "*")
 		rb.WriteAndOveride(data)
 		return
 	} 
 
-	if ep, args, queryArgs, _, found := getEndPointByUrl(r.Method, url_); found {
+	method := r.Method
+	if isWebSocketUpgrade(r) {
+		if _, _, _, _, found := getEndPointByUrl(WS, url_); found {
+			method = WS
+		}
+	}
+
+	if ep, args, queryArgs, _, found := getEndPointByUrl(method, url_); found {
 		rb.ctx.xsrftoken = getAuthKey(ep.SecurityScheme, queryArgs, r, w)
 
 		prepareServe(rb, ep, args, queryArgs)
 
+		rb.WritePacket()
+	} else if _, _, _, _, found := getEndPointByUrl(WS, url_); found && r.Method == GET {
+		rb.SetHeader("Upgrade", "websocket")
+		rb.SetHeader("Connection", "Upgrade")
+		rb.SetProblem(NewProblem(http.StatusUpgradeRequired, "The resource in the requested path is only available as a WebSocket."))
 		rb.WritePacket()
 	} else {
 		logger.Warning.Println("[gen] Could not serve page, path not found: ", r.Method, url_)
-		rb.SetResponseCode(http.StatusNotFound)
-		rb.WriteAndOveride([]byte("The resource in the requested path could not be found."))
+		rb.SetProblem(NewProblem(http.StatusNotFound, "The resource in the requested path could not be found."))
+		rb.WritePacket()
 	}
 }
 
@@ -0,0 +1,195 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"fmt"
+	"github.com/rmullinnix/logger"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//A response header taken from a field of the output struct. Fields tagged header:"Name" are
+//written as headers before the output is marshalled, and the field tagged status:"true" sets
+//the response code; tag them json:"-" and xml:"-" to keep them out of the body:
+//
+//	type Created struct {
+//	    Id       string `json:"id"`
+//	    Location string `json:"-" xml:"-" header:"Location"`
+//	    Status   int    `json:"-" xml:"-" status:"true"`
+//	}
+//
+//Zero values are not written, slices are written as one header line per element. A status outside
+//100-999 is logged and the response keeps the status code of the endpoint.
+type OutputHeader struct {
+	Name	string // the name of the header
+	Field	reflect.StructField
+}
+
+var outputHeaders sync.Map // reflect.Type to []OutputHeader
+
+//Returns the headers declared by the fields of an output type, or of the struct it points to
+func OutputHeaders(t reflect.Type) []OutputHeader {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if headers, found := outputHeaders.Load(t); found {
+		return headers.([]OutputHeader)
+	}
+
+	headers := make([]OutputHeader, 0)
+	for _, f := range taggedFields(t, nil) {
+		if name := f.Tag.Get("header"); name != "" {
+			headers = append(headers, OutputHeader{Name: http.CanonicalHeaderKey(name), Field: f})
+		}
+	}
+	outputHeaders.Store(t, headers)
+	return headers
+}
+
+//The exported fields of a struct, including those promoted from embedded structs
+func taggedFields(t reflect.Type, index []int) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		f.Index = append(append([]int{}, index...), i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, taggedFields(f.Type, f.Index)...)
+		} else if f.PkgPath == "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+//Writes the header and status fields of the output of a method
+func (this *ResponseBuilder) writeOutputHeaders(v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for _, header := range OutputHeaders(v.Type()) {
+		field, err := v.FieldByIndexErr(header.Field.Index)
+		if err != nil {
+			continue
+		}
+
+		if field.Kind() == reflect.Slice {
+			for i := 0; i < field.Len(); i++ {
+				if value := headerValue(field.Index(i)); value != "" {
+					this.AddHeader(header.Name, value)
+				}
+			}
+		} else if value := headerValue(field); value != "" {
+			this.SetHeader(header.Name, value)
+		}
+	}
+
+	for _, f := range taggedFields(v.Type(), nil) {
+		if f.Tag.Get("status") != "true" {
+			continue
+		}
+		field, err := v.FieldByIndexErr(f.Index)
+		if err != nil {
+			continue
+		}
+
+		var status int64
+		switch {
+		case field.CanInt():
+			status = field.Int()
+		case field.CanUint():
+			if status = int64(field.Uint()); field.Uint() > 999 {
+				status = -1 // out of range, whatever its size
+			}
+		default:
+			continue
+		}
+
+		if status < 100 || status > 999 {
+			if status != 0 {
+				logger.Error.Println("[gen] Invalid response code " + fmt.Sprint(field.Interface()) + " in the status field " + f.Name + " of " + v.Type().String())
+			}
+			continue
+		}
+		this.SetResponseCode(int(status))
+	}
+}
+
+//Sends the output as an attachment of the filename tag, such as a spreadsheet of the rows of a
+//text/csv response, unless the output set the Content-Disposition itself
+func (this *ResponseBuilder) writeAttachment(filename string) {
+	if filename == "" || this.writer().Header().Get("Content-Disposition") != "" {
+		return
+	}
+	this.AddHeader("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+//Formats a field as a header value, "" for zero values
+func headerValue(v reflect.Value) string {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.UTC().Format(http.TimeFormat)
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Ptr:
+		return headerValue(v.Elem())
+	}
+	return fmt.Sprint(v.Interface())
+}
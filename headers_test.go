@@ -0,0 +1,135 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type headersQuota struct {
+	Remaining int `json:"-" header:"X-RateLimit-Remaining"`
+}
+
+type headersResult struct {
+	headersQuota
+	Id       string    `json:"id"`
+	Location string    `json:"-" header:"location"`
+	Total    int64     `json:"-" header:"X-Total-Count"`
+	Modified time.Time `json:"-" header:"Last-Modified"`
+	Warnings []string  `json:"-" header:"Warning"`
+	Empty    string    `json:"-" header:"X-Empty"`
+	Status   int       `json:"-" status:"true"`
+}
+
+type HeadersTestService struct {
+	RestService `root:"/headers-test/"`
+	createItem  EndPoint `method:"POST" path:"/items" postdata:"string" output:"headersResult"`
+}
+
+var headersTestRegister sync.Once
+
+func (serv HeadersTestService) CreateItem(name string) headersResult {
+	return headersResult{Id: name, Location: "/headers-test/items/" + name, Status: http.StatusCreated}
+}
+
+func TestOutputHeaders(t *testing.T) {
+	headers := OutputHeaders(reflect.TypeOf(&headersResult{}))
+	names := make([]string, 0)
+	for _, h := range headers {
+		names = append(names, h.Name)
+	}
+	if strings.Join(names, ",") != "X-Ratelimit-Remaining,Location,X-Total-Count,Last-Modified,Warning,X-Empty" {
+		t.Error("Unexpected output headers:", names)
+	}
+
+	req, _ := http.NewRequest("GET", "/items/1", nil)
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+
+	modified := time.Date(2014, 5, 1, 10, 0, 0, 0, time.UTC)
+	result := &headersResult{headersQuota{7}, "1", "/items/1", 42, modified, []string{"a", "b"}, "", http.StatusAccepted}
+	rb.writeOutputHeaders(reflect.ValueOf(result))
+
+	expected := map[string]string{
+		"X-Ratelimit-Remaining": "7",
+		"Location":              "/items/1",
+		"X-Total-Count":         "42",
+		"Last-Modified":         "Thu, 01 May 2014 10:00:00 GMT",
+	}
+	for name, value := range expected {
+		if rec.Header().Get(name) != value {
+			t.Error("Expecting header", name, value, "got:", rec.Header().Get(name))
+		}
+	}
+	if len(rec.Header()["Warning"]) != 2 || rec.Header().Get("X-Empty") != "" {
+		t.Error("Expecting a line per element and no zero values, got:", rec.Header())
+	}
+	if rb.ctx.responseCode != http.StatusAccepted {
+		t.Error("Expecting the status field to set the response code, got:", rb.ctx.responseCode)
+	}
+
+	for _, status := range []int{42, 1000, -200} {
+		rb.SetResponseCode(http.StatusCreated)
+		rb.writeOutputHeaders(reflect.ValueOf(headersResult{Status: status}))
+		if rb.ctx.responseCode != http.StatusCreated {
+			t.Error("Expecting status", status, "to leave the response code of the endpoint, got:", rb.ctx.responseCode)
+		}
+	}
+
+	var unsigned struct {
+		Status uint16 `json:"-" status:"true"`
+	}
+	unsigned.Status = http.StatusPartialContent
+	rb.writeOutputHeaders(reflect.ValueOf(unsigned))
+	if rb.ctx.responseCode != http.StatusPartialContent {
+		t.Error("Expecting an unsigned status field to set the response code, got:", rb.ctx.responseCode)
+	}
+}
+
+func TestOutputHeadersEndpoint(t *testing.T) {
+	headersTestRegister.Do(func() { RegisterService(new(HeadersTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/headers-test/items", Application_Json, strings.NewReader("pen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/headers-test/items/pen" || string(data) != `{"id":"pen"}` {
+		t.Error("Expecting 201 with a Location, got:", resp.StatusCode, resp.Header, string(data))
+	}
+}
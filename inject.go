@@ -0,0 +1,76 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"reflect"
+)
+
+//Arguments gorest can supply from the request itself. A service method may declare any of
+//these types as trailing arguments, after its path, query and form parameters; they are
+//matched by type and filled in on every call.
+var injectors = make(map[reflect.Type]func(rb *ResponseBuilder, ep EndPointStruct) reflect.Value)
+
+func registerInjector(t reflect.Type, inject func(rb *ResponseBuilder, ep EndPointStruct) reflect.Value) {
+	injectors[t] = inject
+}
+
+//Whether arguments of the type are supplied by gorest rather than the client
+func IsInjectedType(t reflect.Type) bool {
+	_, found := injectors[t]
+	return found
+}
+
+//Number of trailing arguments of the method that are injected by gorest
+func numInjected(methType reflect.Type) int {
+	n := 0
+	for i := methType.NumIn() - 1; i > 0; i-- {
+		if _, found := injectors[methType.In(i)]; !found {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+//Whether the method declares an injected trailing argument of the type
+func declaresInjected(methType reflect.Type, t reflect.Type) bool {
+	for i := methType.NumIn() - numInjected(methType); i < methType.NumIn(); i++ {
+		if methType.In(i) == t {
+			return true
+		}
+	}
+	return false
+}
+
+//Appends the injected trailing arguments of the method
+func appendInjected(arrArgs []reflect.Value, methType reflect.Type, rb *ResponseBuilder, ep EndPointStruct) []reflect.Value {
+	for i := methType.NumIn() - numInjected(methType); i < methType.NumIn(); i++ {
+		arrArgs = append(arrArgs, injectors[methType.In(i)](rb, ep))
+	}
+	return arrArgs
+}
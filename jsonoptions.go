@@ -0,0 +1,425 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/rmullinnix/logger"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//How a service writes json, declared by the jsonoptions tag of its RestService:
+//
+//	RestService `root:"/orders/" jsonoptions:"naming=snake_case,time=RFC1123,emptyslices,noescape"`
+//
+//pretty indents every response, which clients can also ask for with ?pretty=true or an X-Pretty header.
+//noescape leaves <, > and & in strings as they are. naming=camelCase or naming=snake_case names the
+//fields without a json tag. time= formats time.Time values with a layout, or one of RFC3339, RFC1123,
+//RFC822, Kitchen and unix (seconds since the epoch). emptyslices writes nil slices as [] rather than null.
+//The options apply to the responses, streamed items, events and WebSocket messages written by the
+//built-in json marshaller; request bodies and WebSocket messages are read with the same naming and
+//time format.
+type JSONOptions struct {
+	Pretty       bool
+	NoEscapeHTML bool
+	Naming       string // "", camelCase or snake_case
+	TimeFormat   string // time layout or unix, "" for RFC 3339
+	EmptySlices  bool
+}
+
+var timeLayouts = map[string]string{
+	"RFC3339": time.RFC3339,
+	"RFC1123": time.RFC1123,
+	"RFC822":  time.RFC822,
+	"Kitchen": time.Kitchen,
+}
+
+func parseJSONOptions(tag string, name string) JSONOptions {
+	var options	JSONOptions
+
+	for _, item := range strings.Split(tag, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		switch {
+		case parts[0] == "pretty" && len(parts) == 1:
+			options.Pretty = true
+		case parts[0] == "noescape" && len(parts) == 1:
+			options.NoEscapeHTML = true
+		case parts[0] == "emptyslices" && len(parts) == 1:
+			options.EmptySlices = true
+		case parts[0] == "naming" && len(parts) == 2 && (parts[1] == "camelCase" || parts[1] == "snake_case"):
+			options.Naming = parts[1]
+		case parts[0] == "time" && len(parts) == 2 && parts[1] != "":
+			options.TimeFormat = parts[1]
+			if layout, found := timeLayouts[parts[1]]; found {
+				options.TimeFormat = layout
+			}
+		default:
+			logger.Error.Fatalln("[fatal]", "Invalid jsonoptions:[" + tag + "] on service " + name + ", expecting pretty, noescape, emptyslices, naming=camelCase|snake_case and/or time=layout")
+		}
+	}
+	return options
+}
+
+//Whether the client asked for indented json, with ?pretty or an X-Pretty header
+func prettyRequested(r *http.Request) bool {
+	query := r.URL.Query()
+	if values, found := query["pretty"]; found {
+		b, err := strconv.ParseBool(values[0])
+		return values[0] == "" || (err == nil && b)
+	}
+	b, _ := strconv.ParseBool(r.Header.Get("X-Pretty"))
+	return b
+}
+
+//The name the json written with the naming strategy gives a struct field, "" if it is not written.
+//Tagged fields keep the name in their tag.
+func JSONFieldName(f reflect.StructField, naming string) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+
+	switch naming {
+	case "camelCase":
+		words := splitWords(f.Name)
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		return strings.Join(words, "")
+	case "snake_case":
+		return strings.Join(splitWords(f.Name), "_")
+	}
+	return f.Name
+}
+
+//The words of a Go name, lower case: UserID is user and id, HTTPServer http and server
+func splitWords(name string) []string {
+	runes := []rune(name)
+	words := make([]string, 0)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, next := runes[i-1], rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		if unicode.IsUpper(runes[i]) && (unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && unicode.IsLower(next))) || runes[i] == '_' {
+			words = append(words, strings.ToLower(strings.Trim(string(runes[start:i]), "_")))
+			start = i
+		}
+	}
+	words = append(words, strings.ToLower(strings.Trim(string(runes[start:]), "_")))
+
+	nonEmpty := words[:0]
+	for _, word := range words {
+		if word != "" {
+			nonEmpty = append(nonEmpty, word)
+		}
+	}
+	return nonEmpty
+}
+
+//A response entity written by the json marshaller with the options of its service
+type jsonEntity struct {
+	value   interface{}
+	options JSONOptions
+}
+
+//Wraps v in a jsonEntity if the mime type is written by the json marshaller and there are options
+func (this JSONOptions) entity(v interface{}, mimeType string) interface{} {
+	if _, isJSON := marshallerFor(mimeType).(jsonMarshaller); isJSON && this != (JSONOptions{}) {
+		return jsonEntity{v, this}
+	}
+	return v
+}
+
+func (this jsonEntity) marshal() ([]byte, error) {
+	value := this.value
+	if this.options.Naming != "" || this.options.TimeFormat != "" || this.options.EmptySlices {
+		value = this.options.tree(reflect.ValueOf(value))
+	}
+
+	var buf	bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!this.options.NoEscapeHTML)
+	if this.options.Pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+//Rebuilds v from maps, slices and ordered objects, naming the fields and formatting the times
+//as the options say. Values marshalling themselves are left as they are.
+func (this JSONOptions) tree(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		return this.tree(v.Elem())
+	}
+
+	if v.Type() == timeType && this.TimeFormat != "" {
+		t := v.Interface().(time.Time)
+		if this.TimeFormat == "unix" {
+			return t.Unix()
+		}
+		return t.Format(this.TimeFormat)
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if v.CanAddr() && (v.Addr().Type().Implements(jsonMarshalerType) || v.Addr().Type().Implements(textMarshalerType)) {
+		return v.Addr().Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		object := make(jsonObject, 0, v.NumField())
+		for _, f := range marshalledFields(v.Type(), jsonTagKeys, nil) {
+			fv := fieldByIndex(v, f.field.Index)
+			if !fv.IsValid() {
+				continue
+			}
+			if strings.Contains(f.field.Tag.Get("json"), ",omitempty") && isEmptyValue(fv) {
+				continue
+			}
+			object = append(object, jsonMember{JSONFieldName(f.field, this.Naming), this.tree(fv)})
+		}
+		return object
+	case reflect.Slice:
+		if v.IsNil() {
+			if this.EmptySlices {
+				return []interface{}{}
+			}
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // base64, as json writes it
+		}
+		fallthrough
+	case reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = this.tree(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := reflect.MakeMap(reflect.MapOf(v.Type().Key(), interfaceType))
+		for _, key := range v.MapKeys() {
+			if value := this.tree(v.MapIndex(key)); value != nil {
+				m.SetMapIndex(key, reflect.ValueOf(value))
+			} else {
+				m.SetMapIndex(key, reflect.Zero(interfaceType))
+			}
+		}
+		return m.Interface()
+	}
+	return v.Interface()
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+//The StreamMarshaller reading the request bodies of a service: the json marshaller undoes the naming
+//and time format of the options, other marshallers are used as they are
+func (this JSONOptions) requestMarshaller(m StreamMarshaller) StreamMarshaller {
+	if _, isJSON := m.(jsonMarshaller); isJSON && (this.Naming != "" || this.TimeFormat != "") {
+		return jsonOptionsDecoder{jsonMarshaller{}, this}
+	}
+	return m
+}
+
+//Reads json written with the options of a service
+type jsonOptionsDecoder struct {
+	jsonMarshaller
+	options	JSONOptions
+}
+
+func (this jsonOptionsDecoder) Decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var doc	interface{}
+	if err := decodeJSONValue(dec, &doc); err != nil {
+		return err
+	}
+	doc, err := this.options.untree(reflect.TypeOf(v).Elem(), doc)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Undoes tree for a json document to be decoded into a value of type t: the fields get the names
+//encoding/json looks for and the times are given as RFC 3339
+func (this JSONOptions) untree(t reflect.Type, doc interface{}) (interface{}, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	if t == timeType && this.TimeFormat != "" {
+		return this.parseTime(doc)
+	}
+	if pt := reflect.PtrTo(t); pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return doc, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return this.untree(t.Elem(), doc)
+	case reflect.Struct:
+		object, isObject := doc.(map[string]interface{})
+		if !isObject {
+			return doc, nil // json reports the mismatch
+		}
+		fields := make(map[string]interface{}, len(object))
+		for _, f := range marshalledFields(t, jsonTagKeys, nil) {
+			if value, found := objectMember(object, JSONFieldName(f.field, this.Naming)); found {
+				var err	error
+				if fields[f.name], err = this.untree(f.field.Type, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return fields, nil
+	case reflect.Slice, reflect.Array:
+		items, isArray := doc.([]interface{})
+		if !isArray {
+			return doc, nil
+		}
+		for i := range items {
+			var err	error
+			if items[i], err = this.untree(t.Elem(), items[i]); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case reflect.Map:
+		object, isObject := doc.(map[string]interface{})
+		if !isObject {
+			return doc, nil
+		}
+		for key := range object {
+			var err	error
+			if object[key], err = this.untree(t.Elem(), object[key]); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	}
+	return doc, nil
+}
+
+//The member of an object, matched without regard to case as encoding/json does
+func objectMember(object map[string]interface{}, name string) (interface{}, bool) {
+	if value, found := object[name]; found {
+		return value, true
+	}
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+//Reads a time written in the time format of the options
+func (this JSONOptions) parseTime(doc interface{}) (interface{}, error) {
+	if this.TimeFormat == "unix" {
+		number, isNumber := doc.(json.Number)
+		secs, err := number.Int64()
+		if !isNumber || err != nil {
+			return nil, errors.New("Invalid time, expecting seconds since the epoch")
+		}
+		return time.Unix(secs, 0).UTC(), nil
+	}
+
+	value, isString := doc.(string)
+	t, err := time.Parse(this.TimeFormat, value)
+	if !isString || err != nil {
+		return nil, errors.New("Invalid time, expecting the layout " + this.TimeFormat)
+	}
+	return t, nil
+}
+
+//A struct written with its fields in order. The members are written without escaping html, the
+//encoder writing the whole entity escapes them or not.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+func (this jsonObject) MarshalJSON() ([]byte, error) {
+	var buf	bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	buf.WriteByte('{')
+	for i, member := range this {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(member.name); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := enc.Encode(member.value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,255 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type jsonOrder struct {
+	OrderID   string
+	Customer  string `json:"customer_name"`
+	Items     []string
+	Tags      []string `json:",omitempty"`
+	Note      string   `json:"-"`
+	CreatedAt time.Time
+	Shipped   *time.Time
+}
+
+var jsonOrderCreated = time.Date(2014, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func TestJSONFieldName(t *testing.T) {
+	cases := map[string][]string{
+		"OrderID":    {"OrderID", "orderId", "order_id"},
+		"HTTPServer": {"HTTPServer", "httpServer", "http_server"},
+		"Address2":   {"Address2", "address2", "address2"},
+		"Name":       {"Name", "name", "name"},
+	}
+	for name, expected := range cases {
+		f := reflect.StructField{Name: name}
+		for i, naming := range []string{"", "camelCase", "snake_case"} {
+			if got := JSONFieldName(f, naming); got != expected[i] {
+				t.Error("Expecting", expected[i], "for", name, "with", naming, "got:", got)
+			}
+		}
+	}
+
+	orderType := reflect.TypeOf(jsonOrder{})
+	if f, _ := orderType.FieldByName("Customer"); JSONFieldName(f, "camelCase") != "customer_name" {
+		t.Error("Expecting the json tag to name the field")
+	}
+	if f, _ := orderType.FieldByName("Note"); JSONFieldName(f, "snake_case") != "" {
+		t.Error("Expecting fields left out of the json to have no name")
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	order := jsonOrder{OrderID: "<1>", Customer: "Ann", CreatedAt: jsonOrderCreated}
+	encode := func(options JSONOptions) string {
+		var buf bytes.Buffer
+		if err := NewJSONMarshaller().Encode(&buf, jsonEntity{order, options}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	options := parseJSONOptions("naming=snake_case, time=RFC1123, emptyslices, noescape", "test")
+	expected := `{"order_id":"<1>","customer_name":"Ann","items":[],"created_at":"Thu, 01 May 2014 10:00:00 UTC","shipped":null}`
+	if got := encode(options); got != expected {
+		t.Error("Unexpected json:", got)
+	}
+
+	options = JSONOptions{Pretty: true, Naming: "camelCase", TimeFormat: "unix"}
+	expected = "{\n  \"orderId\": \"\\u003c1\\u003e\",\n  \"customer_name\": \"Ann\",\n  \"items\": null,\n  \"createdAt\": 1398938400,\n  \"shipped\": null\n}"
+	if got := encode(options); got != expected {
+		t.Error("Unexpected json:", got)
+	}
+
+	if got := encode(JSONOptions{}); got != `{"OrderID":"\u003c1\u003e","customer_name":"Ann","Items":null,"CreatedAt":"2014-05-01T10:00:00Z","Shipped":null}` {
+		t.Error("Expecting the json to be unchanged without options, got:", got)
+	}
+}
+
+func TestJSONOptionsDecode(t *testing.T) {
+	shipped := jsonOrderCreated.Add(time.Hour)
+	order := jsonOrder{OrderID: "1", Customer: "Ann", Items: []string{"pen"}, CreatedAt: jsonOrderCreated, Shipped: &shipped}
+
+	for _, options := range []JSONOptions{parseJSONOptions("naming=snake_case, time=RFC1123", "test"), {Naming: "camelCase", TimeFormat: "unix"}} {
+		var buf bytes.Buffer
+		if err := NewJSONMarshaller().Encode(&buf, jsonEntity{order, options}); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded jsonOrder
+		if err := options.requestMarshaller(jsonMarshaller{}).Decode(&buf, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.OrderID != "1" || decoded.Customer != "Ann" || !reflect.DeepEqual(decoded.Items, order.Items) ||
+			!decoded.CreatedAt.Equal(order.CreatedAt) || decoded.Shipped == nil || !decoded.Shipped.Equal(shipped) {
+			t.Error("Expecting the order back with", options, "got:", decoded)
+		}
+	}
+
+	options := JSONOptions{TimeFormat: "unix"}
+	var decoded jsonOrder
+	if err := options.requestMarshaller(jsonMarshaller{}).Decode(strings.NewReader(`{"CreatedAt":"yesterday"}`), &decoded); err == nil {
+		t.Error("Expecting an error for a time in another format")
+	}
+	if _, isJSON := (JSONOptions{Pretty: true}).requestMarshaller(jsonMarshaller{}).(jsonMarshaller); !isJSON {
+		t.Error("Expecting the json marshaller to read bodies as they are without naming or time options")
+	}
+}
+
+type JSONOptionsTestService struct {
+	RestService `root:"/json-options-test/" jsonoptions:"naming=snake_case"`
+	getOrder    EndPoint `method:"GET" path:"/order" output:"jsonOrder" fields:"true" etag:"true"`
+	postOrder   EndPoint `method:"POST" path:"/order" postdata:"jsonOrder" output:"jsonOrder"`
+	putOrder    EndPoint `method:"PUT" path:"/order" postdata:"jsonOrder" precondition:"required" checker:"json-options-order"`
+}
+
+var jsonOptionsTestRegister sync.Once
+
+func (serv JSONOptionsTestService) GetOrder() jsonOrder {
+	return jsonOrder{OrderID: "1", Tags: []string{"a"}, CreatedAt: jsonOrderCreated}
+}
+
+func (serv JSONOptionsTestService) PostOrder(order jsonOrder) jsonOrder {
+	return order
+}
+
+func (serv JSONOptionsTestService) PutOrder(order jsonOrder) {
+}
+
+func registerJSONOptionsTestService() {
+	RegisterVersionChecker("json-options-order", func(args map[string]string, rb *ResponseBuilder) string {
+		etag, _ := rb.ETagFor(JSONOptionsTestService{}.GetOrder(), Application_Json)
+		return etag
+	})
+	RegisterService(new(JSONOptionsTestService))
+}
+
+func TestJSONOptionsEndpoint(t *testing.T) {
+	jsonOptionsTestRegister.Do(registerJSONOptionsTestService)
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	get := func(url string, header string) string {
+		req, _ := http.NewRequest("GET", server.URL+url, nil)
+		if header != "" {
+			req.Header.Set("X-Pretty", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(data)
+	}
+
+	compact := `{"order_id":"1","customer_name":"","items":null,"tags":["a"],"created_at":"2014-05-01T10:00:00Z","shipped":null}`
+	if got := get("/json-options-test/order", ""); got != compact {
+		t.Error("Expecting the naming of the service, got:", got)
+	}
+	for _, pretty := range []string{"/json-options-test/order?pretty", "/json-options-test/order?pretty=true"} {
+		if got := get(pretty, ""); !bytes.HasPrefix([]byte(got), []byte("{\n  \"order_id\": \"1\",")) {
+			t.Error("Expecting indented json for", pretty, "got:", got)
+		}
+	}
+	if got := get("/json-options-test/order", "true"); !bytes.HasPrefix([]byte(got), []byte("{\n  ")) {
+		t.Error("Expecting indented json for X-Pretty, got:", got)
+	}
+	if got := get("/json-options-test/order?pretty=false", ""); got != compact {
+		t.Error("Expecting compact json for pretty=false, got:", got)
+	}
+	if got := get("/json-options-test/order?fields=order_id,customer_name", ""); got != `{"order_id":"1","customer_name":""}` {
+		t.Error("Expecting the fields to be selected by the names of the service, got:", got)
+	}
+
+	resp, err := http.Get(server.URL + "/json-options-test/order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(resp.Header.Get("Vary"), "X-Pretty") {
+		t.Error("Expecting Vary: X-Pretty, got:", resp.Header.Get("Vary"))
+	}
+
+	resp, err = http.Post(server.URL+"/json-options-test/order", Application_Json, strings.NewReader(`{"order_id":"2","customer_name":"Bob"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(data), `{"order_id":"2","customer_name":"Bob",`) {
+		t.Error("Expecting the request body to be read with the naming of the service, got:", string(data))
+	}
+}
+
+func TestJSONOptionsETagRoundTrip(t *testing.T) {
+	jsonOptionsTestRegister.Do(registerJSONOptionsTestService)
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/json-options-test/order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("Expecting an ETag on the response")
+	}
+	if plain, _ := ETagFor(JSONOptionsTestService{}.GetOrder(), Application_Json); plain == etag {
+		t.Error("Expecting the etag of the service to differ from the one of the default json rendering")
+	}
+
+	put := func(ifMatch string) int {
+		req, _ := http.NewRequest("PUT", server.URL+"/json-options-test/order", strings.NewReader(`{"order_id":"1"}`))
+		req.Header.Set("Content-Type", Application_Json)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := put(etag); code != http.StatusOK && code != http.StatusNoContent {
+		t.Error("Expecting the etag of the GET response to satisfy If-Match, got:", code)
+	}
+	if code := put(`"stale"`); code != http.StatusPreconditionFailed {
+		t.Error("Expecting 412 for a stale tag, got:", code)
+	}
+}
@@ -27,85 +27,290 @@ package gorest
 
 import (
 	"bytes"
-	"io"
-	"io/ioutil"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"github.com/ajg/form"
+	"io"
+	"io/ioutil"
 	"strings"
 )
 
+//A StreamMarshaller encodes an interface straight to a writer and decodes it straight from a reader, so
+//neither requests nor responses need be held in memory as a whole. Responses are only buffered when their
+//bytes are needed up front, for an automatic etag or the server cache. Every built-in Marshaller has a
+//StreamMarshaller constructor.
+type StreamMarshaller interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
 //A Marshaller represents the two functions used to marshal/unmarshal interfaces back and forth.
+//It is a StreamMarshaller that buffers the whole entity in memory.
 type Marshaller struct {
 	Marshal   func(v interface{}) (io.ReadCloser, error)
 	Unmarshal func(data []byte, v interface{}) error
 }
 
-var marshallers map[string]*Marshaller
+//Encode marshals v and copies the result to w
+func (this *Marshaller) Encode(w io.Writer, v interface{}) error {
+	r, err := this.Marshal(v)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+//Decode reads all of r and unmarshals it into v
+func (this *Marshaller) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return this.Unmarshal(data, v)
+}
+
+var marshallers map[string]StreamMarshaller
+var defaultMarshaller StreamMarshaller
 
 //Register a Marshaller. These registered Marshallers are shared by the client or servers side usage of gorest.
-func RegisterMarshaller(mime string, m *Marshaller) {
+//The mime is the full media type, e.g. application/vnd.siren+json, any parameters are ignored. The first
+//Marshaller registered for a media type is kept, use ReplaceMarshaller to swap it for another.
+//Either a *Marshaller or any other StreamMarshaller may be registered.
+func RegisterMarshaller(mime string, m StreamMarshaller) {
 	if marshallers == nil {
-		marshallers = make(map[string]*Marshaller, 0)
+		marshallers = make(map[string]StreamMarshaller, 0)
 	}
-	if _, found := marshallers[mime]; !found {
-		marshallers[mime] = m
+	key := marshallerKey(mime)
+	if _, found := marshallers[key]; !found {
+		marshallers[key] = unwrapMarshaller(m)
 	}
 }
 
-//Get an already registered Marshaller
-func GetMarshallerByMime(mime string) (m *Marshaller) {
+//Replace the Marshaller registered for the media type, or register it if there is none yet.
+func ReplaceMarshaller(mime string, m StreamMarshaller) {
 	if marshallers == nil {
-		marshallers = make(map[string]*Marshaller, 0)
+		marshallers = make(map[string]StreamMarshaller, 0)
+	}
+	marshallers[marshallerKey(mime)] = unwrapMarshaller(m)
+}
+
+//Set the Marshaller used for media types that have neither a registered Marshaller of their own nor one
+//for their structured syntax suffix. Passing nil removes the default.
+func SetDefaultMarshaller(m StreamMarshaller) {
+	defaultMarshaller = m
+}
+
+//Get an already registered Marshaller. A StreamMarshaller is returned wrapped in a Marshaller.
+func GetMarshallerByMime(mime string) *Marshaller {
+	if m := registeredMarshaller(mime); m != nil {
+		return asMarshaller(m)
+	}
+	return nil
+}
+
+func registeredMarshaller(mime string) StreamMarshaller {
+	if marshallers == nil {
+		marshallers = make(map[string]StreamMarshaller, 0)
+	}
+	m, _ := marshallers[marshallerKey(mime)]
+	return m
+}
+
+//Finds the Marshaller for a media type: first the exact type, then the one registered for its structured
+//syntax suffix (+json, +xml), then the default Marshaller. Returns nil when none of these are set.
+func marshallerFor(mime string) StreamMarshaller {
+	if m := registeredMarshaller(mime); m != nil {
+		return m
+	}
+	if base := baseMediaType(mime); base != "" {
+		if m := registeredMarshaller(base); m != nil {
+			return m
+		}
+	}
+	return defaultMarshaller
+}
+
+//The built-in Marshallers are registered as the StreamMarshallers they wrap
+func unwrapMarshaller(m StreamMarshaller) StreamMarshaller {
+	switch m {
+	case jsonBuffered:
+		return jsonMarshaller{}
+	case xmlBuffered:
+		return xmlMarshaller{}
+	case formBuffered:
+		return formMarshaller{}
+	case yamlBuffered:
+		return yamlMarshaller{}
+	case msgpackBuffered:
+		return msgpackMarshaller{}
+	case csvBuffered:
+		return NewCSVStreamMarshaller()
+	case tsvBuffered:
+		return NewTSVStreamMarshaller()
+	}
+	return m
+}
+
+//Implemented by StreamMarshallers that build the whole entity anyway, so it need not be copied again
+type byteMarshaller interface {
+	marshal(v interface{}) ([]byte, error)
+}
+
+//Wraps a StreamMarshaller in the buffering Marshaller
+func asMarshaller(m StreamMarshaller) *Marshaller {
+	if bm, isMarshaller := m.(*Marshaller); isMarshaller {
+		return bm
+	}
+	return &Marshaller{
+		Marshal: func(v interface{}) (io.ReadCloser, error) {
+			if bm, isBytes := m.(byteMarshaller); isBytes {
+				data, err := bm.marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				return newBytesPacket(data), nil
+			}
+			var buf bytes.Buffer
+			if err := m.Encode(&buf, v); err != nil {
+				return nil, err
+			}
+			return newBytesPacket(buf.Bytes()), nil
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			return m.Decode(bytes.NewReader(data), v)
+		},
+	}
+}
+
+//The registry key of a media type: lower case, without parameters. The short names json and xml used by
+//earlier releases stand for application/json and application/xml.
+func marshallerKey(mime string) string {
+	key := strings.ToLower(strings.TrimSpace(mime))
+	if i := strings.Index(key, ";"); i != -1 {
+		key = strings.TrimSpace(key[:i])
+	}
+	switch key {
+	case "json":
+		return Application_Json
+	case "xml":
+		return Application_Xml
+	}
+	return key
+}
+
+//The generic media type whose Marshaller can handle mime: application/json for the +json suffix (RFC 6839)
+//and newline delimited json, application/xml for the +xml suffix and text/xml, application/yaml for the
+//+yaml suffix and the unregistered yaml types. Empty when there is none.
+func baseMediaType(mime string) string {
+	key := marshallerKey(mime)
+	switch {
+	case key == Application_Json, key == Application_Xml, key == Application_Yaml:
+		return ""
+	case strings.HasSuffix(key, "+json"), key == Application_NDJson:
+		return Application_Json
+	case strings.HasSuffix(key, "+xml"), key == "text/xml":
+		return Application_Xml
+	case strings.HasSuffix(key, "+yaml"), key == "application/x-yaml", key == "text/yaml", key == "text/x-yaml":
+		return Application_Yaml
 	}
-	m, _ = marshallers[mime]
-	return
+	return ""
 }
 
 //Predefined Marshallers
 
+var (
+	jsonBuffered    = asMarshaller(jsonMarshaller{})
+	xmlBuffered     = asMarshaller(xmlMarshaller{})
+	formBuffered    = asMarshaller(formMarshaller{})
+	yamlBuffered    = asMarshaller(yamlMarshaller{})
+	msgpackBuffered = asMarshaller(msgpackMarshaller{})
+	csvBuffered     = asMarshaller(&CSVMarshaller{Comma: ','})
+	tsvBuffered     = asMarshaller(&CSVMarshaller{Comma: '\t'})
+)
+
 //JSON: This makes the JSON Marshaller. The Marshaller uses pkg: json
 func NewJSONMarshaller() *Marshaller {
-	m := Marshaller{jsonMarshal, jsonUnMarshal}
-	return &m
+	return jsonBuffered
+}
+
+//The JSON StreamMarshaller, encoding straight to the writer
+func NewJSONStreamMarshaller() StreamMarshaller {
+	return jsonMarshaller{}
 }
-func jsonMarshal(v interface{}) (io.ReadCloser, error) {
-	j, e := json.Marshal(v)
-	if e != nil {
-		return nil, e
+
+type jsonMarshaller struct{}
+
+//json.Encoder appends a newline, so the value is marshalled and written as it always was.
+//Responses of services with JSONOptions come wrapped in a jsonEntity.
+func (this jsonMarshaller) Encode(w io.Writer, v interface{}) error {
+	j, err := this.marshal(v)
+	if err != nil {
+		return err
 	}
-	return ioutil.NopCloser(bytes.NewBuffer(j)), nil
+	_, err = w.Write(j)
+	return err
 }
-func jsonUnMarshal(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+
+func (jsonMarshaller) marshal(v interface{}) ([]byte, error) {
+	if entity, isEntity := v.(jsonEntity); isEntity {
+		return entity.marshal()
+	}
+	return json.Marshal(v)
+}
+func (jsonMarshaller) Decode(r io.Reader, v interface{}) error {
+	return decodeJSONValue(json.NewDecoder(r), v)
+}
+
+//Only a single value may be sent, anything but white space after it is an error
+func decodeJSONValue(dec *json.Decoder, v interface{}) error {
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("invalid character after top-level json value")
+		}
+		return err
+	}
+	return nil
 }
 
-//XML
+//XML: Slices and maps are written inside a root element, see xmlCollection
 func NewXMLMarshaller() *Marshaller {
-	m := Marshaller{xmlMarshal, xmlUnMarshal}
-	return &m
+	return xmlBuffered
 }
-func xmlMarshal(v interface{}) (io.ReadCloser, error) {
-	x, e := xml.Marshal(v)
-	if e != nil {
-		return nil, e
-	}
-	return ioutil.NopCloser(bytes.NewBuffer(x)), nil
+
+//The XML StreamMarshaller, encoding straight to the writer
+func NewXMLStreamMarshaller() StreamMarshaller {
+	return xmlMarshaller{}
 }
-func xmlUnMarshal(data []byte, v interface{}) error {
-	return xml.Unmarshal(data, v)
+
+type xmlMarshaller struct{}
+
+func (xmlMarshaller) Encode(w io.Writer, v interface{}) error {
+	return encodeXML(w, v)
+}
+func (xmlMarshaller) Decode(r io.Reader, v interface{}) error {
+	return decodeXML(r, v)
 }
 
 //application/x-www-form-urlencoded
-func NewFormMarshaller() * Marshaller {
-	m := Marshaller{formMarshal, formUnMarshal}
-	return &m
+func NewFormMarshaller() *Marshaller {
+	return formBuffered
+}
+
+//The form StreamMarshaller, encoding straight to the writer
+func NewFormStreamMarshaller() StreamMarshaller {
+	return formMarshaller{}
 }
-func formMarshal(v interface{}) (io.ReadCloser, error) {
-	s, err := form.EncodeToString(v)
-	return ioutil.NopCloser(strings.NewReader(s)), err
+
+type formMarshaller struct{}
+
+func (formMarshaller) Encode(w io.Writer, v interface{}) error {
+	return form.NewEncoder(w).Encode(v)
 }
-func formUnMarshal(data []byte, v interface{}) error {
-	err := form.DecodeString(v, string(data))
-	return err
+func (formMarshaller) Decode(r io.Reader, v interface{}) error {
+	return form.NewDecoder(r).Decode(v)
 }
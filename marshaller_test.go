@@ -0,0 +1,336 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Swaps in an empty registry for the duration of a test
+func withMarshallers(t *testing.T) func() {
+	saved, savedDefault := marshallers, defaultMarshaller
+	marshallers, defaultMarshaller = nil, nil
+	return func() {
+		marshallers, defaultMarshaller = saved, savedDefault
+	}
+}
+
+func tagMarshaller(tag string) *Marshaller {
+	return &Marshaller{
+		func(v interface{}) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(tag)), nil
+		},
+		func(data []byte, v interface{}) error {
+			*(v.(*map[string]string)) = map[string]string{"by": tag}
+			return nil
+		},
+	}
+}
+
+func marshalledBy(t *testing.T, mime string) string {
+	r, err := interfaceToBytes(map[string]string{}, mime)
+	if err != nil {
+		t.Fatal(mime + ": " + err.Error())
+	}
+	data, _ := ioutil.ReadAll(r)
+	return string(data)
+}
+
+func TestMarshallerLookup(t *testing.T) {
+	defer withMarshallers(t)()
+
+	RegisterMarshaller("json", tagMarshaller("json"))
+	RegisterMarshaller(Application_Xml, tagMarshaller("xml"))
+	RegisterMarshaller(Application_Siren_Json+"; charset=utf-8", tagMarshaller("siren"))
+
+	cases := map[string]string{
+		Application_Json:                  "json",
+		"Application/JSON; charset=utf-8": "json",
+		Application_Siren_Json:            "siren",
+		Application_Hal_Json:              "json",
+		Application_Problem_Xml:           "xml",
+		"text/xml":                        "xml",
+		Application_NDJson:                "json",
+	}
+	for mime, want := range cases {
+		if got := marshalledBy(t, mime); got != want {
+			t.Error(mime + ": expected the " + want + " marshaller, got " + got)
+		}
+	}
+
+	var out map[string]string
+	if err := bytesToInterface(bytes.NewBufferString("{}"), &out, Application_Hal_Json); err != nil || out["by"] != "json" {
+		t.Error("hal+json should unmarshal with the json marshaller")
+	}
+}
+
+func TestMarshallerDefault(t *testing.T) {
+	defer withMarshallers(t)()
+
+	if _, err := interfaceToBytes(map[string]string{}, "application/x-custom"); err == nil {
+		t.Error("expected an error without a marshaller for the type")
+	}
+	var out map[string]string
+	if err := bytesToInterface(bytes.NewBufferString("x"), &out, "application/x-custom"); err == nil {
+		t.Error("expected an error without an unmarshaller for the type")
+	}
+
+	SetDefaultMarshaller(tagMarshaller("default"))
+	if got := marshalledBy(t, "application/x-custom"); got != "default" {
+		t.Error("expected the default marshaller, got " + got)
+	}
+	if !addMimeType("application/x-custom") {
+		t.Error("a default marshaller should make any mime type usable")
+	}
+}
+
+func TestMarshallerReplace(t *testing.T) {
+	defer withMarshallers(t)()
+
+	RegisterMarshaller(Application_Hal_Json, tagMarshaller("first"))
+	RegisterMarshaller(Application_Hal_Json, tagMarshaller("second"))
+	if got := marshalledBy(t, Application_Hal_Json); got != "first" {
+		t.Error("RegisterMarshaller should keep the first registration, got " + got)
+	}
+	ReplaceMarshaller(Application_Hal_Json, tagMarshaller("second"))
+	if got := marshalledBy(t, Application_Hal_Json); got != "second" {
+		t.Error("ReplaceMarshaller should replace the registration, got " + got)
+	}
+
+	// the built-in *Marshallers keep the behaviour of their StreamMarshallers once registered
+	RegisterMarshaller(Application_Xml, NewXMLMarshaller())
+	ReplaceMarshaller(Application_Json, NewJSONMarshaller())
+	if _, isXML := marshallerFor(Application_Xml).(xmlMarshaller); !isXML {
+		t.Error("Expecting NewXMLMarshaller to register the xml StreamMarshaller")
+	}
+	if _, isJSON := marshallerFor(Application_Json).(jsonMarshaller); !isJSON {
+		t.Error("Expecting NewJSONMarshaller to register the json StreamMarshaller")
+	}
+	ReplaceMarshaller(Text_Csv, NewCSVMarshaller())
+	ReplaceMarshaller(Application_Yaml, NewYAMLMarshaller())
+	if csv, isCSV := marshallerFor(Text_Csv).(*CSVMarshaller); !isCSV || csv.Comma != ',' {
+		t.Error("Expecting NewCSVMarshaller to register the csv StreamMarshaller")
+	}
+	if _, isYAML := marshallerFor(Application_Yaml).(yamlMarshaller); !isYAML {
+		t.Error("Expecting NewYAMLMarshaller to register the yaml StreamMarshaller")
+	}
+}
+
+func TestMarshallerAddMimeType(t *testing.T) {
+	defer withMarshallers(t)()
+
+	if !addMimeType(Application_Hal_Json) || GetMarshallerByMime(Application_Json) == nil {
+		t.Error("hal+json should register the json marshaller under application/json")
+	}
+	if GetMarshallerByMime(Application_Hal_Json) != nil {
+		t.Error("hal+json should be left free for a marshaller of its own")
+	}
+	if !addMimeType("text/xml") || GetMarshallerByMime(Application_Xml) == nil {
+		t.Error("text/xml should register the xml marshaller under application/xml")
+	}
+	if addMimeType("application/x-custom") {
+		t.Error("an unknown mime type should not be accepted")
+	}
+}
+
+const marshalTestMime = "application/vnd.gorest-test+json"
+
+type marshalTestItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type MarshalTestService struct {
+	RestService `root:"/marshal-test/"`
+	echo        EndPoint `method:"POST" path:"/echo" postdata:"marshalTestItem" output:"marshalTestItem" consumes:"application/vnd.gorest-test+json" produces:"application/vnd.gorest-test+json"`
+}
+
+func (serv MarshalTestService) Echo(item marshalTestItem) marshalTestItem {
+	item.Count++
+	return item
+}
+
+// Counts the calls made to the json marshaller
+type recordingMarshaller struct {
+	sync.Mutex
+	encodes, decodes int
+	failEncode       bool
+	buffered         bool // the last Encode was into memory
+}
+
+func (this *recordingMarshaller) Encode(w io.Writer, v interface{}) error {
+	this.Lock()
+	defer this.Unlock()
+	this.encodes++
+	_, this.buffered = w.(*bytes.Buffer)
+	if this.failEncode {
+		return errors.New("encoding failed")
+	}
+	return NewJSONStreamMarshaller().Encode(w, v)
+}
+
+func (this *recordingMarshaller) reset(failEncode bool) {
+	this.Lock()
+	this.encodes, this.decodes, this.failEncode = 0, 0, failEncode
+	this.Unlock()
+}
+
+func (this *recordingMarshaller) Decode(r io.Reader, v interface{}) error {
+	this.Lock()
+	this.decodes++
+	this.Unlock()
+	return NewJSONStreamMarshaller().Decode(r, v)
+}
+
+var marshalTestRegister sync.Once
+var marshalTestRecorder = &recordingMarshaller{}
+
+func TestStreamMarshallerEndpoint(t *testing.T) {
+	marshalTestRegister.Do(func() {
+		RegisterMarshaller(marshalTestMime, marshalTestRecorder)
+		RegisterService(new(MarshalTestService))
+	})
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+	marshalTestRecorder.reset(false)
+
+	resp, err := http.Post(server.URL+"/marshal-test/echo", marshalTestMime, strings.NewReader(`{"name":"pen","count":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || string(data) != `{"name":"pen","count":2}` {
+		t.Fatal("Expecting the echoed item, got:", resp.StatusCode, string(data))
+	}
+
+	marshalTestRecorder.Lock()
+	if marshalTestRecorder.encodes != 1 || marshalTestRecorder.decodes != 1 {
+		t.Error("Expecting one Decode and one Encode, got:", marshalTestRecorder.decodes, marshalTestRecorder.encodes)
+	}
+	if marshalTestRecorder.buffered {
+		t.Error("Expecting the entity to be encoded straight into the response")
+	}
+	marshalTestRecorder.Unlock()
+
+	// the status is sent with the first byte of the entity, so a failure before then is still a 500
+	marshalTestRecorder.reset(true)
+	defer marshalTestRecorder.reset(false)
+	resp, err = http.Post(server.URL+"/marshal-test/echo", marshalTestMime, strings.NewReader(`{"name":"pen"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Error("Expecting 500 when the response can not be marshalled, got:", resp.StatusCode)
+	}
+}
+
+func TestStreamMarshallerBodyErrors(t *testing.T) {
+	marshalTestRegister.Do(func() {
+		RegisterMarshaller(marshalTestMime, marshalTestRecorder)
+		RegisterService(new(MarshalTestService))
+	})
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+	marshalTestRecorder.reset(false)
+
+	post := func(body string) int {
+		resp, err := http.Post(server.URL+"/marshal-test/echo", marshalTestMime, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(`{"name":`); code != http.StatusBadRequest {
+		t.Error("Expecting 400 for a malformed body, got:", code)
+	}
+	if code := post(`{"name":"pen"} trailing`); code != http.StatusBadRequest {
+		t.Error("Expecting 400 for data after the json value, got:", code)
+	}
+	if code := post(""); code != http.StatusCreated {
+		t.Error("Expecting an empty body to give the zero value, got:", code)
+	}
+
+	defer SetMaxDecompressedSize(defaultMaxDecompressedSize)
+	SetMaxDecompressedSize(10)
+	if code := post(`{"name":"an uncompressed name"}`); code != http.StatusCreated {
+		t.Error("Expecting the limit to leave uncompressed bodies alone, got:", code)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"name":"a long name for the limit"}`))
+	zw.Close()
+	req, _ := http.NewRequest("POST", server.URL+"/marshal-test/echo", &gz)
+	req.Header.Set("Content-Type", marshalTestMime)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Error("Expecting 413 past the size limit, got:", resp.StatusCode)
+	}
+}
+
+func TestMarshallerAdapter(t *testing.T) {
+	item := marshalTestItem{"pen", 1}
+	for _, m := range []StreamMarshaller{NewJSONMarshaller(), NewXMLMarshaller()} {
+		bm := asMarshaller(m)
+		r, err := bm.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(r)
+
+		var buf bytes.Buffer
+		if err := bm.Encode(&buf, item); err != nil || buf.String() != string(data) {
+			t.Error("Expecting Encode and Marshal to agree, got:", buf.String(), string(data))
+		}
+		if strings.HasSuffix(string(data), "\n") {
+			t.Error("Expecting no trailing newline, got:", string(data))
+		}
+
+		var out marshalTestItem
+		if err := bm.Unmarshal(data, &out); err != nil || out != item {
+			t.Error("Expecting the item back, got:", out, err)
+		}
+	}
+}
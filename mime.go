@@ -41,6 +41,16 @@ const (
 	Application_Zip           = "application/zip"
 	Application_Siren_Json	  = "application/vnd.siren+json"
 	Application_Hal_Json	  = "application/hal+json"
+	Application_MergePatch_Json = "application/merge-patch+json"
+	Application_JsonPatch_Json  = "application/json-patch+json"
+	Application_Form_UrlEncoded = "application/x-www-form-urlencoded"
+	Application_Problem_Json    = "application/problem+json"
+	Application_Problem_Xml     = "application/problem+xml"
+	Application_NDJson          = "application/x-ndjson"
+	Application_MsgPack         = "application/msgpack"
+	Application_Yaml            = "application/yaml"
+	Text_EventStream            = "text/event-stream"
+	Text_Csv                    = "text/csv"
 	Audio_Xaiff               = "audio/x-aiff"
 	Audio_Xwav                = "audio/x-wav"
 	Image_Cgm                 = "image/cgm"
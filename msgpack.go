@@ -0,0 +1,895 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//MessagePack: This makes the application/msgpack Marshaller. Struct fields are named by their msgpack
+//tag, then their json tag, then their name, and omitempty is honoured; embedded structs are promoted
+//as they are in json. []byte is written as bin and time.Time as the timestamp extension type (-1).
+//Use RequestBuilder.UseContentType(gorest.Application_MsgPack) to talk to msgpack services.
+func NewMsgPackMarshaller() *Marshaller {
+	return msgpackBuffered
+}
+
+//The MessagePack StreamMarshaller, encoding straight to the writer
+func NewMsgPackStreamMarshaller() StreamMarshaller {
+	return msgpackMarshaller{}
+}
+
+type msgpackMarshaller struct{}
+
+func (msgpackMarshaller) Encode(w io.Writer, v interface{}) error {
+	e := &msgpackEncoder{w: bufio.NewWriter(w)}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+//Decode returns io.EOF for an empty input
+func (msgpackMarshaller) Decode(r io.Reader, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return errors.New("msgpack: Decode needs a non-nil pointer")
+	}
+	d := &msgpackDecoder{r: bufio.NewReader(r)}
+	if _, err := d.r.Peek(1); err != nil {
+		return err
+	}
+	return d.decode(target.Elem())
+}
+
+//Format codes of the MessagePack spec
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+
+	mpTimestamp = -1
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//A field of a struct and the key it is written under
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	depth     int
+}
+
+var msgpackFieldCache sync.Map
+
+//The fields of a struct type, with those of embedded structs promoted
+func msgpackFields(t reflect.Type) []msgpackField {
+	if cached, found := msgpackFieldCache.Load(t); found {
+		return cached.([]msgpackField)
+	}
+
+	all := make([]msgpackField, 0)
+	collectMsgpackFields(t, nil, 0, &all)
+
+	// as with json, the shallowest of the fields sharing a name wins
+	fields := make([]msgpackField, 0, len(all))
+	position := make(map[string]int)
+	for _, f := range all {
+		if i, found := position[f.name]; !found {
+			position[f.name] = len(fields)
+			fields = append(fields, f)
+		} else if f.depth < fields[i].depth {
+			fields[i] = f
+		}
+	}
+
+	msgpackFieldCache.Store(t, fields)
+	return fields
+}
+
+func collectMsgpackFields(t reflect.Type, index []int, depth int, fields *[]msgpackField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("msgpack")
+		if tag == "" {
+			tag = f.Tag.Get("json")
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "-" && len(opts) == 1 {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index), len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex = append(fieldIndex, i)
+
+		ft := derefType(f.Type)
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			collectMsgpackFields(ft, fieldIndex, depth+1, fields)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		omitEmpty := false
+		for _, opt := range opts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		*fields = append(*fields, msgpackField{name, fieldIndex, omitEmpty, depth})
+	}
+}
+
+//The values left out by omitempty, the same as for json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type msgpackEncoder struct {
+	w   *bufio.Writer
+	buf [9]byte
+}
+
+func (this *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		return this.w.WriteByte(mpNil)
+	}
+	if v.Type() == timeType {
+		return this.writeTime(v.Interface().(time.Time))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return this.w.WriteByte(mpNil)
+		}
+		return this.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return this.w.WriteByte(mpTrue)
+		}
+		return this.w.WriteByte(mpFalse)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return this.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return this.writeUint(v.Uint())
+	case reflect.Float32:
+		binary.BigEndian.PutUint32(this.buf[1:], math.Float32bits(float32(v.Float())))
+		return this.writeCode(mpFloat32, 4)
+	case reflect.Float64:
+		binary.BigEndian.PutUint64(this.buf[1:], math.Float64bits(v.Float()))
+		return this.writeCode(mpFloat64, 8)
+	case reflect.String:
+		return this.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return this.w.WriteByte(mpNil)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return this.writeBin(v.Bytes())
+		}
+		return this.encodeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return this.writeBin(data)
+		}
+		return this.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return this.w.WriteByte(mpNil)
+		}
+		return this.encodeMap(v)
+	case reflect.Struct:
+		return this.encodeStruct(v)
+	}
+	return errors.New("msgpack: unsupported type " + v.Type().String())
+}
+
+func (this *msgpackEncoder) encodeArray(v reflect.Value) error {
+	this.writeLength(v.Len(), 0x90, 16, mpArray16, mpArray32)
+	for i := 0; i < v.Len(); i++ {
+		if err := this.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Maps are written in key order, so the same value always gives the same bytes (and etag)
+func (this *msgpackEncoder) encodeMap(v reflect.Value) error {
+	keys := sortedMapKeys(v)
+	this.writeLength(len(keys), 0x80, 16, mpMap16, mpMap32)
+	for _, key := range keys {
+		if err := this.encode(key); err != nil {
+			return err
+		}
+		if err := this.encode(v.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//The keys of a map in order, for the key kinds that have one
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		}
+		return false
+	})
+	return keys
+}
+
+func (this *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	fields := msgpackFields(v.Type())
+	values := make([]reflect.Value, len(fields))
+	count := 0
+	for i, f := range fields {
+		// fields of a nil embedded pointer are left out
+		fv := fieldByIndex(v, f.index)
+		if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		values[i] = fv
+		count++
+	}
+
+	this.writeLength(count, 0x80, 16, mpMap16, mpMap32)
+	for i, f := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+		if err := this.writeString(f.name); err != nil {
+			return err
+		}
+		if err := this.encode(values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Writes code followed by the n bytes put in buf[1:]
+func (this *msgpackEncoder) writeCode(code byte, n int) error {
+	this.buf[0] = code
+	_, err := this.w.Write(this.buf[:n+1])
+	return err
+}
+
+//Writes the smallest header for a length: the fix format below fixMax, then 16 or 32 bits
+func (this *msgpackEncoder) writeLength(n int, fix byte, fixMax int, code16, code32 byte) error {
+	switch {
+	case n < fixMax:
+		return this.w.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		binary.BigEndian.PutUint16(this.buf[1:], uint16(n))
+		return this.writeCode(code16, 2)
+	}
+	binary.BigEndian.PutUint32(this.buf[1:], uint32(n))
+	return this.writeCode(code32, 4)
+}
+
+func (this *msgpackEncoder) writeInt(n int64) error {
+	switch {
+	case n >= 0:
+		return this.writeUint(uint64(n))
+	case n >= -32:
+		return this.w.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		this.buf[1] = byte(n)
+		return this.writeCode(mpInt8, 1)
+	case n >= math.MinInt16:
+		binary.BigEndian.PutUint16(this.buf[1:], uint16(n))
+		return this.writeCode(mpInt16, 2)
+	case n >= math.MinInt32:
+		binary.BigEndian.PutUint32(this.buf[1:], uint32(n))
+		return this.writeCode(mpInt32, 4)
+	}
+	binary.BigEndian.PutUint64(this.buf[1:], uint64(n))
+	return this.writeCode(mpInt64, 8)
+}
+
+func (this *msgpackEncoder) writeUint(n uint64) error {
+	switch {
+	case n <= 0x7f:
+		return this.w.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		this.buf[1] = byte(n)
+		return this.writeCode(mpUint8, 1)
+	case n <= math.MaxUint16:
+		binary.BigEndian.PutUint16(this.buf[1:], uint16(n))
+		return this.writeCode(mpUint16, 2)
+	case n <= math.MaxUint32:
+		binary.BigEndian.PutUint32(this.buf[1:], uint32(n))
+		return this.writeCode(mpUint32, 4)
+	}
+	binary.BigEndian.PutUint64(this.buf[1:], n)
+	return this.writeCode(mpUint64, 8)
+}
+
+func (this *msgpackEncoder) writeString(s string) error {
+	if len(s) < 32 {
+		this.w.WriteByte(0xa0 | byte(len(s)))
+	} else if len(s) <= math.MaxUint8 {
+		this.buf[1] = byte(len(s))
+		this.writeCode(mpStr8, 1)
+	} else {
+		this.writeLength(len(s), 0, 0, mpStr16, mpStr32)
+	}
+	_, err := this.w.WriteString(s)
+	return err
+}
+
+func (this *msgpackEncoder) writeBin(data []byte) error {
+	if len(data) <= math.MaxUint8 {
+		this.buf[1] = byte(len(data))
+		this.writeCode(mpBin8, 1)
+	} else {
+		this.writeLength(len(data), 0, 0, mpBin16, mpBin32)
+	}
+	_, err := this.w.Write(data)
+	return err
+}
+
+//Writes the timestamp extension in the smallest of its 32, 64 and 96 bit forms
+func (this *msgpackEncoder) writeTime(t time.Time) error {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	if sec >= 0 && sec>>34 == 0 {
+		data := uint64(nsec)<<34 | uint64(sec)
+		if data>>32 == 0 {
+			this.w.Write([]byte{mpFixExt1 + 2, 0xff})
+			binary.BigEndian.PutUint32(this.buf[:], uint32(data))
+			_, err := this.w.Write(this.buf[:4])
+			return err
+		}
+		this.w.Write([]byte{mpFixExt1 + 3, 0xff})
+		binary.BigEndian.PutUint64(this.buf[:], data)
+		_, err := this.w.Write(this.buf[:8])
+		return err
+	}
+
+	this.w.Write([]byte{mpExt8, 12, 0xff})
+	binary.BigEndian.PutUint32(this.buf[:], uint32(nsec))
+	this.w.Write(this.buf[:4])
+	binary.BigEndian.PutUint64(this.buf[:], uint64(sec))
+	_, err := this.w.Write(this.buf[:8])
+	return err
+}
+
+//The deepest nesting of arrays and maps a message may have, so a hostile one can not exhaust the stack
+const msgpackMaxDepth = 10000
+
+var errMsgpackDepth = errors.New("msgpack: exceeded the maximum nesting depth")
+
+type msgpackDecoder struct {
+	r     *bufio.Reader
+	depth int
+}
+
+func (this *msgpackDecoder) readByte() (byte, error) {
+	b, err := this.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+//Reads n bytes, growing the buffer as they arrive rather than trusting the length up front
+func (this *msgpackDecoder) readBytes(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, this.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//Reads a big endian unsigned integer of size bytes
+func (this *msgpackDecoder) readUint(size int) (uint64, error) {
+	data, err := this.readBytes(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	n := uint64(0)
+	for _, b := range data {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+//The length that follows a str, bin, array or map code of 8, 16 or 32 bits
+func (this *msgpackDecoder) readLength(code, code8, code16 byte) (uint64, error) {
+	switch code {
+	case code8:
+		return this.readUint(1)
+	case code16:
+		return this.readUint(2)
+	}
+	return this.readUint(4)
+}
+
+//Every nested value is read through decode, which keeps count of the depth
+func (this *msgpackDecoder) decode(v reflect.Value) error {
+	if this.depth++; this.depth > msgpackMaxDepth {
+		return errMsgpackDepth
+	}
+	defer func() { this.depth-- }()
+
+	code, err := this.readByte()
+	if err != nil {
+		return err
+	}
+	return this.decodeCode(code, v)
+}
+
+func (this *msgpackDecoder) decodeCode(code byte, v reflect.Value) error {
+	if code == mpNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return this.decodeCode(code, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		value, err := this.decodeValue(code)
+		if err == nil && value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+		return err
+	}
+
+	switch {
+	case code <= 0x7f || code >= 0xe0 || (code >= mpUint8 && code <= mpInt64):
+		n, u, unsigned, err := this.readNumber(code)
+		if err != nil {
+			return err
+		}
+		return setNumber(v, n, u, unsigned)
+	case code == mpFloat32 || code == mpFloat64:
+		f, err := this.readFloat(code)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return mismatch("float", v)
+		}
+		v.SetFloat(f)
+		return nil
+	case code == mpFalse || code == mpTrue:
+		if v.Kind() != reflect.Bool {
+			return mismatch("bool", v)
+		}
+		v.SetBool(code == mpTrue)
+		return nil
+	case code&0xe0 == 0xa0 || (code >= mpStr8 && code <= mpStr32), code >= mpBin8 && code <= mpBin32:
+		data, err := this.readRaw(code)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(data))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(data)
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			reflect.Copy(v, reflect.ValueOf(data))
+		default:
+			return mismatch("string", v)
+		}
+		return nil
+	case code&0xf0 == 0x90 || code == mpArray16 || code == mpArray32:
+		n, err := this.arrayLength(code)
+		if err != nil {
+			return err
+		}
+		return this.decodeArray(n, v)
+	case code&0xf0 == 0x80 || code == mpMap16 || code == mpMap32:
+		n, err := this.mapLength(code)
+		if err != nil {
+			return err
+		}
+		return this.decodeMap(n, v)
+	case (code >= mpFixExt1 && code <= mpFixExt16) || (code >= mpExt8 && code <= mpExt32):
+		typ, data, err := this.readExt(code)
+		if err != nil {
+			return err
+		}
+		if typ != mpTimestamp || v.Type() != timeType {
+			return mismatch("extension "+fmt.Sprint(typ), v)
+		}
+		t, err := decodeTime(data)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+	return errors.New("msgpack: invalid code " + fmt.Sprintf("0x%x", code))
+}
+
+func mismatch(what string, v reflect.Value) error {
+	return errors.New("msgpack: cannot decode " + what + " into " + v.Type().String())
+}
+
+//Reads an integer as either signed n or unsigned u
+func (this *msgpackDecoder) readNumber(code byte) (n int64, u uint64, unsigned bool, err error) {
+	switch {
+	case code <= 0x7f:
+		return 0, uint64(code), true, nil
+	case code >= 0xe0:
+		return int64(int8(code)), 0, false, nil
+	case code >= mpUint8 && code <= mpUint64:
+		u, err = this.readUint(1 << (code - mpUint8))
+		return 0, u, true, err
+	}
+	size := 1 << (code - mpInt8)
+	u, err = this.readUint(size)
+	switch size {
+	case 1:
+		n = int64(int8(u))
+	case 2:
+		n = int64(int16(u))
+	case 4:
+		n = int64(int32(u))
+	default:
+		n = int64(u)
+	}
+	return n, 0, false, err
+}
+
+func (this *msgpackDecoder) readFloat(code byte) (float64, error) {
+	if code == mpFloat32 {
+		bits, err := this.readUint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	}
+	bits, err := this.readUint(8)
+	return math.Float64frombits(bits), err
+}
+
+//Reads the bytes of a str or bin
+func (this *msgpackDecoder) readRaw(code byte) ([]byte, error) {
+	var n uint64
+	var err error
+	switch {
+	case code&0xe0 == 0xa0:
+		n = uint64(code & 0x1f)
+	case code >= mpStr8 && code <= mpStr32:
+		n, err = this.readLength(code, mpStr8, mpStr16)
+	default:
+		n, err = this.readLength(code, mpBin8, mpBin16)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return this.readBytes(n)
+}
+
+func (this *msgpackDecoder) arrayLength(code byte) (uint64, error) {
+	if code&0xf0 == 0x90 {
+		return uint64(code & 0x0f), nil
+	}
+	return this.readLength(code, 0, mpArray16)
+}
+
+func (this *msgpackDecoder) mapLength(code byte) (uint64, error) {
+	if code&0xf0 == 0x80 {
+		return uint64(code & 0x0f), nil
+	}
+	return this.readLength(code, 0, mpMap16)
+}
+
+func (this *msgpackDecoder) readExt(code byte) (int8, []byte, error) {
+	var n uint64
+	var err error
+	if code >= mpFixExt1 && code <= mpFixExt16 {
+		n = 1 << (code - mpFixExt1)
+	} else {
+		n, err = this.readLength(code, mpExt8, mpExt16)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	typ, err := this.readByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := this.readBytes(n)
+	return int8(typ), data, err
+}
+
+func decodeTime(data []byte) (time.Time, error) {
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		n := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(n&(1<<34-1)), int64(n>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return time.Time{}, errors.New("msgpack: invalid timestamp length " + fmt.Sprint(len(data)))
+}
+
+func setNumber(v reflect.Value, n int64, u uint64, unsigned bool) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if unsigned {
+			if u > math.MaxInt64 {
+				return errors.New("msgpack: " + fmt.Sprint(u) + " overflows " + v.Type().String())
+			}
+			n = int64(u)
+		}
+		if v.OverflowInt(n) {
+			return errors.New("msgpack: " + fmt.Sprint(n) + " overflows " + v.Type().String())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !unsigned {
+			if n < 0 {
+				return errors.New("msgpack: " + fmt.Sprint(n) + " overflows " + v.Type().String())
+			}
+			u = uint64(n)
+		}
+		if v.OverflowUint(u) {
+			return errors.New("msgpack: " + fmt.Sprint(u) + " overflows " + v.Type().String())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if unsigned {
+			v.SetFloat(float64(u))
+		} else {
+			v.SetFloat(float64(n))
+		}
+	default:
+		return mismatch("integer", v)
+	}
+	return nil
+}
+
+func (this *msgpackDecoder) decodeArray(n uint64, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		// grow as the elements arrive rather than trusting the length up front
+		size := n
+		if size > 1024 {
+			size = 1024
+		}
+		slice := reflect.MakeSlice(v.Type(), 0, int(size))
+		for i := uint64(0); i < n; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := this.decode(elem); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		v.Set(reflect.Zero(v.Type()))
+		for i := uint64(0); i < n; i++ {
+			if i < uint64(v.Len()) {
+				if err := this.decode(v.Index(int(i))); err != nil {
+					return err
+				}
+			} else if err := this.skip(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return mismatch("array", v)
+}
+
+func (this *msgpackDecoder) decodeMap(n uint64, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := uint64(0); i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := this.decode(key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := this.decode(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		for i := uint64(0); i < n; i++ {
+			var name string
+			if err := this.decode(reflect.ValueOf(&name).Elem()); err != nil {
+				return err
+			}
+			// keys that are not fields of the struct are skipped, names match as they do in json
+			var field *msgpackField
+			for j := range fields {
+				if fields[j].name == name {
+					field = &fields[j]
+					break
+				} else if field == nil && strings.EqualFold(fields[j].name, name) {
+					field = &fields[j]
+				}
+			}
+			if field == nil {
+				if err := this.skip(); err != nil {
+					return err
+				}
+			} else if err := this.decode(allocFieldByIndex(v, field.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return mismatch("map", v)
+}
+
+func (this *msgpackDecoder) skip() error {
+	code, err := this.readByte()
+	if err != nil {
+		return err
+	}
+	_, err = this.decodeValue(code)
+	return err
+}
+
+//Decodes into the types json gives an interface{}, keeping integers as int64 (or uint64 when they
+//are too large) and bin as []byte. Map keys are made strings.
+func (this *msgpackDecoder) decodeValue(code byte) (interface{}, error) {
+	switch {
+	case code == mpNil:
+		return nil, nil
+	case code == mpFalse || code == mpTrue:
+		return code == mpTrue, nil
+	case code <= 0x7f || code >= 0xe0 || (code >= mpUint8 && code <= mpInt64):
+		n, u, unsigned, err := this.readNumber(code)
+		if unsigned && u > math.MaxInt64 {
+			return u, err
+		} else if unsigned {
+			return int64(u), err
+		}
+		return n, err
+	case code == mpFloat32 || code == mpFloat64:
+		return this.readFloat(code)
+	case code&0xe0 == 0xa0 || (code >= mpStr8 && code <= mpStr32):
+		data, err := this.readRaw(code)
+		return string(data), err
+	case code >= mpBin8 && code <= mpBin32:
+		return this.readRaw(code)
+	case code&0xf0 == 0x90 || code == mpArray16 || code == mpArray32:
+		var items []interface{}
+		n, err := this.arrayLength(code)
+		if err == nil {
+			err = this.decodeArray(n, reflect.ValueOf(&items).Elem())
+		}
+		return items, err
+	case code&0xf0 == 0x80 || code == mpMap16 || code == mpMap32:
+		n, err := this.mapLength(code)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{})
+		for i := uint64(0); i < n; i++ {
+			var key, value interface{}
+			if err := this.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return nil, err
+			}
+			if err := this.decode(reflect.ValueOf(&value).Elem()); err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, nil
+	case (code >= mpFixExt1 && code <= mpFixExt16) || (code >= mpExt8 && code <= mpExt32):
+		typ, data, err := this.readExt(code)
+		if err != nil {
+			return nil, err
+		}
+		if typ == mpTimestamp {
+			return decodeTime(data)
+		}
+		return data, nil
+	}
+	return nil, errors.New("msgpack: invalid code " + fmt.Sprintf("0x%x", code))
+}
@@ -0,0 +1,212 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Encodes v with msgpack, decodes it into a new value of the same type and compares the json of both
+func msgpackRoundTrip(t *testing.T, v interface{}) interface{} {
+	var buf bytes.Buffer
+	if err := NewMsgPackMarshaller().Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	out := reflect.New(reflect.TypeOf(v))
+	if err := NewMsgPackMarshaller().Decode(&buf, out.Interface()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := json.Marshal(v)
+	got, _ := json.Marshal(out.Elem().Interface())
+	if string(expected) != string(got) {
+		t.Error("Round trip changed the value:\n" + string(expected) + "\n" + string(got))
+	}
+	return out.Elem().Interface()
+}
+
+func TestMsgPackTypes(t *testing.T) {
+	users := []User{
+		{"user1", "Joe", "Soap", 19, 89.7},
+		{"user2", "Jose", "Soap2", -15, 0},
+	}
+	msgpackRoundTrip(t, users[0])
+	msgpackRoundTrip(t, users)
+	msgpackRoundTrip(t, map[string]User{"One": users[0], "Two": users[1]})
+	msgpackRoundTrip(t, map[string]int{"a": 1, "b": -300, "c": 70000, "d": 1 << 40})
+	msgpackRoundTrip(t, Complex{"auth", 5, -2, "joe", "secret"})
+	msgpackRoundTrip(t, "a string longer than thirty one bytes, to need str8")
+	msgpackRoundTrip(t, strings.Repeat("x", 300))
+	msgpackRoundTrip(t, 3.25)
+	msgpackRoundTrip(t, true)
+	msgpackRoundTrip(t, []int{})
+
+	// the example of the msgpack.org home page
+	var buf bytes.Buffer
+	NewMsgPackMarshaller().Encode(&buf, map[string]interface{}{"compact": true, "schema": 0})
+	if expected := "\x82\xa7compact\xc3\xa6schema\x00"; buf.String() != expected {
+		t.Errorf("Expecting % x, got % x", expected, buf.String())
+	}
+
+	var generic interface{}
+	data, _ := json.Marshal(users)
+	json.Unmarshal(data, &generic)
+	msgpackRoundTrip(t, generic)
+}
+
+type msgpackTagged struct {
+	headersQuota
+	Name     string     `msgpack:"name"`
+	Email    string     `json:"email,omitempty"`
+	Skipped  string     `json:"-"`
+	Data     []byte     `json:"data"`
+	Created  time.Time  `json:"created"`
+	Updated  *time.Time `json:"updated"`
+	Children []*msgpackTagged
+}
+
+func TestMsgPackTagsAndExtensions(t *testing.T) {
+	updated := time.Date(2014, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	v := msgpackTagged{headersQuota{3}, "a", "", "x", []byte{0, 1, 2, 255}, time.Unix(1400000000, 0).UTC(), &updated, []*msgpackTagged{{Name: "b"}}}
+	out := msgpackRoundTrip(t, v).(msgpackTagged)
+	if out.Skipped != "" || !bytes.Equal(out.Data, v.Data) || !out.Updated.Equal(updated) || out.Children[0].Name != "b" {
+		t.Error("Unexpected value:", out)
+	}
+
+	var buf bytes.Buffer
+	NewMsgPackMarshaller().Encode(&buf, v)
+	var keys map[string]interface{}
+	NewMsgPackMarshaller().Decode(bytes.NewReader(buf.Bytes()), &keys)
+	if _, found := keys["email"]; found {
+		t.Error("Expecting omitempty to leave the email out")
+	}
+	if _, found := keys["name"]; !found {
+		t.Error("Expecting the msgpack tag to name the field")
+	}
+	if _, isBytes := keys["data"].([]byte); !isBytes {
+		t.Error("Expecting []byte to be written as bin")
+	}
+	if _, isTime := keys["created"].(time.Time); !isTime {
+		t.Error("Expecting time.Time to be written as a timestamp")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte{0xd6, 0xff}) || !bytes.Contains(buf.Bytes(), []byte{0xd7, 0xff}) {
+		t.Error("Expecting the 32 and 64 bit timestamp forms")
+	}
+
+	old := time.Date(1900, 1, 1, 0, 0, 0, 5, time.UTC)
+	if got := msgpackRoundTrip(t, old).(time.Time); !got.Equal(old) {
+		t.Error("Expecting the 96 bit timestamp form to round trip, got:", got)
+	}
+}
+
+func TestMsgPackErrors(t *testing.T) {
+	var user User
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader(nil), &user); err != io.EOF {
+		t.Error("Expecting io.EOF for an empty input, got:", err)
+	}
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader([]byte{0x81, 0xa3, 'A', 'g', 'e', 0xa1, 'x'}), &user); err == nil {
+		t.Error("Expecting an error decoding a string into an int")
+	}
+	// a str32 claiming 4GB must not be allocated up front
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader([]byte{0xdb, 0xff, 0xff, 0xff, 0xff, 'a'}), new(string)); err != io.ErrUnexpectedEOF {
+		t.Error("Expecting io.ErrUnexpectedEOF for a truncated input, got:", err)
+	}
+	var small int8
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader([]byte{0xcd, 0x01, 0x00}), &small); err == nil {
+		t.Error("Expecting an overflow error")
+	}
+	if err := NewMsgPackMarshaller().Encode(ioutil.Discard, make(chan int)); err == nil {
+		t.Error("Expecting an error for an unsupported type")
+	}
+
+	// arrays nested in arrays, skipped struct fields and maps all count towards the depth limit
+	nested := func(depth int, prefix ...byte) []byte {
+		return append(append(prefix, bytes.Repeat([]byte{0x91}, depth)...), 0xc0)
+	}
+	var value interface{}
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader(nested(100)), &value); err != nil {
+		t.Error("Expecting moderately nested arrays to decode, got:", err)
+	}
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader(nested(msgpackMaxDepth+1)), &value); err != errMsgpackDepth {
+		t.Error("Expecting the nesting depth to be limited, got:", err)
+	}
+	if err := NewMsgPackMarshaller().Decode(bytes.NewReader(nested(msgpackMaxDepth+1, 0x81, 0xa1, 'x')), &user); err != errMsgpackDepth {
+		t.Error("Expecting the depth of skipped fields to be limited, got:", err)
+	}
+}
+
+type MsgPackTestService struct {
+	RestService `root:"/msgpack-test/"`
+	getUser     EndPoint `method:"GET" path:"/users/{id:string}" output:"User" produces:"application/msgpack,application/json"`
+	addUser     EndPoint `method:"POST" path:"/users" postdata:"User" output:"User" consumes:"application/msgpack" produces:"application/msgpack"`
+}
+
+var msgpackTestRegister sync.Once
+
+func (serv MsgPackTestService) GetUser(id string) User {
+	return User{id, "Joe", "Soap", 19, 89.5}
+}
+
+func (serv MsgPackTestService) AddUser(user User) User {
+	user.Id = "new"
+	return user
+}
+
+func TestMsgPackClient(t *testing.T) {
+	msgpackTestRegister.Do(func() { RegisterService(new(MsgPackTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	rb, _ := NewRequestBuilder(server.URL + "/msgpack-test/users/7")
+	var user User
+	res, err := rb.UseContentType(Application_MsgPack).Get(&user, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Content-Type") != Application_MsgPack || user.Id != "7" || user.Weight != 89.5 {
+		t.Error("Expecting a msgpack user, got:", res.Header.Get("Content-Type"), user)
+	}
+
+	rb, _ = NewRequestBuilder(server.URL + "/msgpack-test/users")
+	var created User
+	res, err = rb.UseContentType(Application_MsgPack).PostWithResponse(User{"", "Ann", "Smith", 30, 60}, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id != "new" || created.FirstName != "Ann" {
+		t.Error("Expecting the created user, got:", res.StatusCode, created)
+	}
+}
@@ -0,0 +1,154 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"mime"
+	"strings"
+)
+
+//Whether a request accepting none of the types an endpoint produces is answered in the first of them,
+//rather than refused with 406 Not Acceptable
+var acceptFallback = false
+
+//Earlier releases answered requests whose Accept header matched none of the produced types in the first
+//type the endpoint produces. Pass true to keep doing so instead of responding 406 Not Acceptable.
+func SetAcceptFallback(fallback bool) {
+	acceptFallback = fallback
+}
+
+//A media range of an Accept header, e.g. text/* or application/json;q=0.5
+type mediaRange struct {
+	mime        string
+	q           float64
+	specificity int // 0 for */*, 1 for type/*, 2 for type/subtype
+}
+
+func parseAccept(accept string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, item := range strings.Split(accept, ",") {
+		mime, q := parseQuality(item)
+		if mime == "" {
+			continue
+		}
+
+		specificity := 2
+		if mime == "*" || mime == "*/*" {
+			mime, specificity = "*/*", 0
+		} else if strings.HasSuffix(mime, "/*") {
+			specificity = 1
+		}
+		ranges = append(ranges, mediaRange{mime, q, specificity})
+	}
+	return ranges
+}
+
+func (this mediaRange) matches(mime string) bool {
+	switch this.specificity {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mime, strings.TrimSuffix(this.mime, "*"))
+	}
+	return this.mime == mime
+}
+
+//Picks the type of available the Accept header weighs highest (RFC 7231 5.3.2). A type is weighed by
+//the most specific range matching it, so application/json;q=0 refuses json even alongside */*. Ties go
+//to the type matched more specifically, then to the first in available. Returns false when the header
+//accepts none of them; an empty header accepts anything.
+func negotiateMime(accept string, available []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		if len(available) > 0 {
+			return available[0], true
+		}
+		return "", false
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, mimeType := range available {
+		mime := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+
+		match := mediaRange{specificity: -1}
+		for _, r := range ranges {
+			if r.specificity > match.specificity && r.matches(mime) {
+				match = r
+			}
+		}
+		if match.specificity == -1 || match.q <= 0 {
+			continue
+		}
+
+		if match.q > bestQ || (match.q == bestQ && match.specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = mimeType, match.q, match.specificity
+		}
+	}
+	return best, best != ""
+}
+
+//Selects the mime type of the response from the Accept header of the request among the types the
+//endpoint produces. Returns false when none of them is acceptable, along with the first type the
+//endpoint produces for when fallback is on.
+func negotiateProduces(accept string, ep EndPointStruct, servMeta ServiceMetaData) (string, bool) {
+	available := producedMimes(ep, servMeta)
+	if mimeType, found := negotiateMime(accept, available); found {
+		return mimeType, true
+	}
+	return available[0], acceptFallback
+}
+
+//The endpoint list of mime types overrides the one of the service, it is not a union
+func producedMimes(ep EndPointStruct, servMeta ServiceMetaData) []string {
+	if len(ep.ProducesMime) > 0 {
+		return ep.ProducesMime
+	}
+	return servMeta.ProducesMime
+}
+
+func consumedMimes(ep EndPointStruct, servMeta ServiceMetaData) []string {
+	if len(ep.ConsumesMime) > 0 {
+		return ep.ConsumesMime
+	}
+	return servMeta.ConsumesMime
+}
+
+//Matches the Content-Type of a request, parameters and all, against the types the endpoint consumes.
+//Returns the consumed type, or false when it is not consumed. Fails when the header can not be parsed.
+func negotiateConsumes(contentType string, ep EndPointStruct, servMeta ServiceMetaData) (string, bool, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, consumed := range consumedMimes(ep, servMeta) {
+		if strings.ToLower(strings.TrimSpace(strings.Split(consumed, ";")[0])) == mediaType {
+			return consumed, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,135 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateMime(t *testing.T) {
+	available := []string{Application_Json, Application_Xml, Text_Csv}
+	cases := map[string]string{
+		"":                                      Application_Json,
+		"application/json, text/plain":          Application_Json,
+		"text/plain, application/xml":           Application_Xml,
+		"*/*":                                   Application_Json,
+		"text/*":                                Text_Csv,
+		"application/*;q=0.5, text/csv":         Text_Csv,
+		"*/*, application/xml":                  Application_Xml,
+		"application/json;q=0, */*":             Application_Xml,
+		"Application/XML;q=0.9, text/csv;q=0.8": Application_Xml,
+		"application/json;q=0.4, */*;q=0.5":     Application_Xml,
+		"application/json; charset=utf-8":       Application_Json,
+	}
+	for accept, expected := range cases {
+		if mime, found := negotiateMime(accept, available); !found || mime != expected {
+			t.Error("Accept", accept, "expecting", expected, "got:", mime, found)
+		}
+	}
+
+	for _, accept := range []string{"text/plain", "image/*", "application/json;q=0, application/xml;q=0, text/csv;q=0"} {
+		if mime, found := negotiateMime(accept, available); found {
+			t.Error("Accept", accept, "expecting nothing acceptable, got:", mime)
+		}
+	}
+}
+
+func TestNotAcceptable(t *testing.T) {
+	csvTestRegister.Do(func() { RegisterService(new(CSVTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	get := func(accept string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/csv-test/rows", nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("application/json, text/plain")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != Application_Json {
+		t.Error("Expecting json, got:", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(resp.Header.Get("Vary"), "Accept") {
+		t.Error("Expecting Vary: Accept, got:", resp.Header.Get("Vary"))
+	}
+
+	resp = get("text/plain")
+	if resp.StatusCode != http.StatusNotAcceptable || !strings.HasPrefix(resp.Header.Get("Content-Type"), Application_Problem_Json) {
+		t.Error("Expecting 406, got:", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// endpoints without an output accept any Accept header
+	req, _ := http.NewRequest("POST", server.URL+"/csv-test/rows", strings.NewReader("city\nAustin\n"))
+	req.Header.Set("Content-Type", Text_Csv)
+	req.Header.Set("Accept", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotAcceptable {
+		t.Error("Expecting an endpoint without output not to be negotiated")
+	}
+
+	SetAcceptFallback(true)
+	defer SetAcceptFallback(false)
+	if resp = get("text/plain"); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != Text_Csv {
+		t.Error("Expecting the first produced type, got:", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestUnsupportedMediaType(t *testing.T) {
+	csvTestRegister.Do(func() { RegisterService(new(CSVTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/csv-test/rows", Application_Json, strings.NewReader(`[{"city":"Austin"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType || resp.Header.Get("Accept") != Text_Csv {
+		t.Error("Expecting 415 listing the accepted types, got:", resp.StatusCode, resp.Header.Get("Accept"))
+	}
+
+	body := "city,postcode\nM\xfcnchen,80331\nBoston,02101\n"
+	resp, err = http.Post(server.URL+"/csv-test/rows", "Text/CSV; charset=iso-8859-1; header=present", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		t.Error("Expecting the parameters of the Content-Type to be accepted, got:", resp.StatusCode)
+	}
+}
@@ -0,0 +1,254 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/xml"
+	"github.com/rmullinnix/logger"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	PageOffset = "offset" // ?offset=40&limit=20
+	PageCursor = "cursor" // ?cursor=abc&limit=20
+)
+
+//The pagination of a list endpoint, declared with the paginate tag:
+//
+//	paginate:"offset"                           offset and limit query parameters
+//	paginate:"cursor,limit=50,max=200"          cursor and limit, 50 items by default, at most 200
+//	paginate:"offset,envelope"                  the items are wrapped with the total and links
+//
+//The limit defaults to 20 and may not exceed 100 unless configured.
+type Pagination struct {
+	Mode		string // PageOffset or PageCursor
+	DefaultLimit	int
+	MaxLimit	int
+	Envelope	bool // the response is a page envelope rather than the bare items
+}
+
+//The page requested by the client, injected into service methods of paginated endpoints
+//that declare it as a trailing argument:
+//
+//	type UserService struct {
+//	    gorest.RestService `root:"/users/"`
+//	    listUsers gorest.EndPoint `method:"GET" path:"/" output:"[]User" paginate:"offset"`
+//	}
+//	func(serv UserService) ListUsers(page gorest.PageRequest) gorest.Page {
+//	    end := page.Offset + page.Limit
+//	    if end > len(users) {
+//	        end = len(users)
+//	    }
+//	    return gorest.Page{Items: users[page.Offset:end], Total: gorest.PageTotal(len(users))}
+//	}
+type PageRequest struct {
+	Offset	int    // the index of the first item, for offset pagination
+	Cursor	string // the position of the page, "" for the first page, for cursor pagination
+	Limit	int    // the maximum number of items of the page
+}
+
+//A page of items returned by the service method of a paginated endpoint. The Link header of the
+//response points to the first, previous, next and last pages as they can be determined; with offset
+//pagination they are derived from the Total, with cursor pagination from the cursors given.
+type Page struct {
+	Items		interface{} // a slice of the items of the page
+	Total		*int        // the number of items in all pages, nil if not known
+	NextCursor	string      // for cursor pagination, "" on the last page
+	PrevCursor	string      // for cursor pagination, "" on the first page
+}
+
+//Returns the total of a Page, e.g. Page{Items: items, Total: PageTotal(count)}
+func PageTotal(total int) *int {
+	return &total
+}
+
+//The body of paginated responses declared with the envelope option
+type pageEnvelope struct {
+	XMLName		xml.Name    `json:"-" xml:"page"`
+	Items		interface{} `json:"items" xml:"items"`
+	Total		*int        `json:"total,omitempty" xml:"total,omitempty"`
+	First		string      `json:"first,omitempty" xml:"first,omitempty"`
+	Prev		string      `json:"prev,omitempty" xml:"prev,omitempty"`
+	Next		string      `json:"next,omitempty" xml:"next,omitempty"`
+	Last		string      `json:"last,omitempty" xml:"last,omitempty"`
+}
+
+var pageType = reflect.TypeOf(Page{})
+var pageRequestType = reflect.TypeOf(PageRequest{})
+
+func init() {
+	registerInjector(pageRequestType, func(rb *ResponseBuilder, ep EndPointStruct) reflect.Value {
+		return reflect.ValueOf(rb.ctx.pageRequest)
+	})
+}
+
+func parsePagination(tag string, sign string) *Pagination {
+	p := &Pagination{DefaultLimit: 20, MaxLimit: 100}
+
+	for i, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		parts := strings.SplitN(item, "=", 2)
+		value := 0
+		if len(parts) == 2 {
+			value, _ = strconv.Atoi(parts[1])
+		}
+
+		if i == 0 && (item == PageOffset || item == PageCursor) {
+			p.Mode = item
+		} else if item == "envelope" {
+			p.Envelope = true
+		} else if parts[0] == "limit" && value > 0 {
+			p.DefaultLimit = value
+		} else if parts[0] == "max" && value > 0 {
+			p.MaxLimit = value
+		} else {
+			logger.Error.Fatalln("[fatal]", "Invalid paginate:[" + tag + "], expecting offset or cursor followed by limit=n, max=n or envelope: " + sign)
+		}
+	}
+
+	if p.Mode == "" {
+		logger.Error.Fatalln("[fatal]", "The paginate tag must start with offset or cursor: " + sign)
+	}
+	if p.DefaultLimit > p.MaxLimit {
+		p.DefaultLimit = p.MaxLimit
+	}
+	return p
+}
+
+//Reads the page requested by the query string of the request
+func parsePageRequest(query url.Values, p *Pagination) (PageRequest, *Problem) {
+	page := PageRequest{Limit: p.DefaultLimit}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > p.MaxLimit {
+			return page, NewProblem(http.StatusBadRequest, "The limit must be a number from 1 to " + strconv.Itoa(p.MaxLimit))
+		}
+		page.Limit = limit
+	}
+
+	if p.Mode == PageCursor {
+		page.Cursor = query.Get("cursor")
+	} else if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, NewProblem(http.StatusBadRequest, "The offset must be a positive number")
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+//Builds the link to another page, keeping the other query parameters of the request
+func pageLink(r *http.Request, p *Pagination, position string, limit int) string {
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Del("cursor")
+	if position != "" {
+		query.Set(p.Mode, position)
+	}
+	query.Set("limit", strconv.Itoa(limit))
+
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+//Sets the Link and X-Total-Count headers of a page, returning the body of the response
+func (this *ResponseBuilder) writePage(page Page, p *Pagination) interface{} {
+	req := this.ctx.pageRequest
+	r := this.ctx.request
+	items := reflect.ValueOf(page.Items)
+	count := 0
+	if items.IsValid() && (items.Kind() == reflect.Slice || items.Kind() == reflect.Array) {
+		count = items.Len()
+	}
+
+	var first, prev, next, last	string
+	if p.Mode == PageCursor {
+		first = pageLink(r, p, "", req.Limit)
+		if page.PrevCursor != "" {
+			prev = pageLink(r, p, page.PrevCursor, req.Limit)
+		}
+		if page.NextCursor != "" {
+			next = pageLink(r, p, page.NextCursor, req.Limit)
+		}
+	} else {
+		first = pageLink(r, p, "0", req.Limit)
+		if req.Offset > 0 {
+			offset := req.Offset - req.Limit
+			if offset < 0 {
+				offset = 0
+			}
+			prev = pageLink(r, p, strconv.Itoa(offset), req.Limit)
+		}
+		if (page.Total != nil && req.Offset + req.Limit < *page.Total) || (page.Total == nil && count >= req.Limit) {
+			next = pageLink(r, p, strconv.Itoa(req.Offset + req.Limit), req.Limit)
+		}
+		if page.Total != nil {
+			offset := 0
+			if *page.Total > 0 {
+				offset = (*page.Total - 1) / req.Limit * req.Limit
+			}
+			last = pageLink(r, p, strconv.Itoa(offset), req.Limit)
+		}
+	}
+
+	links := make([]string, 0, 4)
+	for _, link := range []struct{ rel, href string }{{"first", first}, {"prev", prev}, {"next", next}, {"last", last}} {
+		if link.href != "" {
+			links = append(links, "<" + link.href + ">; rel=\"" + link.rel + "\"")
+		}
+	}
+	this.writer().Header().Set("Link", strings.Join(links, ", "))
+
+	if page.Total != nil {
+		this.writer().Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+	}
+
+	// an empty page is an empty list rather than null
+	if !items.IsValid() || (items.Kind() == reflect.Slice && items.IsNil()) {
+		page.Items = []interface{}{}
+	}
+
+	if p.Envelope {
+		return pageEnvelope{Items: page.Items, Total: page.Total, First: first, Prev: prev, Next: next, Last: last}
+	}
+	return page.Items
+}
+
+//The query parameters of the pagination, for documentation
+func (this *Pagination) Params() []Param {
+	position := Param{Name: "offset", TypeName: "int", Default: "0"}
+	if this.Mode == PageCursor {
+		position = Param{Name: "cursor", TypeName: "string"}
+	}
+	return []Param{position, Param{Name: "limit", TypeName: "int", Default: strconv.Itoa(this.DefaultLimit)}}
+}
@@ -0,0 +1,161 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+type PageTestService struct {
+	RestService `root:"/page-test/"`
+	listNumbers EndPoint `method:"GET" path:"/numbers?{odd:bool}" output:"[]int" paginate:"offset,limit=3,max=5"`
+}
+
+var pageTestRegister sync.Once
+
+func (serv PageTestService) ListNumbers(odd bool, page PageRequest) Page {
+	numbers := make([]int, 0)
+	for i := 0; i < 10; i++ {
+		if !odd || i%2 == 1 {
+			numbers = append(numbers, i)
+		}
+	}
+
+	end := page.Offset + page.Limit
+	if end > len(numbers) {
+		end = len(numbers)
+	}
+	if page.Offset > end {
+		return Page{Total: PageTotal(len(numbers))}
+	}
+	return Page{Items: numbers[page.Offset:end], Total: PageTotal(len(numbers))}
+}
+
+func TestParsePagination(t *testing.T) {
+	p := parsePagination("cursor, limit=50, max=200, envelope", "test")
+	if p.Mode != PageCursor || p.DefaultLimit != 50 || p.MaxLimit != 200 || !p.Envelope {
+		t.Error("Unexpected pagination:", p)
+	}
+
+	p = parsePagination("offset", "test")
+	if p.Mode != PageOffset || p.DefaultLimit != 20 || p.MaxLimit != 100 || p.Envelope {
+		t.Error("Expecting the default limits, got:", p)
+	}
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=x", "offset=-1"} {
+		values, _ := url.ParseQuery(query)
+		if _, problem := parsePageRequest(values, p); problem == nil || problem.Status != http.StatusBadRequest {
+			t.Error("Expecting 400 for", query)
+		}
+	}
+
+	values, _ := url.ParseQuery("offset=40&limit=10")
+	if page, problem := parsePageRequest(values, p); problem != nil || page != (PageRequest{Offset: 40, Limit: 10}) {
+		t.Error("Expecting offset 40 and limit 10, got:", page, problem)
+	}
+}
+
+func writeTestPage(query string, p *Pagination, page Page) (*httptest.ResponseRecorder, interface{}) {
+	req, _ := http.NewRequest("GET", "/users?"+query, nil)
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.pageRequest, _ = parsePageRequest(req.URL.Query(), p)
+	return rec, rb.writePage(page, p)
+}
+
+func TestPageLinks(t *testing.T) {
+	offset := parsePagination("offset,limit=10", "test")
+
+	rec, body := writeTestPage("offset=10&limit=10&sort=name", offset, Page{Items: []int{1}, Total: PageTotal(35)})
+	expected := `</users?limit=10&offset=0&sort=name>; rel="first", </users?limit=10&offset=0&sort=name>; rel="prev", ` +
+		`</users?limit=10&offset=20&sort=name>; rel="next", </users?limit=10&offset=30&sort=name>; rel="last"`
+	if link := rec.Header().Get("Link"); link != expected {
+		t.Error("Unexpected links:", link)
+	}
+	if rec.Header().Get("X-Total-Count") != "35" {
+		t.Error("Expecting the total count, got:", rec.Header().Get("X-Total-Count"))
+	}
+	if items, ok := body.([]int); !ok || len(items) != 1 {
+		t.Error("Expecting the bare items, got:", body)
+	}
+
+	rec, _ = writeTestPage("offset=0", offset, Page{Items: []int{}, Total: PageTotal(0)})
+	if rec.Header().Get("X-Total-Count") != "0" || !strings.Contains(rec.Header().Get("Link"), `rel="last"`) {
+		t.Error("Expecting a known total of 0, got:", rec.Header())
+	}
+
+	rec, _ = writeTestPage("offset=30", offset, Page{Items: []int{}, Total: PageTotal(35)})
+	if link := rec.Header().Get("Link"); link != `</users?limit=10&offset=0>; rel="first", </users?limit=10&offset=20>; rel="prev", </users?limit=10&offset=30>; rel="last"` {
+		t.Error("Expecting no next link on the last page, got:", link)
+	}
+
+	cursor := parsePagination("cursor,limit=5,envelope", "test")
+	rec, body = writeTestPage("cursor=abc", cursor, Page{NextCursor: "def", PrevCursor: "xyz"})
+	if link := rec.Header().Get("Link"); link != `</users?limit=5>; rel="first", </users?cursor=xyz&limit=5>; rel="prev", </users?cursor=def&limit=5>; rel="next"` {
+		t.Error("Unexpected cursor links:", link)
+	}
+	if rec.Header().Get("X-Total-Count") != "" {
+		t.Error("Expecting no total count when it is not known")
+	}
+	data, _ := json.Marshal(body)
+	if string(data) != `{"items":[],"first":"/users?limit=5","prev":"/users?cursor=xyz\u0026limit=5","next":"/users?cursor=def\u0026limit=5"}` {
+		t.Error("Unexpected envelope:", string(data))
+	}
+}
+
+func TestPaginatedEndpoint(t *testing.T) {
+	pageTestRegister.Do(func() { RegisterService(new(PageTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/page-test/numbers?odd=true&offset=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(data) != "[7,9]" || resp.Header.Get("X-Total-Count") != "5" {
+		t.Error("Expecting the second page of odd numbers, got:", resp.StatusCode, string(data), resp.Header)
+	}
+
+	resp, err = http.Get(server.URL + "/page-test/numbers?limit=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("Expecting 400 for a limit over the maximum, got:", resp.StatusCode)
+	}
+}
@@ -59,6 +59,7 @@ package gorest
 
 import (
 	"github.com/rmullinnix/logger"
+	"net/http"
 	"reflect"
 	"strings"
 	"strconv"
@@ -72,6 +73,8 @@ type Param struct {
 	positionInPath int
 	Name           string
 	TypeName       string
+	Required       bool   // query and form parameters only, declared as {name:type!}
+	Default        string // query and form parameters only, declared as {name:type=value}
 }
 
 var aLLOWED_PAR_TYPES = []string{"string", "int", "int32", "int64", "bool", "float32", "float64", "[]string", "[]int"}
@@ -79,7 +82,7 @@ var aLLOWED_PAR_TYPES = []string{"string", "int", "int32", "int64", "bool", "flo
 const (
 	errorString_MarshalMimeType = "The Marshaller for mime-type:[%s], is not registered. Please register this type before registering your service."
 	errorString_Scheme = "The security scheme:[%s], is not registered. Please register this scheme before registering your service."
-	errorString_UnknownMethod = "Unknown method type:[%s] in endpoint declaration. Allowed types {GET,POST,PUT,DELETE,HEAD,OPTIONS}"
+	errorString_UnknownMethod = "Unknown method type:[%s] in endpoint declaration. Allowed types {GET,PATCH,POST,PUT,DELETE,HEAD,OPTIONS,WS}"
 	errorString_EndpointDecl = "Endpoint declaration must have the tags 'method' and 'path' "
 	errorString_StringMap = "Only string keyed maps e.g( map[string]... ) are allowed on the [%s] tag. Endpoint: %s"
 	errorString_DuplicateQueryParam = "Duplicate Query Parameter name(%s) in REST path: %s"
@@ -88,6 +91,7 @@ const (
 	errorString_RegisterSameMethod = "Can not register two endpoints with same request-method(%s) and same signature: %s VS %s"
 	errorString_UniqueRoot = "Variable length endpoints can only be mounted on a unique root. Root already used: %s <> %s"
 	errorString_Gzip = "Service has invalid gzip value. Defaulting to off settings! %s"
+	errorString_ETag = "Service has invalid etag value. Defaulting to off settings! %s"
 )
 
 func prepServiceMetaData(root string, tags reflect.StructTag, i interface{}, name string) ServiceMetaData {
@@ -147,6 +151,33 @@ func prepServiceMetaData(root string, tags reflect.StructTag, i interface{}, nam
 		md.allowGzip = false
 	}
 
+	md.compression = defaultCompression
+	if tag := tags.Get("compression"); tag != "" {
+		md.compression = parseCompression(tag, name)
+		// declaring the settings turns compression on, unless gzip:"false" says otherwise
+		if tags.Get("gzip") == "" {
+			md.allowGzip = true
+		}
+	}
+
+	if tag := tags.Get("jsonoptions"); tag != "" {
+		md.JSONOptions = parseJSONOptions(tag, name)
+	}
+
+	md.XMLRoot = tags.Get("xmlroot")
+
+	if tag := tags.Get("etag"); tag != "" {
+		b, err := strconv.ParseBool(tag)
+		if err != nil {
+			logger.Warning.Printf("[gen] " + errorString_ETag, name)
+			md.allowETag = false
+		} else {
+			md.allowETag = b
+		}
+	} else {
+		md.allowETag = false
+	}
+
 	md.Template = i
 	return *md
 }
@@ -161,6 +192,7 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 		"DELETE":	DELETE,
 		"HEAD":		HEAD,
 		"OPTIONS":	OPTIONS,
+		"WS":		WS,
 	}
 
 	ms := new(EndPointStruct)
@@ -179,12 +211,20 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 			logger.Error.Fatalln("[fatal]", errorString_EndpointDecl)
 		}
 
-		if tag := tags.Get("output"); tag != "" {
+		if tag := tags.Get("output"); tag == "events" {
+			ms.OutputTypeIsEvents = true
+		} else if tag == "binary" {
+			ms.OutputTypeIsBinary = true
+		} else if tag != "" {
 			ms.OutputType = tag
 			if strings.HasPrefix(tag, "[]") { //Check for slice/array/list types.
 				ms.OutputTypeIsArray = true
 				ms.OutputType = ms.OutputType[2:]
 			}
+			if strings.HasPrefix(tag, "chan ") { //Check for streamed output
+				ms.OutputTypeIsStream = true
+				ms.OutputType = strings.TrimSpace(ms.OutputType[5:])
+			}
 			if strings.HasPrefix(tag, "map[") { //Check for map[string]. We only handle string keyed maps!!!
 
 				if ms.OutputType[4:10] == "string" {
@@ -200,19 +240,51 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 		if tag := tags.Get("postdata"); tag != "" {
 			ms.PostdataType = tag
 			if strings.HasPrefix(tag, "[]") { //Check for slice/array/list types.
-				ms.postdataTypeIsArray = true
+				ms.PostdataTypeIsArray = true
 				ms.PostdataType = ms.PostdataType[2:]
 			}
 			if strings.HasPrefix(tag, "map[") { //Check for map[string]. We only handle string keyed maps!!!
 
 				if ms.PostdataType[4:10] == "string" {
-					ms.postdataTypeIsMap = true
+					ms.PostdataTypeIsMap = true
 					ms.PostdataType = ms.PostdataType[11:]
 				} else {
 					logger.Error.Fatalf("[fatal]", errorString_StringMap, "postdata", ms.Signiture)
 				}
 
 			}
+			if ms.PostdataType == "Patch" || ms.PostdataType == "gorest.Patch" {
+				ms.PostdataIsPatch = true
+			}
+		}
+
+		if tag := tags.Get("form"); tag != "" {
+			if len(ms.PostdataType) > 0 {
+				logger.Error.Fatalln("[fatal]", "Endpoint can not declare both the 'form' and 'postdata' tags: " + ms.Signiture)
+			}
+			ms.FormParams = parseFormParams(tag, ms.Signiture)
+			// slice valued fields are converted to arguments by the json marshaller
+			addMimeType(Application_Json)
+		}
+
+		if tag := tags.Get("precondition"); tag == "required" {
+			if ms.RequestMethod != PUT && ms.RequestMethod != PATCH && ms.RequestMethod != DELETE {
+				logger.Error.Fatalln("[fatal]", "Only PUT, PATCH and DELETE endpoints can require an If-Match precondition: " + ms.Signiture)
+			}
+			ms.PreconditionRequired = true
+		} else if tag != "" {
+			logger.Error.Fatalln("[fatal]", "Unknown precondition:[" + tag + "] in endpoint declaration, expecting 'required': " + ms.Signiture)
+		}
+
+		if tag := tags.Get("checker"); tag != "" {
+			if GetVersionChecker(tag) == nil {
+				logger.Error.Fatalln("[fatal]", "The version checker:[" + tag + "], is not registered. Please register this checker before registering your service.")
+			}
+			ms.versionChecker = tag
+		}
+
+		if ms.RequestMethod == WS && (len(ms.PostdataType) > 0 || len(ms.FormParams) > 0) {
+			logger.Error.Fatalln("[fatal]", "WebSocket endpoints receive their data as messages, they can not declare 'postdata' or 'form': " + ms.Signiture)
 		}
 
 		if tag := tags.Get("role"); tag != "" {
@@ -220,7 +292,13 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 		}
 
 		ms.ConsumesMime = make([]string, 0)
-		if tag = tags.Get("consumes"); tag == "" {
+		if tag = tags.Get("consumes"); tag == "" && ms.PostdataIsPatch {
+			// patch documents default to both of the patch formats
+			ms.ConsumesMime = append(ms.ConsumesMime, Application_MergePatch_Json, Application_JsonPatch_Json)
+		} else if tag == "" && len(ms.FormParams) > 0 {
+			// form fields default to both of the html form encodings
+			ms.ConsumesMime = append(ms.ConsumesMime, Application_Form_UrlEncoded, Multipart_FormData)
+		} else if tag == "" {
 			tag = Application_Json // Default
 			ms.ConsumesMime = append(ms.ConsumesMime, tag)
 		} else {
@@ -236,7 +314,14 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 		}
 
 		ms.ProducesMime = make([]string, 0)
-		if tag = tags.Get("produces"); tag == "" {
+		if tag = tags.Get("produces"); tag == "" && ms.OutputTypeIsEvents {
+			ms.ProducesMime = append(ms.ProducesMime, Text_EventStream)
+		} else if tag == "" && ms.OutputTypeIsBinary {
+			ms.ProducesMime = append(ms.ProducesMime, Application_OctetStream)
+		} else if tag == "" && ms.OutputTypeIsStream {
+			// streams default to newline delimited json, a json array or xml elements
+			ms.ProducesMime = append(ms.ProducesMime, Application_NDJson, Application_Json, Application_Xml)
+		} else if tag == "" {
 			tag = Application_Json // Default
 			ms.ProducesMime = append(ms.ProducesMime, tag)
 		} else {
@@ -246,7 +331,8 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 
 		for i := 0; i < len(ms.ProducesMime); i++ {
 			mimeType := ms.ProducesMime[i]
-			if !addMimeType(mimeType) {
+			// binary content is written as is, whatever its type
+			if !ms.OutputTypeIsBinary && !addMimeType(mimeType) {
 				logger.Error.Fatalf("[fatal]", errorString_MarshalMimeType, mimeType)
 			}
 		}
@@ -265,6 +351,59 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 			ms.allowGzip = 2
 		}
 
+		if tag := tags.Get("etag"); tag != "" {
+			b, err := strconv.ParseBool(tag)
+			if err != nil {
+				logger.Warning.Printf("[gen] " + errorString_ETag, ms.Name)
+				ms.allowETag = 2
+			} else if b {
+				ms.allowETag = 1
+			} else {
+				ms.allowETag = 0
+			}
+		} else {
+			ms.allowETag = 2
+		}
+
+		if tag := tags.Get("cache"); tag != "" {
+			ms.cacheControl = tag
+		}
+
+		if tag := tags.Get("vary"); tag != "" {
+			for _, field := range strings.Split(tag, ",") {
+				ms.vary = append(ms.vary, http.CanonicalHeaderKey(strings.TrimSpace(field)))
+			}
+		}
+
+		if tag := tags.Get("paginate"); tag != "" {
+			if ms.RequestMethod != GET {
+				logger.Error.Fatalln("[fatal]", "Only GET endpoints can be paginated: " + ms.Signiture)
+			}
+			ms.Pagination = parsePagination(tag, ms.Signiture)
+		}
+
+		if tag := tags.Get("fields"); tag != "" {
+			b, err := strconv.ParseBool(tag)
+			if err != nil {
+				logger.Warning.Println("[gen] Endpoint has invalid fields value, sparse fieldsets are off: " + ms.Signiture)
+			}
+			ms.SparseFields = b
+		}
+
+		if tag := tags.Get("filename"); tag != "" {
+			ms.Filename = tag
+		}
+
+		ms.XMLRoot = tags.Get("xmlroot")
+		ms.XMLItem = tags.Get("xmlitem")
+
+		if tag := tags.Get("servercache"); tag != "" {
+			if ms.RequestMethod != GET {
+				logger.Error.Fatalln("[fatal]", "Only GET endpoints can be cached on the server: " + ms.Signiture)
+			}
+			ms.serverCache = parseCachePolicy(tag, ms.cacheControl, ms.Signiture)
+		}
+
 		if tag := tags.Get("security"); tag != "" {
 			scopes := make([]string, 0)
 
@@ -276,7 +415,7 @@ func makeEndPointStruct(tags reflect.StructTag, serviceRoot string) EndPointStru
 				name = tag[:strings.Index(tag, ":")]
 			}
 
-			if GetAuthorizer(name) == nil {
+			if GetPrincipalAuthorizer(name) == nil {
 				logger.Error.Fatalf("[fatal]", errorString_Scheme, name)
 			}
 
@@ -385,11 +524,23 @@ func prepSecurityMetaData(tags reflect.StructTag) SecurityStruct {
 }
 
 func addMimeType(mimeType string) bool {
-	if GetMarshallerByMime(mimeType) == nil {
-		if strings.Contains(mimeType, "json") {
-			RegisterMarshaller("json", NewJSONMarshaller())
-		} else if strings.Contains(mimeType, "xml") {
-			RegisterMarshaller("xml", NewXMLMarshaller())
+	if marshallerFor(mimeType) == nil {
+		if base := marshallerKey(mimeType); base == Application_Json || baseMediaType(base) == Application_Json {
+			RegisterMarshaller(Application_Json, NewJSONStreamMarshaller())
+		} else if base == Application_Xml || baseMediaType(base) == Application_Xml {
+			RegisterMarshaller(Application_Xml, NewXMLStreamMarshaller())
+		} else if mimeType == Application_Form_UrlEncoded || mimeType == Multipart_FormData {
+			RegisterMarshaller(mimeType, NewFormStreamMarshaller())
+		} else if base == Application_Yaml || baseMediaType(base) == Application_Yaml {
+			RegisterMarshaller(Application_Yaml, NewYAMLStreamMarshaller())
+		} else if base == Application_MsgPack || base == "application/x-msgpack" {
+			RegisterMarshaller(base, NewMsgPackStreamMarshaller())
+		} else if base == Text_Csv {
+			RegisterMarshaller(Text_Csv, NewCSVStreamMarshaller())
+		} else if base == Text_TabSeparatedValues {
+			RegisterMarshaller(Text_TabSeparatedValues, NewTSVStreamMarshaller())
+		} else if mimeType == Text_EventStream {
+			return true // events are written by gorest, the data of each is marshalled as json
 		} else {
 			return false
 		}
@@ -418,15 +569,15 @@ func parseParams(e *EndPointStruct) {
 
 		for pos, str1 := range strings.Split(queryPart, "&") {
 			if strings.HasPrefix(str1, "{") && strings.HasSuffix(str1, "}") {
-				parName, typeName := getVarTypePair(str1, e.Signiture)
+				param := getParamDecl(str1, e.Signiture)
+				param.positionInPath = pos
 
 				for _, par := range e.QueryParams {
-					if par.Name == parName {
-						logger.Error.Fatalln("[fatal]", "Duplicate Query Parameter name(" + parName + ") in REST path: " + e.Signiture)
+					if par.Name == param.Name {
+						logger.Error.Fatalln("[fatal]", "Duplicate Query Parameter name(" + param.Name + ") in REST path: " + e.Signiture)
 					}
 				}
-				//e.QueryParams[len(e.QueryParams)] = Param{pos, parName, typeName}
-				e.QueryParams = append(e.QueryParams, Param{pos, parName, typeName})
+				e.QueryParams = append(e.QueryParams, param)
 			} else {
 				logger.Error.Fatalln("[fatal]", "Please check that your Query Parameters are configured correctly for endpoint: " + e.Signiture)
 			}
@@ -450,7 +601,7 @@ func parseParams(e *EndPointStruct) {
 			if parName == "..." {
 				e.isVariableLength = true
 				parName, typeName := getVarTypePair(str1, e.Signiture)
-				e.Params = append(e.Params, Param{pos, parName, typeName})
+				e.Params = append(e.Params, Param{positionInPath: pos, Name: parName, TypeName: typeName})
 				e.paramLen++
 				break
 			}
@@ -460,7 +611,7 @@ func parseParams(e *EndPointStruct) {
 				}
 			}
 
-			e.Params = append(e.Params, Param{pos, parName, typeName})
+			e.Params = append(e.Params, Param{positionInPath: pos, Name: parName, TypeName: typeName})
 			e.paramLen++
 		} else {
 			e.nonParamPathPart[pos] = str1
@@ -504,6 +655,52 @@ func getVarTypePair(part string, sign string) (parName string, typeName string)
 	return
 }
 
+//Parses a query or form parameter declaration. Besides the name and type, these may be
+//marked as required with a trailing '!' ({email:string!}) or given a default value used
+//when the caller omits them ({age:int=18}).
+func getParamDecl(part string, sign string) Param {
+	var param	Param
+
+	temp := strings.Trim(part, "{}")
+	if ind := strings.Index(temp, "="); ind > -1 {
+		param.Default = temp[ind+1:]
+		temp = temp[:ind]
+	} else if strings.HasSuffix(temp, "!") {
+		param.Required = true
+		temp = strings.TrimSuffix(temp, "!")
+	}
+
+	param.Name, param.TypeName = getVarTypePair(temp, sign)
+
+	return param
+}
+
+//Parses the form tag, a comma separated list of parameter declarations
+//e.g. form:"{email:string!},{age:int=18}"
+func parseFormParams(tag string, sign string) []Param {
+	params := make([]Param, 0)
+
+	for pos := 0; len(strings.TrimSpace(tag)) > 0; pos++ {
+		tag = strings.TrimLeft(tag, " ,")
+		end := strings.Index(tag, "}")
+		if !strings.HasPrefix(tag, "{") || end == -1 {
+			logger.Error.Fatalln("[fatal]", "Please check that your Form Parameters are configured correctly for endpoint: " + sign)
+		}
+
+		param := getParamDecl(tag[:end+1], sign)
+		param.positionInPath = pos
+		for _, par := range params {
+			if par.Name == param.Name {
+				logger.Error.Fatalln("[fatal]", "Duplicate Form Parameter name(" + param.Name + ") in REST path: " + sign)
+			}
+		}
+		params = append(params, param)
+		tag = tag[end+1:]
+	}
+
+	return params
+}
+
 func isAllowedParamType(typeName string) bool {
 	for _, s := range aLLOWED_PAR_TYPES {
 		if s == strings.ToLower(typeName) {
@@ -0,0 +1,539 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//A Patch holds the document sent with a PATCH request, in either the JSON Merge Patch (RFC 7396)
+//or the JSON Patch (RFC 6902) format. Declare an endpoint with postdata:"Patch" to receive one:
+//
+//	type UserService struct {
+//	    gorest.RestService `root:"/users/"`
+//	    patchUser   gorest.EndPoint `method:"PATCH" path:"/{id:string}" postdata:"Patch"`
+//	}
+//	func(serv UserService) PatchUser(patch gorest.Patch, id string) {
+//	    user := loadUser(id)
+//	    if err := patch.Apply(&user); err != nil {
+//	        serv.ResponseBuilder().SetProblem(gorest.NewProblem(422, err.Error()))
+//	        return
+//	    }
+//	    saveUser(user)
+//	}
+//
+//Unless the endpoint declares its own consumes tag, both patch formats are accepted.
+type Patch interface {
+	//Applies the patch to target, which must be a pointer to the current state of the resource.
+	//Fields not mentioned in the patch are left untouched.
+	Apply(target interface{}) error
+	//The media type the patch was sent as
+	MediaType() string
+}
+
+var patchType = reflect.TypeOf((*Patch)(nil)).Elem()
+
+//Creates the Patch for a request body sent with the given media type.
+func newPatch(mimeType string, data []byte) (Patch, error) {
+	if i := strings.Index(mimeType, ";"); i > -1 {
+		mimeType = mimeType[:i]
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	switch mimeType {
+	case Application_JsonPatch_Json:
+		return newJSONPatch(data)
+	case Application_MergePatch_Json, Application_Json:
+		var doc interface{}
+		if err := decodeJSONDocument(data, &doc); err != nil {
+			return nil, err
+		}
+		return &mergePatch{doc}, nil
+	}
+
+	return nil, errors.New("Unsupported patch format " + mimeType)
+}
+
+func decodeJSONDocument(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+//Round trips target through its JSON representation so the patch operations can be applied
+//to the generic document. Fields removed by the patch end up as zero values, fields json leaves out
+//(json:"-" and unexported ones) keep theirs.
+func applyToTarget(target interface{}, apply func(doc interface{}) (interface{}, error)) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("Patch target must be a non-nil pointer")
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err = decodeJSONDocument(current, &doc); err != nil {
+		return err
+	}
+
+	if doc, err = apply(doc); err != nil {
+		return err
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.New(v.Elem().Type())
+	if err = json.Unmarshal(patched, result.Interface()); err != nil {
+		return err
+	}
+	copyJSONFields(v.Elem(), result.Elem())
+	return nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+//Copies the fields of src json writes onto dst, going into nested structs
+func copyJSONFields(dst reflect.Value, src reflect.Value) {
+	t := dst.Type()
+	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		dst.Set(src)
+		return
+	}
+
+	for _, f := range marshalledFields(t, jsonTagKeys, nil) {
+		from := fieldByIndex(src, f.field.Index)
+		if !from.IsValid() {
+			if to := fieldByIndex(dst, f.field.Index); to.IsValid() {
+				to.Set(reflect.Zero(to.Type()))
+			}
+			continue
+		}
+		copyJSONFields(allocFieldByIndex(dst, f.field.Index), from)
+	}
+}
+
+//JSON Merge Patch (RFC 7396)
+type mergePatch struct {
+	doc interface{}
+}
+
+func (this *mergePatch) MediaType() string {
+	return Application_MergePatch_Json
+}
+
+func (this *mergePatch) Apply(target interface{}) error {
+	return applyToTarget(target, func(doc interface{}) (interface{}, error) {
+		return mergeValue(doc, this.doc), nil
+	})
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergeValue(t[key], value)
+		}
+	}
+
+	return t
+}
+
+//JSON Patch (RFC 6902)
+type jsonPatch struct {
+	ops []patchOperation
+}
+
+type patchOperation struct {
+	op       string
+	path     []string
+	from     []string
+	value    interface{}
+	hasValue bool
+}
+
+func newJSONPatch(data []byte) (*jsonPatch, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	patch := new(jsonPatch)
+	for i, item := range raw {
+		var op patchOperation
+		var err error
+		var str string
+
+		if err = json.Unmarshal(item["op"], &op.op); err != nil {
+			return nil, errors.New("Patch operation " + strconv.Itoa(i) + " has no valid op member")
+		}
+		if err = json.Unmarshal(item["path"], &str); err != nil {
+			return nil, errors.New("Patch operation " + strconv.Itoa(i) + " has no valid path member")
+		}
+		if op.path, err = parsePointer(str); err != nil {
+			return nil, err
+		}
+
+		if value, found := item["value"]; found {
+			if err = decodeJSONDocument(value, &op.value); err != nil {
+				return nil, err
+			}
+			op.hasValue = true
+		}
+
+		switch op.op {
+		case "add", "replace", "test":
+			if !op.hasValue {
+				return nil, errors.New("Patch operation " + strconv.Itoa(i) + " (" + op.op + ") requires a value member")
+			}
+		case "move", "copy":
+			if err = json.Unmarshal(item["from"], &str); err != nil {
+				return nil, errors.New("Patch operation " + strconv.Itoa(i) + " (" + op.op + ") requires a from member")
+			}
+			if op.from, err = parsePointer(str); err != nil {
+				return nil, err
+			}
+		case "remove":
+		default:
+			return nil, errors.New("Unknown patch operation: " + op.op)
+		}
+
+		patch.ops = append(patch.ops, op)
+	}
+
+	return patch, nil
+}
+
+func (this *jsonPatch) MediaType() string {
+	return Application_JsonPatch_Json
+}
+
+func (this *jsonPatch) Apply(target interface{}) error {
+	return applyToTarget(target, func(doc interface{}) (interface{}, error) {
+		var err error
+		for _, op := range this.ops {
+			if doc, err = op.apply(doc); err != nil {
+				return nil, err
+			}
+		}
+		return doc, nil
+	})
+}
+
+func (this patchOperation) apply(doc interface{}) (interface{}, error) {
+	switch this.op {
+	case "add":
+		return pointerAdd(doc, this.path, this.value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, this.path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, this.path); err != nil {
+			return nil, err
+		}
+		if len(this.path) == 0 {
+			return this.value, nil
+		}
+		return pointerModify(doc, this.path, func(parent interface{}, key string) (interface{}, error) {
+			switch c := parent.(type) {
+			case map[string]interface{}:
+				c[key] = this.value
+				return c, nil
+			case []interface{}:
+				idx, err := arrayIndex(key, len(c)-1)
+				if err != nil {
+					return nil, err
+				}
+				c[idx] = this.value
+				return c, nil
+			}
+			return nil, errors.New("Patch path not found: " + formatPointer(this.path))
+		})
+	case "move":
+		if isPointerPrefix(this.from, this.path) && len(this.from) != len(this.path) {
+			return nil, errors.New("Can not move a value into one of its children: " + formatPointer(this.from))
+		}
+		doc, value, err := pointerRemove(doc, this.from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, this.path, value)
+	case "copy":
+		value, err := pointerGet(doc, this.from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, this.path, deepCopy(value))
+	case "test":
+		value, err := pointerGet(doc, this.path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(value, this.value) {
+			return nil, errors.New("Patch test failed for " + formatPointer(this.path))
+		}
+		return doc, nil
+	}
+
+	return nil, errors.New("Unknown patch operation: " + this.op)
+}
+
+//JSON Pointer (RFC 6901) helpers
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("Invalid JSON pointer: " + pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(tokens[i], "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	out := ""
+	for _, token := range tokens {
+		out += "/" + strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+	}
+	return out
+}
+
+func isPointerPrefix(prefix []string, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > max || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("Invalid array index in patch path: " + token)
+	}
+	return idx, nil
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	current := doc
+	for _, token := range tokens {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			value, found := c[token]
+			if !found {
+				return nil, errors.New("Patch path not found: " + formatPointer(tokens))
+			}
+			current = value
+		case []interface{}:
+			idx, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = c[idx]
+		default:
+			return nil, errors.New("Patch path not found: " + formatPointer(tokens))
+		}
+	}
+	return current, nil
+}
+
+//Walks to the parent of the last token and hands it to modify. The (possibly new) parent
+//returned by modify is stored back into its own parent, since inserting into or removing
+//from a slice creates a new slice.
+func pointerModify(doc interface{}, tokens []string, modify func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return modify(doc, tokens[0])
+	}
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, found := c[tokens[0]]
+		if !found {
+			return nil, errors.New("Patch path not found: /" + tokens[0])
+		}
+		child, err := pointerModify(child, tokens[1:], modify)
+		if err != nil {
+			return nil, err
+		}
+		c[tokens[0]] = child
+		return c, nil
+	case []interface{}:
+		idx, err := arrayIndex(tokens[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerModify(c[idx], tokens[1:], modify)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = child
+		return c, nil
+	}
+
+	return nil, errors.New("Patch path not found: /" + tokens[0])
+}
+
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return pointerModify(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			c[key] = value
+			return c, nil
+		case []interface{}:
+			idx := len(c)
+			if key != "-" {
+				var err error
+				if idx, err = arrayIndex(key, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[idx+1:], c[idx:])
+			c[idx] = value
+			return c, nil
+		}
+		return nil, errors.New("Patch path not found: " + formatPointer(tokens))
+	})
+}
+
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("Can not remove the root of the document")
+	}
+
+	var removed interface{}
+	doc, err := pointerModify(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			value, found := c[key]
+			if !found {
+				return nil, errors.New("Patch path not found: " + formatPointer(tokens))
+			}
+			removed = value
+			delete(c, key)
+			return c, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[idx]
+			return append(c[:idx], c[idx+1:]...), nil
+		}
+		return nil, errors.New("Patch path not found: " + formatPointer(tokens))
+	})
+
+	return doc, removed, err
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch c := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(c))
+		for k, v := range c {
+			out[k] = deepCopy(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(c))
+		for i := range c {
+			out[i] = deepCopy(c[i])
+		}
+		return out
+	}
+	return value
+}
+
+//Compares two decoded JSON values, treating numbers by value rather than by representation.
+func jsonEqual(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k := range x {
+			if v, found := y[k]; !found || !jsonEqual(x[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	}
+	return a == b
+}
@@ -0,0 +1,137 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"testing"
+)
+
+type patchDoc struct {
+	Name  string            `json:"name"`
+	Age   int               `json:"age"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+	Hash  string            `json:"-"`
+	notes string
+}
+
+func newPatchDoc() patchDoc {
+	return patchDoc{Name: "David", Age: 20, Tags: []string{"a", "b"}, Attrs: map[string]string{"x": "1"}, Hash: "h", notes: "n"}
+}
+
+func TestMergePatch(t *testing.T) {
+	patch, err := newPatch(Application_MergePatch_Json+"; charset=utf-8", []byte(`{"age":21,"attrs":{"x":null,"y":"2"}}`))
+	if err != nil {
+		t.Fatal("Unexpected error creating merge patch:", err)
+	}
+	if patch.MediaType() != Application_MergePatch_Json {
+		t.Error("Expecting merge patch media type, got:", patch.MediaType())
+	}
+
+	doc := newPatchDoc()
+	if err = patch.Apply(&doc); err != nil {
+		t.Fatal("Unexpected error applying merge patch:", err)
+	}
+
+	if doc.Name != "David" || doc.Age != 21 || len(doc.Tags) != 2 {
+		t.Error("Merge patch changed the wrong fields:", doc)
+	}
+	if _, ok := doc.Attrs["x"]; ok || doc.Attrs["y"] != "2" {
+		t.Error("Merge patch did not merge the nested object:", doc.Attrs)
+	}
+	if doc.Hash != "h" || doc.notes != "n" {
+		t.Error("Merge patch cleared the fields json leaves out:", doc)
+	}
+
+	if err = patch.Apply(doc); err == nil {
+		t.Error("Expecting error applying a patch to a non-pointer")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	body := `[
+		{"op":"replace","path":"/name","value":"Dave"},
+		{"op":"add","path":"/tags/-","value":"c"},
+		{"op":"add","path":"/tags/0","value":"z"},
+		{"op":"remove","path":"/tags/1"},
+		{"op":"copy","from":"/name","path":"/attrs/nick"},
+		{"op":"move","from":"/attrs/x","path":"/attrs/y"},
+		{"op":"test","path":"/age","value":20}
+	]`
+
+	patch, err := newPatch(Application_JsonPatch_Json, []byte(body))
+	if err != nil {
+		t.Fatal("Unexpected error creating json patch:", err)
+	}
+
+	doc := newPatchDoc()
+	if err = patch.Apply(&doc); err != nil {
+		t.Fatal("Unexpected error applying json patch:", err)
+	}
+
+	if doc.Name != "Dave" || doc.Age != 20 {
+		t.Error("Json patch gave wrong scalar fields:", doc)
+	}
+	if len(doc.Tags) != 3 || doc.Tags[0] != "z" || doc.Tags[1] != "b" || doc.Tags[2] != "c" {
+		t.Error("Json patch gave wrong tags:", doc.Tags)
+	}
+	if _, ok := doc.Attrs["x"]; ok || doc.Attrs["y"] != "1" || doc.Attrs["nick"] != "Dave" {
+		t.Error("Json patch gave wrong attrs:", doc.Attrs)
+	}
+}
+
+func TestJSONPatchFailure(t *testing.T) {
+	patch, err := newPatch(Application_JsonPatch_Json, []byte(`[{"op":"replace","path":"/name","value":"Dave"},{"op":"test","path":"/age","value":99}]`))
+	if err != nil {
+		t.Fatal("Unexpected error creating json patch:", err)
+	}
+
+	doc := newPatchDoc()
+	if err = patch.Apply(&doc); err == nil {
+		t.Error("Expecting failed test operation to fail the patch")
+	}
+	if doc.Name != "David" {
+		t.Error("Failed patch must leave the target untouched, got:", doc.Name)
+	}
+
+	invalid := []string{
+		`{"op":"add"}`,
+		`[{"op":"bogus","path":"/name"}]`,
+		`[{"op":"add","path":"name","value":1}]`,
+		`[{"op":"add","path":"/name"}]`,
+		`[{"op":"move","path":"/name"}]`,
+	}
+	for _, body := range invalid {
+		if _, err := newPatch(Application_JsonPatch_Json, []byte(body)); err == nil {
+			t.Error("Expecting error for invalid patch document:", body)
+		}
+	}
+
+	if _, err := newPatch(Application_Xml, []byte(`<a/>`)); err == nil {
+		t.Error("Expecting error for unsupported patch format")
+	}
+}
@@ -0,0 +1,190 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+//Signiture of functions used to check the If-Match precondition of an endpoint tagged
+//precondition:"required" checker:"name". Given the path arguments of the request, a
+//VersionChecker returns the current entity tag of the resource, or "" if it does not exist.
+//Use ResponseBuilder.ETagFor to compute the same tag gorest generates for GET responses (etag:"true"):
+//
+//	gorest.RegisterVersionChecker("user", func(args map[string]string, rb *gorest.ResponseBuilder) string {
+//	    user, found := users[args["id"]]
+//	    if !found {
+//	        return ""
+//	    }
+//	    etag, _ := rb.ETagFor(user, gorest.Application_Json)
+//	    return etag
+//	})
+type VersionChecker func(map[string]string, *ResponseBuilder) string
+
+var versionCheckers map[string]VersionChecker
+
+//Registers a VersionChecker under the specified name
+func RegisterVersionChecker(name string, checker VersionChecker) {
+	if versionCheckers == nil {
+		versionCheckers = make(map[string]VersionChecker, 0)
+	}
+
+	if _, found := versionCheckers[name]; !found {
+		versionCheckers[name] = checker
+	}
+}
+
+//Returns the registered VersionChecker for the specified name
+func GetVersionChecker(name string) (c VersionChecker) {
+	if versionCheckers == nil {
+		versionCheckers = make(map[string]VersionChecker, 0)
+	}
+	c, _ = versionCheckers[name]
+	return
+}
+
+//Computes the entity tag of v as gorest does for GET responses of the mime type, so tags
+//sent to clients can be compared with the current version of a resource. Services with
+//JSONOptions render their json differently, use ResponseBuilder.ETagFor for them.
+func ETagFor(v interface{}, mimeType string) (string, error) {
+	return etagFor(v, mimeType, JSONOptions{})
+}
+
+//Computes the entity tag of v as ETagFor does, rendering json with the JSONOptions of the service
+//being served
+func (this *ResponseBuilder) ETagFor(v interface{}, mimeType string) (string, error) {
+	return etagFor(v, mimeType, this.ctx.jsonOptions)
+}
+
+func etagFor(v interface{}, mimeType string, options JSONOptions) (string, error) {
+	reader, err := interfaceToBytes(options.entity(v, mimeType), mimeType)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return computeETag(mimeType, data), nil
+}
+
+//The If-Match precondition of a request. Service methods of endpoints tagged precondition:"required"
+//without a checker declare it as a trailing argument and check the current version themselves:
+//
+//	func(serv UserService) PutUser(user User, id string, pre gorest.Precondition) error {
+//	    if err := pre.Check(currentETag(id)); err != nil {
+//	        return err
+//	    }
+//	    ...
+//	}
+type Precondition struct {
+	IfMatch []string // the entity tags listed by the client, or "*"
+}
+
+var preconditionType = reflect.TypeOf(Precondition{})
+
+func init() {
+	registerInjector(preconditionType, func(rb *ResponseBuilder, ep EndPointStruct) reflect.Value {
+		return reflect.ValueOf(newPrecondition(rb.ctx.request.Header.Get("If-Match")))
+	})
+}
+
+func newPrecondition(ifMatch string) Precondition {
+	var pre Precondition
+	for _, item := range strings.Split(ifMatch, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			pre.IfMatch = append(pre.IfMatch, item)
+		}
+	}
+	return pre
+}
+
+//Whether the current entity tag of the resource satisfies the precondition. If-Match uses
+//strong comparison, so weak tags never match; the -gzip and -deflate variants gorest sends for
+//compressed responses match their uncompressed tag. An empty etag means the resource does not exist.
+func (this Precondition) Matches(etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = normalizeETag(etag)
+
+	for _, item := range this.IfMatch {
+		if item == "*" {
+			return true
+		}
+		if strings.HasPrefix(item, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if normalizeETag(item) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns a 412 Precondition Failed problem unless the precondition matches etag
+func (this Precondition) Check(etag string) error {
+	if this.Matches(etag) {
+		return nil
+	}
+	return NewProblem(http.StatusPreconditionFailed, "The resource has been modified, If-Match does not match its current version")
+}
+
+//Quotes the tag and drops the -gzip or -deflate suffix of compressed representations
+func normalizeETag(etag string) string {
+	etag = quoteETag(etag)
+	for _, suffix := range []string{"-gzip\"", "-deflate\""} {
+		if strings.HasSuffix(etag, suffix) {
+			etag = strings.TrimSuffix(etag, suffix) + "\""
+		}
+	}
+	return etag
+}
+
+//Enforces the If-Match precondition of the endpoint: 428 if it is missing, 412 if the
+//registered checker reports a different version
+func checkPrecondition(rb *ResponseBuilder, ep EndPointStruct, args map[string]string) *Problem {
+	ifMatch := rb.ctx.request.Header.Get("If-Match")
+	if ifMatch == "" {
+		return NewProblem(http.StatusPreconditionRequired, "This request requires an If-Match header with the current entity tag of the resource")
+	}
+
+	if ep.versionChecker == "" {
+		return nil // checked by the service method
+	}
+
+	if !newPrecondition(ifMatch).Matches(GetVersionChecker(ep.versionChecker)(args, rb)) {
+		return NewProblem(http.StatusPreconditionFailed, "The resource has been modified, If-Match does not match its current version")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type preconditionUser struct {
+	Id   string
+	Name string
+}
+
+func TestPreconditionMatches(t *testing.T) {
+	etag := computeETag(Application_Json, []byte(`{"Id":"1"}`))
+
+	if !newPrecondition(etag).Matches(etag) {
+		t.Error("Expecting identical tags to match")
+	}
+	if !newPrecondition(`"other", ` + etag).Matches(etag) {
+		t.Error("Expecting a tag in the list to match")
+	}
+	if !newPrecondition("*").Matches(etag) || newPrecondition("*").Matches("") {
+		t.Error("Expecting * to match any existing resource only")
+	}
+	if !newPrecondition(etag[:len(etag)-1] + `-gzip"`).Matches(etag) {
+		t.Error("Expecting the gzip variant to match its uncompressed tag")
+	}
+	if newPrecondition("W/" + etag).Matches(etag) || newPrecondition(etag).Matches("W/"+etag) {
+		t.Error("Weak tags must never match with strong comparison")
+	}
+
+	err := newPrecondition(`"stale"`).Check(etag)
+	if p, ok := err.(*Problem); !ok || p.Status != http.StatusPreconditionFailed {
+		t.Error("Expecting a 412 problem, got:", err)
+	}
+	if newPrecondition(etag).Check(etag) != nil {
+		t.Error("Expecting a matching precondition to pass")
+	}
+}
+
+func TestETagForRoundTrip(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	user := preconditionUser{Id: "1", Name: "Ann"}
+	etag, err := ETagFor(user, Application_Json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != computeETag(Application_Json, []byte(`{"Id":"1","Name":"Ann"}`)) {
+		t.Error("Expecting the etag gorest generates for GET responses, got:", etag)
+	}
+}
+
+func TestCheckPrecondition(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	RegisterVersionChecker("precondition-test", func(args map[string]string, rb *ResponseBuilder) string {
+		if args["id"] != "1" {
+			return ""
+		}
+		etag, _ := ETagFor(preconditionUser{Id: "1", Name: "Ann"}, Application_Json)
+		return etag
+	})
+	current, _ := ETagFor(preconditionUser{Id: "1", Name: "Ann"}, Application_Json)
+	ep := EndPointStruct{PreconditionRequired: true, versionChecker: "precondition-test"}
+
+	check := func(ifMatch string, id string) *Problem {
+		req, _ := http.NewRequest("PUT", "/users/"+id, nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rb := &ResponseBuilder{&Context{request: req}}
+		return checkPrecondition(rb, ep, map[string]string{"id": id})
+	}
+
+	if p := check("", "1"); p == nil || p.Status != http.StatusPreconditionRequired {
+		t.Error("Expecting 428 without If-Match, got:", p)
+	}
+	if p := check(`"stale"`, "1"); p == nil || p.Status != http.StatusPreconditionFailed {
+		t.Error("Expecting 412 for a stale tag, got:", p)
+	}
+	if p := check("*", "2"); p == nil || p.Status != http.StatusPreconditionFailed {
+		t.Error("Expecting 412 for a missing resource, got:", p)
+	}
+	if p := check(current, "1"); p != nil {
+		t.Error("Expecting the current tag to pass, got:", p)
+	}
+}
+
+func TestInjectedPrecondition(t *testing.T) {
+	meth := reflect.TypeOf(func(serv interface{}, user preconditionUser, id string, pre Precondition) {})
+	if numInjected(meth) != 1 || !IsInjectedType(preconditionType) || IsInjectedType(meth.In(1)) {
+		t.Fatal("Expecting only the trailing Precondition to be injected")
+	}
+	if !declaresInjected(meth, preconditionType) || declaresInjected(reflect.TypeOf(func(serv interface{}, id string) {}), preconditionType) {
+		t.Error("Expecting the Precondition argument to be found only when declared")
+	}
+
+	req, _ := http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("If-Match", `"a", "b"`)
+	rb := &ResponseBuilder{&Context{request: req}}
+
+	args := appendInjected(nil, meth, rb, EndPointStruct{})
+	if len(args) != 1 || !reflect.DeepEqual(args[0].Interface(), Precondition{IfMatch: []string{`"a"`, `"b"`}}) {
+		t.Error("Expecting the If-Match tags to be injected, got:", args)
+	}
+}
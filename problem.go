@@ -0,0 +1,245 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+//A Problem describes an error in the format of RFC 7807 (Problem Details for HTTP APIs).
+//All of gorest's own error responses are sent as problems, and service methods may report
+//their own by returning one as a trailing error result, by panicking with one, or by
+//passing one to ResponseBuilder.SetProblem:
+//
+//	func(serv UserService) GetUser(id string) (User, error) {
+//	    user, found := users[id]
+//	    if !found {
+//	        return user, gorest.NewProblem(404, "No user with id " + id).With("id", id)
+//	    }
+//	    return user, nil
+//	}
+type Problem struct {
+	Type       string                 // URI identifying the problem type, defaults to about:blank
+	Title      string                 // short summary of the problem type
+	Status     int                    // http status code
+	Detail     string                 // explanation specific to this occurrence of the problem
+	Instance   string                 // URI identifying this occurrence of the problem
+	Extensions map[string]interface{} // additional members
+}
+
+//Creates a Problem for the http status code, titled with the standard status text
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+//Adds an extension member to the Problem
+func (this *Problem) With(key string, value interface{}) *Problem {
+	if this.Extensions == nil {
+		this.Extensions = make(map[string]interface{})
+	}
+	this.Extensions[key] = value
+	return this
+}
+
+func (this *Problem) Error() string {
+	if this.Detail == "" {
+		return this.Title
+	}
+	return this.Title + ": " + this.Detail
+}
+
+func (this *Problem) members() []problemMember {
+	members := make([]problemMember, 0, 5+len(this.Extensions))
+	if this.Type != "" {
+		members = append(members, problemMember{"type", this.Type})
+	}
+	if this.Title != "" {
+		members = append(members, problemMember{"title", this.Title})
+	}
+	if this.Status != 0 {
+		members = append(members, problemMember{"status", this.Status})
+	}
+	if this.Detail != "" {
+		members = append(members, problemMember{"detail", this.Detail})
+	}
+	if this.Instance != "" {
+		members = append(members, problemMember{"instance", this.Instance})
+	}
+
+	keys := make([]string, 0, len(this.Extensions))
+	for key := range this.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		members = append(members, problemMember{key, this.Extensions[key]})
+	}
+
+	return members
+}
+
+type problemMember struct {
+	name  string
+	value interface{}
+}
+
+//Extension members are written alongside the standard ones
+func (this *Problem) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, member := range this.members() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(member.name)
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+//Written as the problem element of the urn:ietf:rfc:7807 namespace
+func (this *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, member := range this.members() {
+		elem := xml.StartElement{Name: xml.Name{Local: member.name}}
+		if err := e.EncodeElement(member.value, elem); err != nil {
+			// values xml can not represent (e.g. maps) are written as text
+			if err = e.EncodeElement(fmt.Sprint(member.value), elem); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+//A ProblemFormatter renders a Problem for the client. It is given the Accept header of the
+//request and returns the Content-Type and body of the response.
+type ProblemFormatter func(p *Problem, accept string) (string, []byte)
+
+var problemFormatter ProblemFormatter = formatProblem
+
+//Replaces the formatter used to render problems, for services with their own error envelope.
+//Passing nil restores the default RFC 7807 formatter.
+func RegisterProblemFormatter(f ProblemFormatter) {
+	if f == nil {
+		f = formatProblem
+	}
+	problemFormatter = f
+}
+
+//Problems are negotiated as their own types, or the json and xml they are written in
+var problemMimes = []string{Application_Problem_Json, Application_Problem_Xml, Application_Json, Application_Xml}
+
+//The default formatter: application/problem+xml when the client prefers xml, otherwise
+//application/problem+json
+func formatProblem(p *Problem, accept string) (string, []byte) {
+	if mime, _ := negotiateMime(accept, problemMimes); mime == Application_Problem_Xml || mime == Application_Xml {
+		if data, err := xml.Marshal(p); err == nil {
+			return Application_Problem_Xml, append([]byte(xml.Header), data...)
+		}
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		data, _ = json.Marshal(NewProblem(p.Status, p.Detail))
+	}
+	return Application_Problem_Json, data
+}
+
+//Sets the response to the Problem, replacing any entity prepared for the response.
+//The problem is rendered by the registered ProblemFormatter when the response is written.
+//The problem is copied, so problems declared once can be shared between requests. Problems
+//without a valid Status, like a Problem literal giving only a Detail, are sent as 500.
+func (this *ResponseBuilder) SetProblem(p *Problem) *ResponseBuilder {
+	copied := *p
+	p = &copied
+	if p.Status < 100 || p.Status > 999 {
+		p.Status = http.StatusInternalServerError
+		if p.Title == "" {
+			p.Title = http.StatusText(p.Status)
+		}
+	}
+	if p.Instance == "" && this.ctx.request != nil {
+		p.Instance = this.ctx.request.URL.Path
+	}
+	this.ctx.problem = p
+	this.ctx.respPacket = nil
+	this.SetResponseCode(p.Status)
+	this.SetResponseMsg(p.Detail)
+	return this
+}
+
+//Renders the pending problem into the response packet
+func (this *ResponseBuilder) formatProblem() {
+	contentType, data := problemFormatter(this.ctx.problem, this.ctx.request.Header.Get("Accept"))
+	this.SetContentType(contentType)
+	this.ctx.respPacket = newBytesPacket(data)
+}
+
+//Converts a value recovered from a panic, or an error returned by a service method, into a Problem.
+//Errors wrapping a *Problem are rendered as that problem; other errors are not exposed to the client.
+func toProblem(v interface{}) *Problem {
+	switch p := v.(type) {
+	case Problem:
+		return &p
+	case error:
+		var problem *Problem
+		if errors.As(p, &problem) && problem != nil {
+			return problem
+		}
+	}
+
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+//Service methods may declare a trailing error result, after any output
+func hasErrorResult(methType reflect.Type) bool {
+	return methType.NumOut() > 0 && methType.Out(methType.NumOut()-1) == errorType
+}
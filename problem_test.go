@@ -0,0 +1,146 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemMarshal(t *testing.T) {
+	p := NewProblem(http.StatusNotFound, "No user with id 7").With("id", "7")
+	p.Instance = "/users/7"
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal("Unexpected error marshalling problem:", err)
+	}
+	expected := `{"type":"about:blank","title":"Not Found","status":404,"detail":"No user with id 7","instance":"/users/7","id":"7"}`
+	if string(data) != expected {
+		t.Error("Problem json marshal, expecting:", expected, "got:", string(data))
+	}
+
+	contentType, body := formatProblem(p, "application/xml, application/json;q=0.5")
+	if contentType != Application_Problem_Xml {
+		t.Error("Expecting problem+xml for xml Accept, got:", contentType)
+	}
+	if !strings.Contains(string(body), `<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Not Found</title><status>404</status>`) ||
+		!strings.Contains(string(body), `<id>7</id></problem>`) {
+		t.Error("Problem xml marshal gave:", string(body))
+	}
+
+	if contentType, _ = formatProblem(p, ""); contentType != Application_Problem_Json {
+		t.Error("Expecting problem+json by default, got:", contentType)
+	}
+	for _, accept := range []string{"application/xhtml+xml, application/json", "application/xml;q=0.2, */*", "application/problem+json, application/xml;q=0.9"} {
+		if contentType, _ = formatProblem(p, accept); contentType != Application_Problem_Json {
+			t.Error("Expecting problem+json for", accept, "got:", contentType)
+		}
+	}
+
+	if p.Error() != "Not Found: No user with id 7" {
+		t.Error("Problem error string gave:", p.Error())
+	}
+}
+
+func TestToProblem(t *testing.T) {
+	p := NewProblem(http.StatusConflict, "exists")
+	if toProblem(p) != p {
+		t.Error("Expecting the same problem back")
+	}
+	if toProblem(*p).Status != http.StatusConflict {
+		t.Error("Expecting problem value to be converted")
+	}
+	if q := toProblem(errors.New("db password is hunter2")); q.Status != http.StatusInternalServerError || q.Detail != "" {
+		t.Error("Plain errors must become an opaque 500, got:", q)
+	}
+	if toProblem(fmt.Errorf("saving user: %w", p)) != p {
+		t.Error("Expecting the problem wrapped in an error")
+	}
+	var missing *Problem
+	if q := toProblem(missing); q == nil || q.Status != http.StatusInternalServerError {
+		t.Error("Expecting a nil problem to become a 500, got:", q)
+	}
+}
+
+func TestProblemWithoutStatus(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/7", nil)
+	rec := httptest.NewRecorder()
+
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetProblem(toProblem(Problem{Detail: "no status"})).WritePacket()
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Error("Expecting a problem without status to be sent as 500, got:", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"status":500`) || !strings.Contains(rec.Body.String(), `"title":"Internal Server Error"`) {
+		t.Error("Expecting the problem to carry the 500 status, got:", rec.Body.String())
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users/7", nil)
+	rec := httptest.NewRecorder()
+
+	rb := &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	shared := NewProblem(http.StatusNotFound, "gone")
+	rb.SetProblem(shared).WritePacket()
+
+	if rec.Code != http.StatusNotFound {
+		t.Error("Expecting 404, got:", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != Application_Problem_Json {
+		t.Error("Expecting problem+json content type, got:", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"instance":"/users/7"`) {
+		t.Error("Expecting the request path as problem instance, got:", rec.Body.String())
+	}
+	if shared.Instance != "" {
+		t.Error("Expecting the shared problem to be left untouched, got instance:", shared.Instance)
+	}
+
+	RegisterProblemFormatter(func(p *Problem, accept string) (string, []byte) {
+		return Text_Plain, []byte(p.Error())
+	})
+	defer RegisterProblemFormatter(nil)
+
+	rec = httptest.NewRecorder()
+	rb = &ResponseBuilder{&Context{writer: rec, request: req}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.SetProblem(NewProblem(http.StatusBadRequest, "bad")).WritePacket()
+
+	if rec.Header().Get("Content-Type") != Text_Plain || rec.Body.String() != "Bad Request: bad" {
+		t.Error("Custom problem formatter not used, got:", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
@@ -59,9 +59,9 @@ package gorest
 
 import (
 	"bytes"
-	"io"
 	"github.com/rmullinnix/logger"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strings"
 )
@@ -133,6 +133,18 @@ func mapFieldsToMethods(t reflect.Type, f reflect.StructField, typeFullName stri
 			ep.allowGzip = 1
 		}
 	}
+	// and for etag
+	if ep.allowETag == 2 {
+		if !serviceRoot.allowETag {
+			ep.allowETag = 0
+		} else {
+			ep.allowETag = 1
+		}
+	}
+	// collections are wrapped in the xml root of the service, unless the endpoint names its own
+	if ep.XMLRoot == "" && (ep.OutputTypeIsArray || ep.OutputTypeIsMap || ep.OutputTypeIsStream) {
+		ep.XMLRoot = serviceRoot.XMLRoot
+	}
 
 	var method reflect.Method
 	methodName := strings.ToUpper(f.Name[:1]) + f.Name[1:]
@@ -156,6 +168,9 @@ func mapFieldsToMethods(t reflect.Type, f reflect.StructField, typeFullName stri
 		if !isLegalForRequestType(method.Type, ep) {
 			logger.Error.Panicln("[fatal] Parameter list not matching. " + panicMethNotFound(methFound, ep, t, f, methodName))
 		}
+		if ep.PreconditionRequired && ep.versionChecker == "" && !declaresInjected(method.Type, preconditionType) {
+			logger.Error.Fatalln("[fatal]", "Endpoint tagged precondition:\"required\" needs a 'checker' tag or a trailing gorest.Precondition argument to check If-Match against: " + ep.Signiture)
+		}
 	}
 
 	ep.MethodNumberInParent = methodNumberInParent
@@ -181,7 +196,15 @@ func isLegalForRequestType(methType reflect.Type, ep EndPointStruct) bool {
 		startParam = 2
 	}
 
-	if (methType.NumIn() - startParam) != (ep.paramLen + len(ep.QueryParams)) {
+	//WebSocket handlers take the connection first and return nothing
+	if ep.RequestMethod == WS {
+		if methType.NumIn() < 2 || methType.In(1) != wsConnType || methType.NumOut() > 0 {
+			return false
+		}
+		startParam = 2
+	}
+
+	if (methType.NumIn() - startParam - numInjected(methType)) != (ep.paramLen + len(ep.QueryParams) + len(ep.FormParams)) {
 		return false
 	}
 
@@ -189,14 +212,14 @@ func isLegalForRequestType(methType reflect.Type, ep EndPointStruct) bool {
 	if len(ep.PostdataType) > 0 {
 		startParam++
 		methVal := methType.In(1)
-		if ep.postdataTypeIsArray {
+		if ep.PostdataTypeIsArray {
 			if methVal.Kind() == reflect.Slice {
 				methVal = methVal.Elem()
 			} else {
 				return false
 			}
 		}
-		if ep.postdataTypeIsMap {
+		if ep.PostdataTypeIsMap {
 			if methVal.Kind() == reflect.Map {
 				methVal = methVal.Elem()
 			} else {
@@ -211,7 +234,7 @@ func isLegalForRequestType(methType reflect.Type, ep EndPointStruct) bool {
 	//Check the rest of input path param types
 	i := startParam
 	if ep.isVariableLength {
-		if methType.NumIn() != startParam+1+len(ep.QueryParams) {
+		if methType.NumIn() != startParam+1+len(ep.QueryParams)+len(ep.FormParams)+numInjected(methType) {
 			return false
 		}
 
@@ -239,10 +262,48 @@ func isLegalForRequestType(methType reflect.Type, ep EndPointStruct) bool {
 		}
 		j++
 	}
-	//Check output param type.
-	if methType.NumOut() > 0 {
+
+	//Check the input Form param types
+	for j := 0; i < methType.NumIn() && (j < len(ep.FormParams)); i++ {
+		if ep.FormParams[j].TypeName[:2] == "[]" {
+			if methType.In(i).Elem().String() != ep.FormParams[j].TypeName[2:] {
+				return false
+			}
+		} else if !typeNamesEqual(methType.In(i), ep.FormParams[j].TypeName) {
+			return false
+		}
+		j++
+	}
+	//Check output param type, ignoring any trailing error result
+	numOut := methType.NumOut()
+	if hasErrorResult(methType) {
+		numOut--
+	}
+	if numOut > 1 {
+		return false
+	}
+	//Paginated methods return a Page of the declared output items
+	if ep.Pagination != nil {
+		return numOut == 1 && methType.Out(0) == pageType
+	}
+	if numOut > 0 {
 		methVal := methType.Out(0)
 
+		if ep.OutputTypeIsEvents {
+			return methVal.Implements(eventSourceType)
+		}
+		if ep.OutputTypeIsBinary {
+			return isBinaryType(methVal)
+		}
+		if ep.OutputTypeIsStream {
+			if methVal == iteratorType {
+				return true // items are only known at runtime
+			} else if methVal.Kind() == reflect.Chan && methVal.ChanDir()&reflect.RecvDir != 0 {
+				methVal = methVal.Elem()
+			} else {
+				return false
+			}
+		}
 		if ep.OutputTypeIsArray {
 			if methVal.Kind() == reflect.Slice {
 				methVal = methVal.Elem() //Only convert if it is mentioned as a slice in the tags, otherwise allow for failure panic
@@ -287,10 +348,10 @@ func panicMethNotFound(methFound bool, ep EndPointStruct, t reflect.Type, f refl
 	if ep.OutputTypeIsMap {
 		isArr = "map[string]"
 	}
-	if ep.postdataTypeIsArray {
+	if ep.PostdataTypeIsArray {
 		postIsArr = "[]"
 	}
-	if ep.postdataTypeIsMap {
+	if ep.PostdataTypeIsMap {
 		postIsArr = "map[string]"
 	}
 	var suffix string = "(" + isArr + ep.OutputType + ")# with one(" + isArr + ep.OutputType + ") return parameter."
@@ -304,6 +365,16 @@ func panicMethNotFound(methFound bool, ep EndPointStruct, t reflect.Type, f refl
 	if ep.RequestMethod == POST || ep.RequestMethod == PUT || ep.RequestMethod == DELETE {
 		suffix = "# with no return parameters."
 	}
+	if ep.Pagination != nil {
+		suffix = "(gorest.Page)# with one(gorest.Page) return parameter holding the " + isArr + ep.OutputType + " items."
+	}
+	if ep.RequestMethod == WS {
+		str = "conn *gorest.WSConn"
+		if ep.paramLen > 0 {
+			str += ", "
+		}
+		suffix = "# with no return parameters."
+	}
 	if ep.isVariableLength {
 		str += "varArgs ..." + ep.Params[0].TypeName + ","
 	} else {
@@ -330,24 +401,73 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 
 	//Set the Context; the user can get the context from her services function param
 	servVal.FieldByName("RestService").FieldByName("Context").Set(reflect.ValueOf(rb.ctx))
+	rb.ctx.encodeGzip = ep.allowGzip == 1
+	rb.ctx.compression = &servMeta.compression
+	rb.ctx.jsonOptions = servMeta.JSONOptions
+	if rb.ctx.encodeGzip {
+		rb.addVary("Accept-Encoding")
+	}
+	rb.ctx.autoETag = ep.allowETag == 1
+	rb.setCacheHeaders(ep)
+
+	//The response mime type is known before the call, so methods writing their own response (e.g. LongPoll) can use it
+	produceMime, acceptable := negotiateProduces(rb.ctx.request.Header.Get("Accept"), ep, servMeta)
+	available := producedMimes(ep, servMeta)
+	hasOutput := (ep.OutputType != "" || ep.OutputTypeIsEvents || ep.OutputTypeIsBinary) && ep.RequestMethod != WS
+	if hasOutput && (len(available) > 1 || !acceptable) {
+		rb.addVary("Accept")
+	}
+	if _, isJSON := marshallerFor(produceMime).(jsonMarshaller); isJSON && hasOutput {
+		rb.addVary("X-Pretty")
+	}
+	rb.ctx.produceMime = produceMime
+
+	//Changes through the api drop the responses cached for the resource
+	if method := rb.ctx.request.Method; method != GET && method != HEAD && method != OPTIONS {
+		defer func() {
+			if rb.ctx.problem == nil {
+				invalidateCachePath(rb.ctx.request.URL.Path)
+			}
+		}()
+	}
 
 	//Check Authorization
 
 	if ep.SecurityScheme != nil {
-		authorized := false
-		for key, scopes := range ep.SecurityScheme {
-			alteredScopes := make([]string, len(scopes))
-			for i := range scopes {
-				alteredScopes[i] = replaceScopeKey(scopes[i], args)
-			}
-			authorized = GetAuthorizer(key)(rb.ctx.xsrftoken, key, alteredScopes, rb.ctx.request.Method, rb)
-			if authorized {
-				break
-			}
+		if problem := authorize(rb, ep, args); problem != nil {
+			rb.SetProblem(problem)
+			return
 		}
-		if !authorized {
-			// authorizer should log failure reason
-			rb.SetResponseCode(401)
+	}
+
+	//Authorized requests accepting none of the types of the output are refused before any work is done
+	if hasOutput && !acceptable {
+		rb.SetProblem(NewProblem(http.StatusNotAcceptable, "Acceptable types are: " + strings.Join(available, ", ")).With("available", available))
+		return
+	}
+
+	//Optimistic concurrency, checked before the request body is read
+	if ep.PreconditionRequired {
+		if problem := checkPrecondition(rb, ep, args); problem != nil {
+			rb.SetProblem(problem)
+			return
+		}
+	}
+
+	//The requested page is validated before the method is called
+	if ep.Pagination != nil {
+		var problem	*Problem
+		if rb.ctx.pageRequest, problem = parsePageRequest(rb.ctx.request.URL.Query(), ep.Pagination); problem != nil {
+			rb.SetProblem(problem)
+			return
+		}
+	}
+
+	//Responses held in the server side cache are served without calling the method
+	cacheKeyFound := false
+	var key		string
+	if ep.serverCache.ttl > 0 {
+		if key, cacheKeyFound = cacheKey(rb, ep, rb.ctx.produceMime); cacheKeyFound && rb.serveCached(key) {
 			return
 		}
 	}
@@ -362,40 +482,82 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 		contentType = servMeta.ConsumesMime[0]
 	}
 
-	valid, mime := validMime(contentType, ep.ConsumesMime, servMeta.ConsumesMime)
-	if !valid {
-		if len(ep.PostdataType) > 0 {
-			// error - can not accept request
-			logger.Error.Println("[gen] service is not configured to accept Content-Type " + contentType)
-			rb.SetResponseCode(http.StatusBadRequest)
-			rb.SetResponseMsg("Service is not configured to accept Content-Type " + contentType)
+	mime, valid, err := negotiateConsumes(contentType, ep, servMeta)
+	if !valid && (len(ep.PostdataType) > 0 || len(ep.FormParams) > 0) {
+		if err != nil {
+			rb.SetProblem(NewProblem(http.StatusBadRequest, "Invalid Content-Type " + contentType + ": " + err.Error()))
 			return
 		}
+
+		// error - can not accept request, the Accept header lists what can be (RFC 7694)
+		logger.Error.Println("[gen] service is not configured to accept Content-Type " + contentType)
+		accepted := consumedMimes(ep, servMeta)
+		rb.writer().Header().Set("Accept", strings.Join(accepted, ", "))
+		rb.SetProblem(NewProblem(http.StatusUnsupportedMediaType, "Service is not configured to accept Content-Type " + contentType).With("accepted", accepted))
+		return
 	}
 
 	//For POST and PUT, make and add the first "postdata" argument to the argument list
 	if len(ep.PostdataType) > 0 {
-
-		//Get postdata here
-		//TODO: Also check if this is a multipart post and handle as required.
-		buf := new(bytes.Buffer)
-		io.Copy(buf, rb.ctx.request.Body)
-		body := buf.String()
-
-		//println("This is the body of the post:",body)
-
-		if v, valid := makeArg(body, targetMethod.Type.In(1), mime); valid {
+		argType := targetMethod.Type.In(1)
+		marshaller := servMeta.JSONOptions.requestMarshaller(marshallerFor(mime))
+
+		if marshaller != nil && argType != patchType && isEntityKind(argType.Kind()) {
+			//Structured postdata is decoded as it is read from the body, decoding any Content-Encoding
+			v, code, err := decodeRequestBody(rb.ctx.request, argType, marshaller)
+			if err != nil {
+				logger.Error.Println("[gen] Error Unmarshalling data using " + mime + ". (" + err.Error() + ")")
+				if code == http.StatusBadRequest {
+					rb.SetProblem(NewProblem(code, "Error unmarshalling data using " + mime))
+				} else {
+					rb.SetProblem(NewProblem(code, err.Error()))
+				}
+				return
+			}
 			arrArgs = append(arrArgs, v)
 		} else {
-			rb.SetResponseCode(http.StatusBadRequest)
-			rb.SetResponseMsg("Error unmarshalling data using " + mime)
+			//Get postdata here, decoding any Content-Encoding (gzip, deflate) applied by the client
+			//TODO: Also check if this is a multipart post and handle as required.
+			data, code, err := readRequestBody(rb.ctx.request)
+			if err != nil {
+				logger.Error.Println("[gen] could not read request body: " + err.Error())
+				rb.SetProblem(NewProblem(code, err.Error()))
+				return
+			}
+			body := string(data)
+
+			if argType == patchType {
+				patch, err := newPatch(mime, data)
+				if err != nil {
+					logger.Error.Println("[gen] invalid patch document: " + err.Error())
+					rb.SetProblem(NewProblem(http.StatusBadRequest, "Invalid patch document: " + err.Error()))
+					return
+				}
+				arrArgs = append(arrArgs, reflect.ValueOf(&patch).Elem())
+			} else if v, valid := makeArg(body, argType, mime); valid {
+				arrArgs = append(arrArgs, v)
+			} else {
+				rb.SetProblem(NewProblem(http.StatusBadRequest, "Error unmarshalling data using " + mime))
+				return
+			}
+		}
+	}
+
+	//Form fields are bound to the arguments following the query parameters
+	var formArgs	url.Values
+	if len(ep.FormParams) > 0 {
+		var code	int
+		var err		error
+		if formArgs, code, err = readFormArgs(rb.ctx.request); err != nil {
+			logger.Error.Println("[gen] could not read form: " + err.Error())
+			rb.SetProblem(NewProblem(code, err.Error()))
 			return
 		}
 	}
 
 	if len(args) == ep.paramLen || (ep.isVariableLength && ep.paramLen == 1) {
 		startIndex := 1
-		if len(ep.PostdataType) > 0 {
+		if len(ep.PostdataType) > 0 || ep.RequestMethod == WS {
 			startIndex = 2
 		}
 
@@ -407,8 +569,7 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 				if v, valid := makeArg(dat, targetMethod.Type.In(startIndex).Elem(), mime); valid {
 					varSliceArgs = reflect.Append(varSliceArgs, v)
 				} else {
-					rb.SetResponseCode(http.StatusBadRequest)
-					rb.SetResponseMsg("Error unmarshalling data using " + mime)
+					rb.SetProblem(NewProblem(http.StatusBadRequest, "Error unmarshalling data using " + mime))
 					return
 				}
 			}
@@ -425,8 +586,7 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 				if v, valid := makeArg(dat, targetMethod.Type.In(startIndex), mime); valid {
 					arrArgs = append(arrArgs, v)
 				} else {
-					rb.SetResponseCode(http.StatusBadRequest)
-					rb.SetResponseMsg("Error unmarshalling data using " + mime)
+					rb.SetProblem(NewProblem(http.StatusBadRequest, "Error unmarshalling data using " + mime))
 					return
 				}
 				startIndex++
@@ -434,25 +594,67 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 
 		}
 
-		//Query arguments are not compulsory on query, so the caller may ommit them, in which case we send a zero value f its type to the method.
+		//Query arguments are not compulsory on query, so the caller may ommit them, in which case we send the default or a zero value of its type to the method.
 		//Also they may be sent through in any order.
 		for _, par := range ep.QueryParams {
-			dat := ""
-			if str, found := queryArgs[par.Name]; found {
-				dat = str
+			dat, err := paramValue(par, queryArgs)
+			if err != nil {
+				rb.SetProblem(NewProblem(http.StatusBadRequest, err.Error()))
+				return
 			}
 
 			if v, valid := makeArg(dat, targetMethod.Type.In(startIndex), mime); valid {
 				arrArgs = append(arrArgs, v)
 			} else {
-				rb.SetResponseCode(http.StatusBadRequest)
-				rb.SetResponseMsg("Error unmarshalling data using " + mime)
+				rb.SetProblem(NewProblem(http.StatusBadRequest, "Error unmarshalling data using " + mime))
 				return
 			}
 
 			startIndex++
 		}
 
+		//Form values are plain text, a repeated field giving the items of a slice
+		for _, par := range ep.FormParams {
+			vals, err := formParamValues(par, formArgs)
+			if err != nil {
+				rb.SetProblem(NewProblem(http.StatusBadRequest, err.Error()))
+				return
+			}
+
+			argType := targetMethod.Type.In(startIndex)
+			var v		reflect.Value
+			var valid	bool
+			if argType.Kind() == reflect.Slice {
+				v, valid = makeSliceArg(vals, argType, Application_Json)
+			} else {
+				v, valid = makeArg(strings.Join(vals, ","), argType, Application_Json)
+			}
+			if valid {
+				arrArgs = append(arrArgs, v)
+			} else {
+				rb.SetProblem(NewProblem(http.StatusBadRequest, "Invalid value for form parameter: " + par.Name))
+				return
+			}
+
+			startIndex++
+		}
+
+		//Trailing arguments supplied by gorest, e.g. Precondition
+		arrArgs = appendInjected(arrArgs, targetMethod.Type, rb, ep)
+
+		//WebSocket endpoints upgrade the connection once the request is authorized and its arguments are valid
+		if ep.RequestMethod == WS {
+			wsConn, problem := upgradeWebSocket(rb, ep.ProducesMime)
+			if problem != nil {
+				rb.SetProblem(problem)
+				return
+			} else if wsConn == nil {
+				return
+			}
+			defer wsConn.Close()
+			arrArgs = append([]reflect.Value{reflect.ValueOf(wsConn)}, arrArgs...)
+		}
+
 		//Now call the actual method with the data
 		var ret []reflect.Value
 		if ep.isVariableLength {
@@ -461,32 +663,80 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 			ret = servVal.Method(ep.MethodNumberInParent).Call(arrArgs)
 		}
 
+		//A trailing error result reports a failure as a problem response
+		if hasErrorResult(targetMethod.Type) {
+			if err := ret[len(ret)-1]; !err.IsNil() {
+				logger.Error.Println("[gen] service method returned error: ", err.Interface())
+				rb.SetProblem(toProblem(err.Interface()))
+				return
+			}
+			ret = ret[:len(ret)-1]
+		}
+
 		if len(ret) == 1 { //This is when we have just called a GET
-			var mimeType	string
+			//Fields of the output may be response headers or the response code
+			rb.writeOutputHeaders(ret[0])
+			rb.writeAttachment(ep.Filename)
+
+			mimeType := rb.ctx.produceMime
+			if ep.OutputTypeIsBinary && rb.ctx.responseMimeSet {
+				// binary content may be of a type only the method knows
+				mimeType = rb.ctx.responseMimeType
+			}
 
-			accept := rb.ctx.request.Header.Get("Accept")
-			valid := false
+			rb.SetContentType(mimeType)
 
-			if len(accept) > 0 {
-				if valid, mimeType = validMime(accept, ep.ProducesMime, servMeta.ProducesMime); valid {
-			//		rb.SetResponseCode(http.StatusBadRequest)
-			//		rb.SetResponseMsg("Service does not support Accept mime type " + mime)
-			//		return rb
-				}
+			//Events are written as they are published, until the client goes away
+			if ep.OutputTypeIsEvents {
+				rb.ctx.events, _ = ret[0].Interface().(EventSource)
+				return
 			}
-			if !valid {
-				if len(ep.ProducesMime) > 0 {
-					mimeType = ep.ProducesMime[0]
-				} else {
-					mimeType = servMeta.ProducesMime[0]
+
+			//Binary content is written as is, in the byte ranges requested by the client
+			if ep.OutputTypeIsBinary {
+				bin, err := rb.newBinaryContent(ret[0])
+				if err != nil {
+					rb.SetProblem(NewProblem(http.StatusInternalServerError, "Could not read binary content: " + err.Error()))
+					return
 				}
+				rb.ctx.binary = bin
+				return
 			}
 
-			rb.SetContentType(mimeType)
+			//Streamed items are written as they are produced when the response is written
+			if ep.OutputTypeIsStream {
+				rb.ctx.responseMimeType = mimeType
+				rb.ctx.stream = newResponseStream(ret[0], mimeType, ep.OutputType)
+				rb.ctx.stream.xmlRoot, _ = XMLCollectionNames(ep.OutputType, ep.XMLRoot, ep.XMLItem)
+				rb.ctx.stream.xmlItem = ep.XMLItem
+				return
+			}
 
 			// check for hypermedia decorator
 			dec := GetHypermedia()
 			hidec := ret[0].Interface()
+			if ep.SparseFields {
+				if fields := rb.ctx.request.URL.Query().Get("fields"); fields != "" {
+					var err		error
+					strategy := ""
+					if _, isJSON := marshallerFor(mimeType).(jsonMarshaller); isJSON {
+						strategy = servMeta.JSONOptions.Naming
+					}
+					if page, isPage := hidec.(Page); isPage {
+						page.Items, err = selectFields(page.Items, fields, mimeType, strategy)
+						hidec = page
+					} else {
+						hidec, err = selectFields(hidec, fields, mimeType, strategy)
+					}
+					if err != nil {
+						rb.SetProblem(NewProblem(http.StatusBadRequest, err.Error()))
+						return
+					}
+				}
+			}
+			if ep.Pagination != nil {
+				hidec = rb.writePage(hidec.(Page), ep.Pagination)
+			}
 			if dec != nil {
 				scope := make([]string, 0)
 				prefix := "http://" + rb.ctx.request.Host
@@ -501,17 +751,31 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 				hidec = dec.Decorate(mimeType, prefix, hidec, scope)
 			}
 
+			//Collections are wrapped by the xml marshaller anyway, the tags rename the elements
+			if ep.XMLRoot != "" || ep.XMLItem != "" {
+				if _, isXML := marshallerFor(mimeType).(xmlMarshaller); isXML {
+					hidec = newXMLCollection(hidec, reflect.TypeOf(hidec), ep.XMLRoot, ep.XMLItem)
+				}
+			}
+
+			//The json options of the service, and indenting asked for by the client
+			options := servMeta.JSONOptions
+			options.Pretty = options.Pretty || prettyRequested(rb.ctx.request)
+			hidec = options.entity(hidec, mimeType)
+
 			rb.ctx.responseMimeType = mimeType
 			//At this stage we should be ready to write the response to client
-			if bytarr, err := interfaceToBytes(hidec, mimeType); err == nil {
+			if bytarr, err := newEntityPacket(hidec, mimeType); err == nil {
 				rb.ctx.respPacket = bytarr
 				rb.AddHeader("Content-Type", mimeType)
+				if cacheKeyFound {
+					rb.storeCached(key, ep)
+				}
 				//rb.SetResponseCode(http.StatusOK)
 				return
 			} else {
 				//This is an internal error with the registered marshaller not being able to marshal internal structs
-				rb.SetResponseCode(http.StatusInternalServerError)
-				rb.SetResponseMsg("Internal server error. Could not Marshal/UnMarshal data: " + err.Error())
+				rb.SetProblem(NewProblem(http.StatusInternalServerError, "Internal server error. Could not Marshal/UnMarshal data: " + err.Error()))
 				return
 			}
 		} else {
@@ -522,21 +786,21 @@ func prepareServe(rb *ResponseBuilder, ep EndPointStruct, args map[string]string
 
 	//Just in case the whole civilization crashes and it falls thru to here. This shall never happen though... well tested
 	logger.Error.Panicln("[gen] There was a problem with request handing. Probably a bug, please report.") //Add client data, and send support alert
-	rb.SetResponseCode(http.StatusInternalServerError)
-	rb.SetResponseMsg("GoRest: Internal server error.")
+	rb.SetProblem(NewProblem(http.StatusInternalServerError, "GoRest: Internal server error."))
 	return
 }
 
 func makeArg(data string, template reflect.Type, mime string) (reflect.Value, bool) {
 
 	kind := template.Kind()
-	// convert array arg from string to array format before marshalling
-	if kind == reflect.Slice || kind == reflect.Array {
-		if template.Elem().Kind() == reflect.String {
-			data = "[\"" + strings.Replace(data, ",", "\",\"", -1) + "\"]"
-		} else {
-			data = "[" + data + "]"
+	// the items of a slice arg are listed with commas
+	if kind == reflect.Slice && !isEntityKind(template.Elem().Kind()) {
+		if data == "" {
+			return reflect.Zero(template), true
 		}
+		return makeSliceArg(strings.Split(data, ","), template, mime)
+	} else if kind == reflect.Slice || kind == reflect.Array {
+		data = "[" + data + "]"
 	}
 
 	i := reflect.New(template).Interface()
@@ -556,37 +820,26 @@ func makeArg(data string, template reflect.Type, mime string) (reflect.Value, bo
 	return reflect.ValueOf(i).Elem(), true
 }
 
-func validMime(mimeType string, epMime []string, srvMime []string) (bool, string) {
-	found := false
-	ctype := ""
-
-	parts := strings.Split(mimeType, ";")
-	for j := range parts {
-		// Endpoint mime type list overrides the one defined at the server
-		// It is not a union
-		if len(epMime) > 0 {
-			for i := range epMime {
-				if parts[j] == epMime[i] {
-					found = true
-					ctype = parts[j]
-					break
-				}
-			}
-		} else {
-			for i := range srvMime {
-				if parts[j] == srvMime[i] {
-					found = true
-					ctype = parts[j]
-					break
-				}
-			}
-		}
-		if found {
-			break
+//Makes a slice arg with an item from each of the values
+func makeSliceArg(values []string, template reflect.Type, mime string) (reflect.Value, bool) {
+	slice := reflect.MakeSlice(template, 0, len(values))
+	for _, value := range values {
+		v, valid := makeArg(value, template.Elem(), mime)
+		if !valid {
+			return reflect.Value{}, false
 		}
+		slice = reflect.Append(slice, v)
 	}
+	return slice, true
+}
 
-	return found, ctype
+//Kinds that are marshalled as a whole, rather than converted from their text
+func isEntityKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
 }
 
 func replaceScopeKey(scope string, args map[string]string) string {
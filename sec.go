@@ -26,38 +26,193 @@
 
 package gorest
 
-import "github.com/rmullinnix/logger"
+import (
+	"github.com/rmullinnix/logger"
+	"net/http"
+	"reflect"
+	"strings"
+)
 
-var authorizers map[string]Authorizer
+var authorizers map[string]PrincipalAuthorizer
 
 //Signiture of functions to be used as Authorizers
 //  token, scheme, scopes, method, ResponseBuilder
+//Returning false answers 401, whatever the reason. A PrincipalAuthorizer tells the caller apart.
 type Authorizer func(string, string, []string, string, *ResponseBuilder)(bool)
 
+//Signiture of Authorizers that say who the caller is, and why a request is refused
+//  token, scheme, scopes, method, ResponseBuilder
+type PrincipalAuthorizer func(string, string, []string, string, *ResponseBuilder)(AuthResult)
+
+//The caller of a request, as established by the Authorizer of its security scheme. Service methods
+//get it from ResponseBuilder().Principal(), or by declaring a trailing *Principal argument.
+type Principal struct {
+	Subject	string // user id or client id
+	Scopes	[]string
+	Claims	map[string]interface{} // e.g. of the token
+}
+
+//What an Authorizer decided
+type Decision int
+
+const (
+	Unauthenticated	Decision = iota // no or invalid credentials: 401 with a WWW-Authenticate challenge
+	Forbidden			// known caller without the scopes needed: 403
+	Allowed
+)
+
+type AuthResult struct {
+	Decision	Decision
+	Principal	*Principal // of Allowed and Forbidden results
+	Reason		string // why the request was refused, given to the client as the problem detail
+}
+
 //Registers an Authorizer for the specified security scheme
 func RegisterAuthorizer(scheme string, auth Authorizer){
+	RegisterPrincipalAuthorizer(scheme, adaptAuthorizer(auth))
+}
+
+//Registers a PrincipalAuthorizer for the specified security scheme
+func RegisterPrincipalAuthorizer(scheme string, auth PrincipalAuthorizer){
 	if authorizers == nil{
-		authorizers = make(map[string]Authorizer,0)
+		authorizers = make(map[string]PrincipalAuthorizer,0)
 	}
 	
-	if _,found := authorizers[scheme]; !found{
+	if _,found := authorizers[scheme]; !found && auth != nil{
 		authorizers[scheme] = auth
 	}
 }
 
 //Returns the registred Authorizer for the specified scheme 
 func GetAuthorizer(scheme string)(a Authorizer){
+	if auth := GetPrincipalAuthorizer(scheme); auth != nil {
+		a = func(token string, scheme string, scopes []string, method string, rb *ResponseBuilder) bool {
+			return auth(token, scheme, scopes, method, rb).Decision == Allowed
+		}
+	}
+	return 
+}
+
+//Returns the registred PrincipalAuthorizer for the specified scheme, Authorizers registered with
+//RegisterAuthorizer included
+func GetPrincipalAuthorizer(scheme string)(a PrincipalAuthorizer){
 	if authorizers ==nil{
-		authorizers = make(map[string]Authorizer,0)
+		authorizers = make(map[string]PrincipalAuthorizer,0)
 	}
 	a,_ = authorizers[scheme]
 	return 
 }
 
+//An Authorizer allowing a request allows it for the UserId it kept in the session, if any; refusing it
+//leaves the caller unauthenticated.
+func adaptAuthorizer(auth Authorizer) PrincipalAuthorizer {
+	if auth == nil {
+		return nil
+	}
+	return func(token string, scheme string, scopes []string, method string, rb *ResponseBuilder) AuthResult {
+		if !auth(token, scheme, scopes, method, rb) {
+			return AuthResult{Decision: Unauthenticated}
+		}
+
+		principal := new(Principal)
+		if uid, found := rb.Session().Get("UserId"); found {
+			principal.Subject, _ = uid.(string)
+		}
+		return AuthResult{Decision: Allowed, Principal: principal}
+	}
+}
+
+//The caller of the request, nil when the endpoint has no security scheme
+func (this *ResponseBuilder) Principal() *Principal {
+	return this.ctx.principal
+}
+
+var principalType = reflect.TypeOf((*Principal)(nil))
+
+func init() {
+	registerInjector(principalType, func(rb *ResponseBuilder, ep EndPointStruct) reflect.Value {
+		return reflect.ValueOf(rb.ctx.principal)
+	})
+}
+
+//Runs the Authorizers of the security schemes of the endpoint; any one of them may allow the request.
+//Otherwise a caller known to one of them is forbidden, and anyone else challenged to authenticate.
+func authorize(rb *ResponseBuilder, ep EndPointStruct, args map[string]string) *Problem {
+	result := AuthResult{Decision: Unauthenticated}
+	resolved := make(map[string][]string, len(ep.SecurityScheme))
+	for key, scopes := range ep.SecurityScheme {
+		alteredScopes := make([]string, len(scopes))
+		for i := range scopes {
+			alteredScopes[i] = replaceScopeKey(scopes[i], args)
+		}
+		resolved[key] = alteredScopes
+		if r := GetPrincipalAuthorizer(key)(rb.ctx.xsrftoken, key, alteredScopes, rb.ctx.request.Method, rb); r.Decision > result.Decision || (r.Decision == result.Decision && result.Reason == "") {
+			result = r
+		}
+		if result.Decision == Allowed {
+			break
+		}
+	}
+
+	switch result.Decision {
+	case Allowed:
+		rb.ctx.principal = result.Principal
+		return nil
+	case Forbidden:
+		rb.ctx.principal = result.Principal
+		for key, scopes := range resolved {
+			if challenge := authChallenge(key, Forbidden, result.Reason, scopes); challenge != "" {
+				rb.AddHeader("WWW-Authenticate", challenge)
+			}
+		}
+		return NewProblem(http.StatusForbidden, result.Reason)
+	}
+
+	// authorizer should log failure reason
+	for key, scopes := range resolved {
+		if challenge := authChallenge(key, Unauthenticated, result.Reason, scopes); challenge != "" {
+			rb.AddHeader("WWW-Authenticate", challenge)
+		}
+	}
+	return NewProblem(http.StatusUnauthorized, result.Reason)
+}
+
+//The WWW-Authenticate challenge of a security scheme refusing a request: Basic for basic schemes and
+//Bearer (RFC 6750) for oauth2. Api keys have no challenge, nor do basic schemes forbidding a request.
+func authChallenge(scheme string, decision Decision, reason string, scopes []string) string {
+	def := _manager().securityDef[scheme]
+	params := []string{"realm=" + quoteAuthParam(scheme)}
+
+	switch def.Mode {
+	case "basic":
+		if decision == Forbidden {
+			return ""
+		}
+		return "Basic " + strings.Join(params, ", ")
+	case "oauth2":
+		if decision == Forbidden {
+			params = append(params, `error="insufficient_scope"`)
+			if len(scopes) > 0 {
+				params = append(params, "scope=" + quoteAuthParam(strings.Join(scopes, " ")))
+			}
+		} else if reason != "" {
+			params = append(params, `error="invalid_token"`)
+		}
+		if reason != "" {
+			params = append(params, "error_description=" + quoteAuthParam(reason))
+		}
+		return "Bearer " + strings.Join(params, ", ")
+	}
+	return ""
+}
+
+func quoteAuthParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
 //This is the default and exmaple authorizer that is used to authorize requests to endpints with a security scheme
 //It always allows access and returns nil for SessionData.  
 func DefaultAuthorizer(token string, scheme string, scopes []string, method string, rb *ResponseBuilder) bool {
 	logger.Warning.Println("[gen] Use of DefaultAuthorizer for scheme " + scheme)
 	return true
 }
-
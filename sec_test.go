@@ -0,0 +1,138 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package gorest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type SecTestService struct {
+	RestService `root:"/sec-test/"`
+	secBearer   Security `mode:"oauth2"`
+	secBasic    Security `mode:"basic"`
+	getSecret   EndPoint `method:"GET" path:"/secret" output:"string" security:"secBearer:[read]"`
+	getBasic    EndPoint `method:"GET" path:"/basic" output:"string" security:"secBasic"`
+	getAccount  EndPoint `method:"GET" path:"/account/{id:string}" output:"string" security:"secBearer:[account{id}]"`
+}
+
+var secTestRegister sync.Once
+
+func (serv SecTestService) GetSecret(principal *Principal) string {
+	return principal.Subject
+}
+
+func (serv SecTestService) GetBasic() string {
+	return serv.ResponseBuilder().Principal().Subject
+}
+
+func (serv SecTestService) GetAccount(id string) string {
+	return id
+}
+
+func bearerTestAuthorizer(token string, scheme string, scopes []string, method string, rb *ResponseBuilder) AuthResult {
+	switch token {
+	case "":
+		return AuthResult{Decision: Unauthenticated}
+	case "good":
+		return AuthResult{Decision: Allowed, Principal: &Principal{Subject: "ann", Scopes: []string{"read"}}}
+	case "weak":
+		return AuthResult{Decision: Forbidden, Principal: &Principal{Subject: "bob"}, Reason: "Missing scope read"}
+	}
+	return AuthResult{Decision: Unauthenticated, Reason: "Invalid token"}
+}
+
+func basicTestAuthorizer(token string, scheme string, scopes []string, method string, rb *ResponseBuilder) bool {
+	if token == "ann:secret" {
+		rb.Session().Set("UserId", "ann")
+		return true
+	}
+	return false
+}
+
+func TestAuthorization(t *testing.T) {
+	secTestRegister.Do(func() {
+		RegisterPrincipalAuthorizer("secBearer", bearerTestAuthorizer)
+		RegisterAuthorizer("secBasic", basicTestAuthorizer)
+		RegisterService(new(SecTestService))
+	})
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	get := func(path string, auth string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(data)
+	}
+
+	cases := []struct {
+		path, auth string
+		status     int
+		challenge  string
+	}{
+		{"/sec-test/secret", "", http.StatusUnauthorized, `Bearer realm="secBearer"`},
+		{"/sec-test/secret", "Bearer expired", http.StatusUnauthorized, `Bearer realm="secBearer", error="invalid_token", error_description="Invalid token"`},
+		{"/sec-test/secret", "Bearer weak", http.StatusForbidden, `Bearer realm="secBearer", error="insufficient_scope", scope="read", error_description="Missing scope read"`},
+		{"/sec-test/basic", "Basic YW5uOndyb25n", http.StatusUnauthorized, `Basic realm="secBasic"`},
+		{"/sec-test/account/42", "Bearer weak", http.StatusForbidden, `Bearer realm="secBearer", error="insufficient_scope", scope="account[42]", error_description="Missing scope read"`},
+	}
+	for _, c := range cases {
+		resp, _ := get(c.path, c.auth)
+		if resp.StatusCode != c.status || resp.Header.Get("WWW-Authenticate") != c.challenge {
+			t.Error("Expecting", c.status, c.challenge, "for", c.auth, "got:", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	if resp, body := get("/sec-test/secret", "Bearer good"); resp.StatusCode != http.StatusOK || body != `"ann"` {
+		t.Error("Expecting the principal to be injected, got:", resp.StatusCode, body)
+	}
+	if resp, body := get("/sec-test/basic", "Basic YW5uOnNlY3JldA=="); resp.StatusCode != http.StatusOK || body != `"ann"` {
+		t.Error("Expecting the principal of the bool authorizer, got:", resp.StatusCode, body)
+	}
+
+	// negotiation does not tell unauthorized clients which types are produced
+	req, _ := http.NewRequest("GET", server.URL+"/sec-test/secret", nil)
+	req.Header.Set("Accept", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("Expecting 401 before 406, got:", resp.StatusCode)
+	}
+}
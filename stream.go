@@ -0,0 +1,215 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"github.com/rmullinnix/logger"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+//An Iterator produces the items of a streamed response one at a time, Next returns false once
+//there are no more items. If the Iterator is also an io.Closer it is closed when the response
+//is complete or the client goes away.
+//
+//Endpoints declared with output:"chan T" may return either a receive channel of T or an Iterator:
+//
+//	type ExportService struct {
+//	    gorest.RestService `root:"/export/"`
+//	    users   gorest.EndPoint `method:"GET" path:"/users" output:"chan User"`
+//	}
+//	func(serv ExportService) Users() chan User {
+//	    ch := make(chan User)
+//	    go func() {
+//	        defer close(ch)
+//	        for _, u := range loadUsers() {
+//	            select {
+//	            case ch <- u:
+//	            case <-serv.ResponseBuilder().Done():
+//	                return
+//	            }
+//	        }
+//	    }()
+//	    return ch
+//	}
+//
+//Items are written and flushed as they are produced; as newline delimited json (application/x-ndjson),
+//a json array or a sequence of xml elements depending on the negotiated mime type.
+type Iterator interface {
+	Next() (interface{}, bool)
+}
+
+var iteratorType = reflect.TypeOf((*Iterator)(nil)).Elem()
+
+type responseStream struct {
+	source   reflect.Value
+	mimeType string
+	itemType string
+	xmlRoot  string // root element of an xml stream
+	xmlItem  string // element of each item of an xml stream, if not named after its type
+}
+
+func newResponseStream(source reflect.Value, mimeType string, itemType string) *responseStream {
+	root, _ := XMLCollectionNames(itemType, "", "")
+	return &responseStream{source, mimeType, itemType, root, ""}
+}
+
+//Returns a channel that is closed when the client goes away. Service methods producing a
+//streamed response should stop sending on their output channel once it is closed.
+func (this *ResponseBuilder) Done() <-chan struct{} {
+	return this.ctx.request.Context().Done()
+}
+
+//Writes the items of the stream, flushing after each one, until the source is exhausted
+//or the client disconnects
+func (this *ResponseBuilder) writeStream() {
+	stream := this.ctx.stream
+	defer stream.close()
+
+	var out io.Writer = this.writer()
+	flusher, _ := this.writer().(http.Flusher)
+
+	var cw		compressWriter
+	if encoding := this.responseEncoding(); encoding != "" {
+		level := this.compressionPolicy().level
+		this.writer().Header().Set("Content-Encoding", encoding)
+		cw = newCompressWriter(this.writer(), encoding, level)
+		defer closeCompressWriter(cw, encoding, level)
+		out = cw
+	}
+	this.writer().WriteHeader(this.ctx.responseCode)
+
+	flush := func() {
+		if cw != nil {
+			cw.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	//Items are written compact, one after the other
+	options := this.ctx.jsonOptions
+	options.Pretty = false
+
+	prefix, separator, suffix := stream.framing()
+	io.WriteString(out, prefix)
+
+	done := this.Done()
+	complete := true
+	for count := 0; ; count++ {
+		item, ok := stream.next(done)
+		if !ok {
+			break
+		}
+
+		var buf bytes.Buffer
+		if count > 0 {
+			buf.WriteString(separator)
+		}
+		if _, isXML := marshallerFor(stream.mimeType).(xmlMarshaller); isXML && stream.xmlItem != "" {
+			item = xmlCollection{root: stream.xmlItem, value: item}
+		}
+		if data, err := interfaceToBytes(options.entity(item, stream.mimeType), stream.mimeType); err == nil {
+			io.Copy(&buf, data)
+		} else {
+			logger.Error.Println("[gen] could not marshal streamed item: " + err.Error())
+			complete = false
+			break
+		}
+		if _, err := buf.WriteTo(out); err != nil {
+			complete = false // client went away
+			break
+		}
+		flush()
+	}
+
+	//A truncated stream is left unterminated, so the client can tell it did not get everything
+	if !complete {
+		return
+	}
+	select {
+	case <-done:
+	default:
+		io.WriteString(out, suffix)
+	}
+}
+
+//The text written before, between and after the items for the mime type
+func (this *responseStream) framing() (string, string, string) {
+	switch {
+	case strings.Contains(this.mimeType, "ndjson"):
+		return "", "\n", "\n"
+	case strings.Contains(this.mimeType, "json"):
+		return "[", ",", "]"
+	case strings.Contains(this.mimeType, "xml"):
+		return "<" + this.xmlRoot + ">", "", "</" + this.xmlRoot + ">"
+	}
+	return "", "\n", "\n"
+}
+
+//Gets the next item, from either a channel or an Iterator. Returns false once the source is
+//exhausted or done is closed.
+func (this *responseStream) next(done <-chan struct{}) (interface{}, bool) {
+	if this.source.Kind() == reflect.Chan {
+		if this.source.IsNil() {
+			return nil, false
+		}
+		chosen, item, ok := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: this.source},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		})
+		if chosen != 0 || !ok {
+			return nil, false
+		}
+		return item.Interface(), true
+	}
+
+	select {
+	case <-done:
+		return nil, false
+	default:
+	}
+
+	iter, ok := this.source.Interface().(Iterator)
+	if !ok || iter == nil {
+		return nil, false
+	}
+	return iter.Next()
+}
+
+func (this *responseStream) close() {
+	if this.source.Kind() == reflect.Chan || this.source.IsNil() {
+		return
+	}
+	if closer, ok := this.source.Interface().(io.Closer); ok {
+		closer.Close()
+	}
+}
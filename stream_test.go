@@ -0,0 +1,170 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type sliceIterator struct {
+	items  []interface{}
+	closed bool
+}
+
+func (this *sliceIterator) Next() (interface{}, bool) {
+	if len(this.items) == 0 {
+		return nil, false
+	}
+	item := this.items[0]
+	this.items = this.items[1:]
+	return item, true
+}
+
+func (this *sliceIterator) Close() error {
+	this.closed = true
+	return nil
+}
+
+func streamUsers() chan User {
+	ch := make(chan User, 2)
+	ch <- User{Id: "1", FirstName: "David"}
+	ch <- User{Id: "2", FirstName: "Siya"}
+	close(ch)
+	return ch
+}
+
+func writeTestStream(req *http.Request, source reflect.Value, mimeType string, gzip bool) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req, encodeGzip: gzip}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.ctx.stream = newResponseStream(source, mimeType, "User")
+	rb.WritePacket()
+	return rec
+}
+
+func TestStreamFormats(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	RegisterMarshaller("xml", NewXMLMarshaller())
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+
+	expected := map[string]string{
+		Application_NDJson: `{"Id":"1","FirstName":"David","LastName":"","Age":0,"Weight":0}` + "\n" +
+			`{"Id":"2","FirstName":"Siya","LastName":"","Age":0,"Weight":0}` + "\n",
+		Application_Json: `[{"Id":"1","FirstName":"David","LastName":"","Age":0,"Weight":0},` +
+			`{"Id":"2","FirstName":"Siya","LastName":"","Age":0,"Weight":0}]`,
+		Application_Xml: `<Users><User><Id>1</Id><FirstName>David</FirstName><LastName></LastName><Age>0</Age><Weight>0</Weight></User>` +
+			`<User><Id>2</Id><FirstName>Siya</FirstName><LastName></LastName><Age>0</Age><Weight>0</Weight></User></Users>`,
+	}
+
+	for mimeType, body := range expected {
+		rec := writeTestStream(req, reflect.ValueOf(streamUsers()), mimeType, false)
+		if rec.Body.String() != body {
+			t.Error("Stream as", mimeType, "gave:", rec.Body.String())
+		}
+		if !rec.Flushed {
+			t.Error("Stream as", mimeType, "was not flushed")
+		}
+	}
+
+	iter := &sliceIterator{items: []interface{}{1, 2, 3}}
+	var source Iterator = iter
+	rec := writeTestStream(req, reflect.ValueOf(&source).Elem(), Application_Json, false)
+	if rec.Body.String() != "[1,2,3]" || !iter.closed {
+		t.Error("Iterator stream gave:", rec.Body.String(), "closed:", iter.closed)
+	}
+}
+
+func TestStreamJSONOptions(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+
+	rec := httptest.NewRecorder()
+	rb := &ResponseBuilder{&Context{writer: rec, request: req, jsonOptions: JSONOptions{Naming: "snake_case", Pretty: true}}}
+	rb.ctx.sessData.relSessionData = make(map[string]interface{})
+	rb.ctx.stream = newResponseStream(reflect.ValueOf(streamUsers()), Application_NDJson, "User")
+	rb.WritePacket()
+
+	expected := `{"id":"1","first_name":"David","last_name":"","age":0,"weight":0}` + "\n" +
+		`{"id":"2","first_name":"Siya","last_name":"","age":0,"weight":0}` + "\n"
+	if rec.Body.String() != expected {
+		t.Error("Expecting compact items named as the service says, got:", rec.Body.String())
+	}
+}
+
+func TestStreamGzip(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rec := writeTestStream(req, reflect.ValueOf(&sliceIterator{items: []interface{}{"a", "b"}}), Application_NDJson, true)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expecting gzip encoded stream")
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal("Invalid gzip stream:", err)
+	}
+	data, _ := ioutil.ReadAll(gr)
+	if string(data) != "\"a\"\n\"b\"\n" {
+		t.Error("Gzip stream gave:", string(data))
+	}
+}
+
+func TestStreamClientGone(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+	req = req.WithContext(ctx)
+
+	ch := make(chan int)
+	go func() {
+		ch <- 1
+		cancel()
+	}()
+
+	rec := writeTestStream(req, reflect.ValueOf(ch), Application_Json, false)
+	if rec.Body.String() != "[1" {
+		t.Error("Stream should stop once the client is gone, gave:", rec.Body.String())
+	}
+}
+
+func TestStreamMarshalError(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+
+	var source Iterator = &sliceIterator{items: []interface{}{1, func() {}, 3}}
+	rec := writeTestStream(req, reflect.ValueOf(&source).Elem(), Application_Json, false)
+	if rec.Body.String() != "[1" {
+		t.Error("Stream should be left unterminated after a marshal error, gave:", rec.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package swagger
 
 import (
 	"github.com/rmullinnix/gorest"
+	"reflect"
 	"strings"
 )
 
@@ -13,6 +14,23 @@ type dataType struct {
 
 var primitives		map[string]dataType
 
+// paginated endpoints return a gorest.Page of their declared output type
+var pageType = reflect.TypeOf(gorest.Page{})
+
+// the name of a model property, as the json written by a service with the naming strategy names it
+func propertyName(sf reflect.StructField, naming string) string {
+	return gorest.JSONFieldName(sf, naming)
+}
+
+// the name of the model of a type, as documented for services with the naming strategy; a type
+// served with several strategies gets a model for each, as its properties are named differently
+func modelName(name string, naming string) string {
+	if naming == "" {
+		return name
+	}
+	return name + "_" + naming
+}
+
 // creates a new Swagger Documentor
 //   versions supported - 1.2 and 2.0
 func NewSwaggerDocumentor(version string) *gorest.Documentor {
@@ -140,6 +140,8 @@ func swaggerDocumentor12(basePath string, svcTypes map[string]gorest.ServiceMeta
 	for _, ep := range endPoints {
 		var api		API
 
+		naming := svcTypes[ep.ServiceName()].JSONOptions.Naming
+
 		api.Path = cleanPath(ep.Signiture)
 		//api.Description = ep.description
 
@@ -171,12 +173,25 @@ func swaggerDocumentor12(basePath string, svcTypes map[string]gorest.ServiceMeta
 		op.Consumes = append(op.Consumes, ep.ConsumesMime...)
 
 		op.Method = ep.RequestMethod
+		if op.Method == gorest.WS {
+			op.Method = gorest.GET
+		}
 		if strings.Index(ep.OutputType, ".") > 0 {
 			op.Type = ep.OutputType[strings.Index(ep.OutputType, ".")+1:]
 		} else {
 			op.Type = ep.OutputType
 		}
-		op.Parameters = make([]Parameter, len(ep.Params) + len(ep.QueryParams))
+		if op.Type != "" && !isPrimitive(op.Type) && !ep.OutputTypeIsEvents && !ep.OutputTypeIsBinary {
+			op.Type = modelName(op.Type, naming)
+		}
+		queryParams := ep.QueryParams
+		if ep.Pagination != nil {
+			queryParams = append(append([]gorest.Param{}, queryParams...), ep.Pagination.Params()...)
+		}
+		if ep.SparseFields {
+			queryParams = append(append([]gorest.Param{}, queryParams...), gorest.Param{Name: "fields", TypeName: "string"})
+		}
+		op.Parameters = make([]Parameter, len(ep.Params) + len(queryParams) + len(ep.FormParams))
 		//op.Authorizations = make([]Authorization, 0)
 		pnum := 0
 		for j := 0; j < len(ep.Params); j++ {
@@ -193,29 +208,50 @@ func swaggerDocumentor12(basePath string, svcTypes map[string]gorest.ServiceMeta
 			pnum++
 		}
 
-		for j := 0; j < len(ep.QueryParams); j++ {
+		for j := 0; j < len(queryParams); j++ {
 			var par		Parameter
 
 			par.ParamType = "query"
-			par.Name = ep.QueryParams[j].Name
-			par.Type = ep.QueryParams[j].TypeName
+			par.Name = queryParams[j].Name
+			par.Type = queryParams[j].TypeName
 			par.Description = ""
-			par.Required = false
+			par.Required = queryParams[j].Required
 			par.AllowMultiple = false
 
 			op.Parameters[pnum] = par
 			pnum++
 		}
 
+		for j := 0; j < len(ep.FormParams); j++ {
+			var par		Parameter
+
+			par.ParamType = "form"
+			par.Name = ep.FormParams[j].Name
+			par.Type = ep.FormParams[j].TypeName
+			par.Description = ""
+			par.Required = ep.FormParams[j].Required
+			par.AllowMultiple = strings.HasPrefix(par.Type, "[]")
+
+			op.Parameters[pnum] = par
+			pnum++
+		}
+
 		if ep.PostdataType != "" {
 			var par		Parameter
 
 			par.ParamType = "body"
 			par.Name = ep.PostdataType
 			par.Type = ep.PostdataType
+			if !isPrimitive(par.Type) {
+				par.Type = modelName(par.Type, naming)
+			}
 			par.Description = ""
 			par.Required = true
 			par.AllowMultiple = false
+			if ep.PostdataIsPatch {
+				par.Name = "patch"
+				par.Description = "Patch document: " + strings.Join(ep.ConsumesMime, ", ")
+			}
 
 			op.Parameters = append(op.Parameters, par)
 		}
@@ -228,12 +264,12 @@ func swaggerDocumentor12(basePath string, svcTypes map[string]gorest.ServiceMeta
 		// skip the fuction class pointer
 		for i := 1; i < methType.NumIn(); i++ {
 			inType := methType.In(i)
-			if inType.Kind() == reflect.Struct {
-				if _, ok := spec12.Models[inType.Name()]; ok {
+			if inType.Kind() == reflect.Struct && !gorest.IsInjectedType(inType) {
+				if _, ok := spec12.Models[modelName(inType.Name(), naming)]; ok {
 					continue  // model already exists
 				}
 
-				model := populateModel(inType)
+				model := populateModel(inType, naming)
 
 				spec12.Models[model.ID] = model
 			}
@@ -241,12 +277,15 @@ func swaggerDocumentor12(basePath string, svcTypes map[string]gorest.ServiceMeta
 
 		for i := 0; i < methType.NumOut(); i++ {
 			outType := methType.Out(i)
+			if outType == pageType {
+				continue  // the items of the page are documented by the output tag
+			}
 			if outType.Kind() == reflect.Struct {
-				if _, ok := spec12.Models[outType.Name()]; ok {
+				if _, ok := spec12.Models[modelName(outType.Name(), naming)]; ok {
 					continue  // model already exists
 				}
 
-				model := populateModel(outType)
+				model := populateModel(outType, naming)
 
 				spec12.Models[model.ID] = model
 			}
@@ -277,35 +316,42 @@ func populateResponses(tags reflect.StructTag) []ResponseMessage {
 	return responses
 }
 
-func populateModel(t reflect.Type) Model {
+func populateModel(t reflect.Type, naming string) Model {
 	var model	Model
 
-	model.ID = t.Name()
+	model.ID = modelName(t.Name(), naming)
 	model.Description = ""
 	model.Required = make([]string, 0)
 	model.Properties = make(map[string]interface{})
 
 	for k := 0; k < t.NumField(); k++ {
 		sMem := t.Field(k)
+		if sMem.Tag.Get("header") != "" || sMem.Tag.Get("status") == "true" {
+			continue	// sent as response headers, not in the body
+		}
+		name := propertyName(sMem, naming)
+		if name == "" {
+			continue	// not marshalled
+		}
 		switch sMem.Type.Kind() {
 			case reflect.Slice, reflect.Array, reflect.Map:
-				prop, required := populatePropertyArray(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populatePropertyArray(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 			case reflect.Ptr:
 				logger.Error.Println("Ptr ", sMem.Name)
-				prop, required := populatePropertyPtr(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populatePropertyPtr(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 			default:
-				prop, required := populateProperty(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populateProperty(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 		}
 	}
@@ -313,7 +359,7 @@ func populateModel(t reflect.Type) Model {
 	return model
 }
 
-func populateProperty(sf reflect.StructField) (Property, bool) {
+func populateProperty(sf reflect.StructField, naming string) (Property, bool) {
 	var prop	Property
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -326,9 +372,12 @@ func populateProperty(sf reflect.StructField) (Property, bool) {
 		} else {
 			prop.Type = parts[0]
 		}
+		if !isPrimitive(prop.Type) {
+			prop.Type = modelName(prop.Type, naming)
+		}
 
-		if _, ok := spec12.Models[sf.Type.Name()]; !ok {
-			model := populateModel(sf.Type)
+		if _, ok := spec12.Models[modelName(sf.Type.Name(), naming)]; !ok {
+			model := populateModel(sf.Type, naming)
 			_spec12().Models[model.ID] = model
 		}
 	} else {
@@ -359,7 +408,7 @@ func populateProperty(sf reflect.StructField) (Property, bool) {
 	return prop, required
 }
 
-func populatePropertyArray(sf reflect.StructField) (PropertyArray, bool) {
+func populatePropertyArray(sf reflect.StructField, naming string) (PropertyArray, bool) {
 	var prop	PropertyArray
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -376,10 +425,10 @@ func populatePropertyArray(sf reflect.StructField) (PropertyArray, bool) {
 	}
 
 	if et.Kind() == reflect.Struct {
-		if _, ok := spec12.Models[et.Name()]; !ok {
+		if _, ok := spec12.Models[modelName(et.Name(), naming)]; !ok {
 			var placeHolder		Model
-			_spec12().Models[et.Name()] = placeHolder
-			model := populateModel(et)
+			_spec12().Models[modelName(et.Name(), naming)] = placeHolder
+			model := populateModel(et, naming)
 			_spec12().Models[model.ID] = model
 		}
 	}
@@ -404,7 +453,7 @@ func populatePropertyArray(sf reflect.StructField) (PropertyArray, bool) {
 	return prop, required
 }
 
-func populatePropertyPtr(sf reflect.StructField) (Property, bool) {
+func populatePropertyPtr(sf reflect.StructField, naming string) (Property, bool) {
 	var prop	Property
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -420,10 +469,10 @@ func populatePropertyPtr(sf reflect.StructField) (Property, bool) {
 	}
 
 	if et.Kind() == reflect.Struct {
-		if _, ok := spec12.Models[et.Name()]; !ok {
+		if _, ok := spec12.Models[modelName(et.Name(), naming)]; !ok {
 			var placeHolder		Model
-			_spec12().Models[et.Name()] = placeHolder
-			model := populateModel(et)
+			_spec12().Models[modelName(et.Name(), naming)] = placeHolder
+			model := populateModel(et, naming)
 			_spec12().Models[model.ID] = model
 		}
 	}
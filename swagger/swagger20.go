@@ -2,6 +2,7 @@ package swagger
 
 import (
 	"github.com/rmullinnix/gorest"
+	"strconv"
 	"strings"
 	"reflect"
 	"regexp"
@@ -164,14 +165,14 @@ type ResponseObject struct {
 type HeaderObject struct {
 	Description	string			`json:"description"`
 	Type		string			`json:"type"`
-	Format		string			`json:"format"`
-	Items		ItemsObject		`json:"items,omitempty"`
+	Format		string			`json:"format,omitempty"`
+	Items		*ItemsObject		`json:"items,omitempty"`
 	CollectionFormat	string		`json:"collectionFormat,omitempty"`
 	Default		interface{}		`json:"default,omitempty"`
 	Maximum		float64			`json:"maximum,omitempty"`
 	ExclusiveMax	bool			`json:"exclusiveMaximum,omitempty"`
 	Minimum		float64			`json:"minimum,omitempty"`
-	ExclusiveMin	bool			`json:"exclusiveMinimum"`
+	ExclusiveMin	bool			`json:"exclusiveMinimum,omitempty"`
 	MaxLength	int32			`json:"maxLength,omitempty"`
 	MinLength	int32			`json:"minLength,omitempty"`
 	Pattern		string			`json:"pattern,omitempty"`
@@ -314,6 +315,8 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 		var api		PathItem
 		var existing	bool
 
+		naming := svcTypes[ep.ServiceName()].JSONOptions.Naming
+
 		path := "/" + cleanPath(ep.Signiture)
 		path = strings.TrimPrefix(path, basePath)
 
@@ -330,7 +333,7 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 		if field, found := svcInt.FieldByName(ep.Name); found {
 			temp := strings.Join(strings.Fields(string(field.Tag)), " ")
 			tags := reflect.StructTag(temp)
-			op = populateOperationObject(tags, ep)
+			op = populateOperationObject(tags, ep, naming)
 		}
 
 		op.Consumes = append(op.Consumes, ep.ConsumesMime...)
@@ -355,9 +358,13 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 			api.Patch = &op
 		case "HEAD":
 			api.Head = &op
+		case "WS":
+			// documented as the GET request upgraded to a websocket
+			op.Schemes = []string{"ws", "wss"}
+			api.Get = &op
 		}
 
-		op.Parameters = make([]ParameterObject, len(ep.Params) + len(ep.QueryParams))
+		op.Parameters = make([]ParameterObject, len(ep.Params) + len(ep.QueryParams) + len(ep.FormParams))
 		pnum := 0
 		for j := 0; j < len(ep.Params); j++ {
 			var par		ParameterObject
@@ -373,21 +380,67 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 		}
 
 		for j := 0; j < len(ep.QueryParams); j++ {
-			var par		ParameterObject
+			op.Parameters[pnum] = populateParameter("query", ep.QueryParams[j])
+			pnum++
+		}
 
-			par.In = "query"
-			par.Name = ep.QueryParams[j].Name
-			par.Type, par.Format = primitiveFormat(ep.QueryParams[j].TypeName)
-			if par.Type == "array" {
-				var items	ItemsObject
-				items.Type, items.Format = primitiveFormat(ep.QueryParams[j].TypeName[2:])
-				par.Items = &items
+		for j := 0; j < len(ep.FormParams); j++ {
+			op.Parameters[pnum] = populateParameter("formData", ep.FormParams[j])
+			pnum++
+		}
+
+		// fields of the output tagged header:"Name" are sent as response headers
+		if methType := svcInt.Method(ep.MethodNumberInParent).Type; methType.NumOut() > 0 {
+			if headers := gorest.OutputHeaders(methType.Out(0)); len(headers) > 0 {
+				if op.Responses == nil {
+					op.Responses = make(map[string]ResponseObject, 0)
+				}
+				populateResponseHeaders(op.Responses, headers)
 			}
-			par.Description = ""
-			par.Required = false
+		}
 
-			op.Parameters[pnum] = par
-			pnum++
+		if ep.Filename != "" {
+			if op.Responses == nil {
+				op.Responses = make(map[string]ResponseObject, 0)
+			}
+			for _, code := range successCodes(op.Responses) {
+				resp := op.Responses[code]
+				if resp.Headers == nil {
+					resp.Headers = make(map[string]HeaderObject, 0)
+				}
+				resp.Headers["Content-Disposition"] = HeaderObject{Description: "attachment; filename=" + ep.Filename, Type: "string"}
+				op.Responses[code] = resp
+			}
+		}
+
+		if ep.SparseFields {
+			par := populateParameter("query", gorest.Param{Name: "fields", TypeName: "string"})
+			par.Description = "Comma separated field paths to return, e.g. name,address.city"
+			op.Parameters = append(op.Parameters, par)
+		}
+
+		if ep.Pagination != nil {
+			for _, p := range ep.Pagination.Params() {
+				par := populateParameter("query", p)
+				if p.Name == "limit" {
+					par.Description = "The number of items of the page, at most " + strconv.Itoa(ep.Pagination.MaxLimit)
+				}
+				op.Parameters = append(op.Parameters, par)
+			}
+
+			if op.Responses == nil {
+				op.Responses = make(map[string]ResponseObject, 0)
+			}
+			resp, found := op.Responses["200"]
+			if !found {
+				resp.Description = "OK"
+			}
+			if resp.Headers == nil {
+				resp.Headers = make(map[string]HeaderObject, 0)
+			}
+			resp.Headers["Link"] = HeaderObject{Description: "Links to the first, prev, next and last pages", Type: "string"}
+			resp.Headers["X-Total-Count"] = HeaderObject{Description: "The number of items in all pages", Type: "integer", Format: "int32"}
+			op.Responses["200"] = resp
 		}
 
 		if ep.PostdataType != "" {
@@ -399,12 +452,61 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 			par.Required = true
 
 			var schema	SchemaObject
-			schema.Ref = "#/definitions/" + ep.PostdataType
+			if ep.PostdataIsPatch {
+				schema = populatePatchSchema(ep.ConsumesMime)
+				par.Name = "patch"
+				par.Description = schema.Description
+				if _, ok := spec20.Definitions["PatchOperation"]; !ok && schema.Type != "object" {
+					spec20.Definitions["PatchOperation"] = populatePatchOperation()
+				}
+			} else {
+				var item	SchemaObject
+				if isPrimitive(ep.PostdataType) {
+					item.Type, item.Format = primitiveFormat(ep.PostdataType)
+				} else {
+					item.Ref = "#/definitions/" + modelName(ep.PostdataType, naming)
+				}
+
+				if ep.PostdataTypeIsArray {
+					schema.Type = "array"
+					schema.Items = &item
+				} else if ep.PostdataTypeIsMap {
+					schema.Type = "object"
+					schema.AdditionalProps = &item
+				} else {
+					schema = item
+				}
+				if hasXMLMime(ep.ConsumesMime, spec20.Consumes) {
+					populateXMLObject(&schema, ep.PostdataType, ep.XMLRoot, ep.XMLItem)
+				}
+			}
 			par.Schema = &schema
 
 			op.Parameters = append(op.Parameters, par)
 		}
 
+		if ep.PreconditionRequired {
+			var par		ParameterObject
+
+			par.In = "header"
+			par.Name = "If-Match"
+			par.Type = "string"
+			par.Description = "Entity tag of the current version of the resource"
+			par.Required = true
+
+			op.Parameters = append(op.Parameters, par)
+
+			if op.Responses == nil {
+				op.Responses = make(map[string]ResponseObject, 0)
+			}
+			if _, found := op.Responses["412"]; !found {
+				op.Responses["412"] = ResponseObject{Description: "Precondition Failed"}
+			}
+			if _, found := op.Responses["428"]; !found {
+				op.Responses["428"] = ResponseObject{Description: "Precondition Required"}
+			}
+		}
+
 //		if (!existing) {
 			spec20.Paths[path] = api
 //		}
@@ -415,14 +517,14 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 		// skip the fuction class pointer
 		for i := 1; i < methType.NumIn(); i++ {
 			inType := methType.In(i)
-			if inType.Kind() == reflect.Struct {
-				if _, ok := spec20.Definitions[inType.Name()]; ok {
+			if inType.Kind() == reflect.Struct && !gorest.IsInjectedType(inType) {
+				if _, ok := spec20.Definitions[modelName(inType.Name(), naming)]; ok {
 					continue  // definition already exists
 				}
 
-				schema := populateDefinitions(inType)
+				schema := populateDefinitions(inType, naming)
 
-				spec20.Definitions[inType.Name()] = schema
+				spec20.Definitions[modelName(inType.Name(), naming)] = schema
 			}
 
 			// inType.Kind() == reflect.Slice (arrays)
@@ -430,15 +532,18 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 
 		for i := 0; i < methType.NumOut(); i++ {
 			outType := methType.Out(i)
+			if outType == pageType {
+				continue  // the items of the page are documented by the output tag
+			}
 			if outType.Kind() == reflect.Struct {
-				if _, ok := spec20.Definitions[outType.Name()]; ok {
+				if _, ok := spec20.Definitions[modelName(outType.Name(), naming)]; ok {
 					continue  // definition already exists
 				}
 
-				schema := populateDefinitions(outType)
+				schema := populateDefinitions(outType, naming)
 
-				spec20.Definitions[outType.Name()] = schema
-			}  else if outType.Kind() == reflect.Slice {
+				spec20.Definitions[modelName(outType.Name(), naming)] = schema
+			}  else if outType.Kind() == reflect.Slice || outType.Kind() == reflect.Chan {
 				et := outType.Elem()
 				parts := strings.Split(et.String(), ".")
 				name := ""
@@ -449,13 +554,13 @@ func swaggerDocumentor20(basePath string, svcTypes map[string]gorest.ServiceMeta
 				}
 
 				if et.Kind() == reflect.Struct {
-					if _, ok := spec20.Definitions[name]; ok {
+					if _, ok := spec20.Definitions[modelName(name, naming)]; ok {
 						continue  // definition already exists
 					}
 
-					schema := populateDefinitions(et)
+					schema := populateDefinitions(et, naming)
 	
-					spec20.Definitions[name] = schema
+					spec20.Definitions[modelName(name, naming)] = schema
 				}
 			}
 		}
@@ -534,7 +639,7 @@ func populateTags(tags reflect.StructTag) []Tag {
 	return taglist
 }
 
-func populateOperationObject(tags reflect.StructTag, ep gorest.EndPointStruct) OperationObject {
+func populateOperationObject(tags reflect.StructTag, ep gorest.EndPointStruct, naming string) OperationObject {
 	var op	OperationObject
 
 	op.Tags = make([]string, 0)
@@ -562,12 +667,12 @@ func populateOperationObject(tags reflect.StructTag, ep gorest.EndPointStruct) O
 		op.Tags = append(op.Tags, parts...)
 	}
 
-	op.Responses = populateResponseObject(tags, ep)
+	op.Responses = populateResponseObject(tags, ep, naming)
 
 	return op
 }
 
-func populateResponseObject(tags reflect.StructTag, ep gorest.EndPointStruct) map[string]ResponseObject {
+func populateResponseObject(tags reflect.StructTag, ep gorest.EndPointStruct, naming string) map[string]ResponseObject {
 	var responses	map[string]ResponseObject
 	var tag		string
 
@@ -589,14 +694,19 @@ func populateResponseObject(tags reflect.StructTag, ep gorest.EndPointStruct) ma
 				if cd_msg[2] == "output}" {
 					var schema	SchemaObject
 
-					if ep.OutputTypeIsArray {
+					if ep.OutputTypeIsEvents {
+						// text/event-stream
+						schema.Type = "string"
+					} else if ep.OutputTypeIsBinary {
+						schema.Type = "file"
+					} else if ep.OutputTypeIsArray || ep.OutputTypeIsStream {
 						schema.Type = "array"
 						var items	SchemaObject
 
 						if isPrimitive(ep.OutputType)  {
 							items.Type, items.Format = primitiveFormat(ep.OutputType)
 						} else {
-							items.Ref = "#/definitions/" + ep.OutputType
+							items.Ref = "#/definitions/" + modelName(ep.OutputType, naming)
 						}
 
 						schema.Items = &items
@@ -608,16 +718,21 @@ func populateResponseObject(tags reflect.StructTag, ep gorest.EndPointStruct) ma
 						if isPrimitive(ep.OutputType) {
 							valSchema.Type, valSchema.Format = primitiveFormat(ep.OutputType)
 						} else {
-							valSchema.Ref = "#/definitions/" + ep.OutputType
+							valSchema.Ref = "#/definitions/" + modelName(ep.OutputType, naming)
 						}
 						schema.AdditionalProps = &valSchema
 					} else {
 						if isPrimitive(ep.OutputType)  {
 							schema.Type, schema.Format = primitiveFormat(ep.OutputType)
 						} else {
-							schema.Ref = "#/definitions/" + ep.OutputType
+							schema.Ref = "#/definitions/" + modelName(ep.OutputType, naming)
 						}
 					}
+					if ep.Pagination != nil && ep.Pagination.Envelope {
+						schema = populatePageEnvelope(schema)
+					} else if ep.Pagination == nil && !ep.OutputTypeIsEvents && !ep.OutputTypeIsBinary && hasXMLMime(ep.ProducesMime, spec20.Produces) {
+						populateXMLObject(&schema, ep.OutputType, ep.XMLRoot, ep.XMLItem)
+					}
 					resp.Schema = &schema
 				}
 			}
@@ -628,7 +743,201 @@ func populateResponseObject(tags reflect.StructTag, ep gorest.EndPointStruct) ma
 	return responses
 }
 
-func populateDefinitions(t reflect.Type) SchemaObject {
+// output headers are documented on the successful responses, or a 200 response if none are declared
+func populateResponseHeaders(responses map[string]ResponseObject, headers []gorest.OutputHeader) {
+	for _, code := range successCodes(responses) {
+		resp := responses[code]
+		if resp.Headers == nil {
+			resp.Headers = make(map[string]HeaderObject, 0)
+		}
+
+		for _, h := range headers {
+			var header	HeaderObject
+
+			typeName := h.Field.Type.String()
+			header.Type, header.Format = primitiveFormat(typeName)
+			if header.Type == "array" {
+				var items	ItemsObject
+				items.Type, items.Format = primitiveFormat(typeName[2:])
+				header.Items = &items
+			}
+			header.Description = h.Field.Tag.Get("sw.description")
+
+			resp.Headers[h.Name] = header
+		}
+		responses[code] = resp
+	}
+}
+
+// the 2xx responses of an operation, adding a 200 response when there are none
+func successCodes(responses map[string]ResponseObject) []string {
+	codes := make([]string, 0)
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		responses["200"] = ResponseObject{Description: "OK"}
+		codes = append(codes, "200")
+	}
+	return codes
+}
+
+// whether the operation, or the api when the operation does not say, uses xml
+func hasXMLMime(mimes []string, apiMimes []string) bool {
+	if len(mimes) == 0 {
+		mimes = apiMimes
+	}
+	for _, mime := range mimes {
+		if strings.Contains(mime, "xml") {
+			return true
+		}
+	}
+	return false
+}
+
+// names the elements of an array, map or primitive as the xml marshaller writes them: a root element
+// holding an element per item
+func populateXMLObject(schema *SchemaObject, typeName string, root string, item string) {
+	switch {
+	case schema.Items != nil:
+		root, item = gorest.XMLCollectionNames(typeName, root, item)
+		schema.Xml = &XMLObject{Name: root, Wrapped: true}
+		schema.Items.Xml = &XMLObject{Name: item}
+	case schema.AdditionalProps != nil:
+		root, item = gorest.XMLCollectionNames(typeName, root, item)
+		schema.Xml = &XMLObject{Name: root}
+		schema.AdditionalProps.Xml = &XMLObject{Name: item}
+	case root != "":
+		schema.Xml = &XMLObject{Name: root}
+	}
+}
+
+// paginated responses declared with the envelope option wrap the items with the total and links
+func populatePageEnvelope(items SchemaObject) SchemaObject {
+	var schema	SchemaObject
+
+	schema.Type = "object"
+	schema.Required = []string{"items"}
+	schema.Properties = map[string]SchemaObject{
+		"items": items,
+		"total": SchemaObject{Type: "integer", Format: "int32"},
+		"first": SchemaObject{Type: "string"},
+		"prev":  SchemaObject{Type: "string"},
+		"next":  SchemaObject{Type: "string"},
+		"last":  SchemaObject{Type: "string"},
+	}
+	return schema
+}
+
+// query and form parameters share the same declaration rules (required, default)
+func populateParameter(in string, p gorest.Param) ParameterObject {
+	var par		ParameterObject
+
+	par.In = in
+	par.Name = p.Name
+	par.Type, par.Format = primitiveFormat(p.TypeName)
+	if par.Type == "array" {
+		var items	ItemsObject
+		items.Type, items.Format = primitiveFormat(p.TypeName[2:])
+		par.Items = &items
+		if in == "formData" {
+			par.CollectionFormat = "multi"
+		}
+	}
+	par.Description = ""
+	par.Required = p.Required
+
+	if p.Default != "" {
+		par.Default = p.Default
+		switch par.Type {
+		case "integer":
+			if n, err := strconv.ParseInt(p.Default, 10, 64); err == nil {
+				par.Default = n
+			}
+		case "number":
+			if n, err := strconv.ParseFloat(p.Default, 64); err == nil {
+				par.Default = n
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(p.Default); err == nil {
+				par.Default = b
+			}
+		}
+	}
+
+	return par
+}
+
+const (
+	mergePatchDesc	= "JSON Merge Patch document (RFC 7396)"
+	jsonPatchDesc	= "JSON Patch document (RFC 6902)"
+)
+
+// the patch body is described by its format rather than by the Go type of
+// the resource, since a patch document is not the resource itself
+func populatePatchSchema(consumes []string) SchemaObject {
+	var schema	SchemaObject
+
+	merge := false
+	patch := false
+	for _, mime := range consumes {
+		switch mime {
+		case gorest.Application_MergePatch_Json, gorest.Application_Json:
+			merge = true
+		case gorest.Application_JsonPatch_Json:
+			patch = true
+		}
+	}
+
+	switch {
+	case merge && patch:
+		schema.Description = mergePatchDesc + " or " + jsonPatchDesc + ", selected by Content-Type"
+	case patch:
+		var items	SchemaObject
+		items.Ref = "#/definitions/PatchOperation"
+		schema.Type = "array"
+		schema.Items = &items
+		schema.Description = jsonPatchDesc
+	default:
+		schema.Type = "object"
+		schema.Description = mergePatchDesc
+	}
+
+	return schema
+}
+
+func populatePatchOperation() SchemaObject {
+	var model	SchemaObject
+
+	model.Description = "A single JSON Patch (RFC 6902) operation"
+	model.Required = []string{"op", "path"}
+	model.Properties = make(map[string]SchemaObject)
+
+	var op	SchemaObject
+	op.Type = "string"
+	op.Enum = []interface{}{"add", "remove", "replace", "move", "copy", "test"}
+	model.Properties["op"] = op
+
+	var path	SchemaObject
+	path.Type = "string"
+	path.Description = "JSON Pointer to the target location"
+	model.Properties["path"] = path
+
+	var from	SchemaObject
+	from.Type = "string"
+	from.Description = "JSON Pointer to the source location (move, copy)"
+	model.Properties["from"] = from
+
+	var value	SchemaObject
+	value.Description = "Value to add, replace or test"
+	model.Properties["value"] = value
+
+	return model
+}
+
+func populateDefinitions(t reflect.Type, naming string) SchemaObject {
 	var model	SchemaObject
 
 	model.Description = ""			// not able to tag struct definition
@@ -637,30 +946,37 @@ func populateDefinitions(t reflect.Type) SchemaObject {
 
 	for k := 0; k < t.NumField(); k++ {
 		sMem := t.Field(k)
+		if sMem.Tag.Get("header") != "" || sMem.Tag.Get("status") == "true" {
+			continue	// sent as response headers, not in the body
+		}
+		name := propertyName(sMem, naming)
+		if name == "" {
+			continue	// not marshalled
+		}
 		switch sMem.Type.Kind() {
 			case reflect.Slice, reflect.Array:
-				prop, required := populateDefinitionArray(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populateDefinitionArray(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 			case reflect.Map:
-				prop, required := populateDefinitionMap(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populateDefinitionMap(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 			case reflect.Ptr:
-				prop, required := populateDefinitionPtr(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populateDefinitionPtr(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 			default:
-				prop, required := populateDefinition(sMem)
-				model.Properties[sMem.Name] = prop
+				prop, required := populateDefinition(sMem, naming)
+				model.Properties[name] = prop
 				if required {
-					model.Required = append(model.Required, sMem.Name)
+					model.Required = append(model.Required, name)
 				}
 		}
 	}
@@ -668,7 +984,7 @@ func populateDefinitions(t reflect.Type) SchemaObject {
 	return model
 }
 
-func populateDefinition(sf reflect.StructField) (SchemaObject, bool) {
+func populateDefinition(sf reflect.StructField, naming string) (SchemaObject, bool) {
 	var prop	SchemaObject
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -685,11 +1001,11 @@ func populateDefinition(sf reflect.StructField) (SchemaObject, bool) {
 
 		if (prop.Type == "object")  {
 			ok := false
-			if _, ok = spec20.Definitions[sf.Type.Name()]; !ok {
-				schema := populateDefinitions(sf.Type)
-				_spec20().Definitions[sf.Type.Name()] = schema
+			if _, ok = spec20.Definitions[modelName(sf.Type.Name(), naming)]; !ok {
+				schema := populateDefinitions(sf.Type, naming)
+				_spec20().Definitions[modelName(sf.Type.Name(), naming)] = schema
 			}
-			prop.Ref = "#/definitions/" + sf.Type.Name()
+			prop.Ref = "#/definitions/" + modelName(sf.Type.Name(), naming)
 		}
 	} else {
 		prop.Type, prop.Format = primitiveFormat(sf.Type.String())
@@ -710,7 +1026,7 @@ func populateDefinition(sf reflect.StructField) (SchemaObject, bool) {
 	return prop, required
 }
 
-func populateDefinitionArray(sf reflect.StructField) (SchemaObject, bool) {
+func populateDefinitionArray(sf reflect.StructField, naming string) (SchemaObject, bool) {
 	var prop	SchemaObject
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -733,7 +1049,7 @@ func populateDefinitionArray(sf reflect.StructField) (SchemaObject, bool) {
 
 	if et.Kind() == reflect.Struct {
 		items.Type = ""
-		items.Ref = "#/definitions/" + name
+		items.Ref = "#/definitions/" + modelName(name, naming)
 	} else {
 		items.Type = items.Type
 	}
@@ -741,12 +1057,12 @@ func populateDefinitionArray(sf reflect.StructField) (SchemaObject, bool) {
 	prop.Items = &items
 
 	if et.Kind() == reflect.Struct {
-		if _, ok := spec20.Definitions[et.Name()]; !ok {
+		if _, ok := spec20.Definitions[modelName(et.Name(), naming)]; !ok {
 			// set placeholder to prevent deal with recursive structures
 			var placeHolder         SchemaObject
-			_spec20().Definitions[et.Name()] = placeHolder
-			model := populateDefinitions(et)
-			_spec20().Definitions[et.Name()] = model
+			_spec20().Definitions[modelName(et.Name(), naming)] = placeHolder
+			model := populateDefinitions(et, naming)
+			_spec20().Definitions[modelName(et.Name(), naming)] = model
 		}
 	}
 
@@ -770,7 +1086,7 @@ func populateDefinitionArray(sf reflect.StructField) (SchemaObject, bool) {
 	return prop, required
 }
 
-func populateDefinitionMap(sf reflect.StructField) (SchemaObject, bool) {
+func populateDefinitionMap(sf reflect.StructField, naming string) (SchemaObject, bool) {
 	var prop	SchemaObject
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -793,18 +1109,18 @@ func populateDefinitionMap(sf reflect.StructField) (SchemaObject, bool) {
 
 	if et.Kind() == reflect.Struct {
 		aProps.Type = ""
-		aProps.Ref = "#/definitions/" + name
+		aProps.Ref = "#/definitions/" + modelName(name, naming)
 	}
 
 	prop.AdditionalProps = &aProps
 
 	if et.Kind() == reflect.Struct {
-		if _, ok := spec20.Definitions[et.Name()]; !ok {
+		if _, ok := spec20.Definitions[modelName(et.Name(), naming)]; !ok {
 			// set placeholder to prevent deal with recursive structures
 			var placeHolder         SchemaObject
-			_spec20().Definitions[et.Name()] = placeHolder
-			model := populateDefinitions(et)
-			_spec20().Definitions[et.Name()] = model
+			_spec20().Definitions[modelName(et.Name(), naming)] = placeHolder
+			model := populateDefinitions(et, naming)
+			_spec20().Definitions[modelName(et.Name(), naming)] = model
 		}
 	}
 
@@ -828,7 +1144,7 @@ func populateDefinitionMap(sf reflect.StructField) (SchemaObject, bool) {
 	return prop, required
 }
 
-func populateDefinitionPtr(sf reflect.StructField) (SchemaObject, bool) {
+func populateDefinitionPtr(sf reflect.StructField, naming string) (SchemaObject, bool) {
 	var prop        SchemaObject
 
 	stmp := strings.Join(strings.Fields(string(sf.Tag)), " ")
@@ -844,11 +1160,11 @@ func populateDefinitionPtr(sf reflect.StructField) (SchemaObject, bool) {
 	}
 
 	if et.Kind() == reflect.Struct {
-		if _, ok := spec20.Definitions[et.Name()]; !ok {
+		if _, ok := spec20.Definitions[modelName(et.Name(), naming)]; !ok {
 			var placeHolder         SchemaObject
-			_spec20().Definitions[et.Name()] = placeHolder
-			model := populateDefinitions(et)
-			_spec20().Definitions[et.Name()] = model
+			_spec20().Definitions[modelName(et.Name(), naming)] = placeHolder
+			model := populateDefinitions(et, naming)
+			_spec20().Definitions[modelName(et.Name(), naming)] = model
 		}
 	}
 
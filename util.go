@@ -27,12 +27,13 @@ package gorest
 
 import (
 	"bytes"
+	"github.com/rmullinnix/logger"
 	"io"
 	"io/ioutil"
 	"errors"
+	"net/http"
 	"reflect"
 	"strconv"
-	"strings"
 )
 
 //Marshals the data in interface i into a byte slice, using the Marhaller/Unmarshaller specified in mime.
@@ -44,17 +45,9 @@ func Marshal(i interface{}, mime string) (io.ReadCloser, error) {
 //Marshals the data in interface i into a byte slice, using the Marhaller/Unmarshaller specified in mime.
 //The Marhaller/Unmarshaller must have been registered before using gorest.RegisterMarshaller
 func interfaceToBytes(i interface{}, mime string) (io.ReadCloser, error) {
-	marshalType := mime
-
-	if strings.Contains(mime, "json") {
-		marshalType = "json"
-	} else if strings.Contains(mime, "xml") {
-		marshalType = "xml"
-	}
-
-	m := GetMarshallerByMime(marshalType)
+	m := marshallerFor(mime)
 	if m != nil {
-		return m.Marshal(i)
+		return asMarshaller(m).Marshal(i)
 	}
 
 	v := reflect.ValueOf(i)
@@ -65,20 +58,19 @@ func interfaceToBytes(i interface{}, mime string) (io.ReadCloser, error) {
 	case reflect.Bool:
 		x := v.Bool()
 		if x {
-			return ioutil.NopCloser(bytes.NewBuffer([]byte("true"))), nil
+			return newBytesPacket([]byte("true")), nil
 		}
-		return ioutil.NopCloser(bytes.NewBuffer([]byte("false"))), nil
+		return newBytesPacket([]byte("false")), nil
 	case reflect.String:
-		return ioutil.NopCloser(bytes.NewBuffer([]byte(v.String()))), nil
+		return newBytesPacket([]byte(v.String())), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return ioutil.NopCloser(bytes.NewBuffer([]byte(strconv.FormatInt(v.Int(), 10)))), nil
+		return newBytesPacket([]byte(strconv.FormatInt(v.Int(), 10))), nil
 	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
-		m := GetMarshallerByMime(marshalType)
-		return m.Marshal(i)
+		return nil, errors.New("No Marshaller registered for mime type " + mime)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return ioutil.NopCloser(bytes.NewBuffer([]byte(strconv.FormatUint(v.Uint(), 10)))), nil
+		return newBytesPacket([]byte(strconv.FormatUint(v.Uint(), 10))), nil
 	case reflect.Float32, reflect.Float64:
-		return ioutil.NopCloser(bytes.NewBuffer([]byte(strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())))), nil
+		return newBytesPacket([]byte(strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))), nil
 	case reflect.Invalid:
 		return nil, errors.New("Type is invalid!")
 	default:
@@ -86,6 +78,102 @@ func interfaceToBytes(i interface{}, mime string) (io.ReadCloser, error) {
 	}
 }
 
+//Makes the response entity for interface i. With a registered Marshaller the entity is encoded as it
+//is written, rather than marshalled into a buffer up front.
+func newEntityPacket(i interface{}, mime string) (io.ReadCloser, error) {
+	if m := marshallerFor(mime); m != nil {
+		return &entityPacket{entity: i, marshaller: m}, nil
+	}
+	return interfaceToBytes(i, mime)
+}
+
+//An entity encoded on demand. io.Copy uses WriteTo, which encodes straight into the response. Reading
+//it, as etags and the server cache do, encodes it into a buffer first.
+type entityPacket struct {
+	entity		interface{}
+	marshaller	StreamMarshaller
+	buf		io.Reader
+}
+
+func (this *entityPacket) Read(p []byte) (int, error) {
+	if this.buf == nil {
+		var buf	bytes.Buffer
+		if err := this.marshaller.Encode(&buf, this.entity); err != nil {
+			return 0, err
+		}
+		this.buf = &buf
+	}
+	return this.buf.Read(p)
+}
+
+func (this *entityPacket) WriteTo(w io.Writer) (int64, error) {
+	if this.buf != nil {
+		return io.Copy(w, this.buf)
+	}
+	cw := &countingWriter{w: w}
+	err := this.marshaller.Encode(cw, this.entity)
+	return cw.n, err
+}
+
+func (this *entityPacket) Close() error {
+	return nil
+}
+
+type countingWriter struct {
+	w	io.Writer
+	n	int64
+}
+
+func (this *countingWriter) Write(p []byte) (int, error) {
+	n, err := this.w.Write(p)
+	this.n += int64(n)
+	return n, err
+}
+
+//An entity already held in memory
+type bytesPacket struct {
+	*bytes.Reader
+	data	[]byte
+}
+
+func newBytesPacket(data []byte) io.ReadCloser {
+	return bytesPacket{bytes.NewReader(data), data}
+}
+
+func (this bytesPacket) Close() error {
+	return nil
+}
+
+func (this bytesPacket) size() int64 {
+	return int64(this.Len())
+}
+
+//The number of bytes left in the response entity, -1 if it is not known before it is written
+func packetSize(packet io.Reader) int64 {
+	if sized, ok := packet.(interface{ size() int64 }); ok {
+		return sized.size()
+	}
+	return -1
+}
+
+//The bytes of the response entity, encoding it into memory if it is encoded as it is written. Etags and
+//the server cache need them. An entity that fails to encode is replaced by a 500 problem.
+func (this *ResponseBuilder) entityBytes() ([]byte, bool) {
+	if packet, isBytes := this.ctx.respPacket.(bytesPacket); isBytes && packet.size() == int64(len(packet.data)) {
+		return packet.data, true
+	}
+
+	data, err := ioutil.ReadAll(this.ctx.respPacket)
+	this.ctx.respPacket.Close()
+	if err != nil {
+		logger.Error.Println("[gen] could not marshal response: " + err.Error())
+		this.SetProblem(NewProblem(http.StatusInternalServerError, "Internal server error. Could not Marshal/UnMarshal data: " + err.Error()))
+		return nil, false
+	}
+	this.ctx.respPacket = newBytesPacket(data)
+	return data, true
+}
+
 //Unmarshals the data in buf into interface i, using the Marhaller/Unmarshaller specified in mime.
 //The Marhaller/Unmarshaller must have been registered before using gorest.RegisterMarshaller
 func Unmarshal(buf *bytes.Buffer, i interface{}, mime string) error {
@@ -93,14 +181,6 @@ func Unmarshal(buf *bytes.Buffer, i interface{}, mime string) error {
 }
 
 func bytesToInterface(buf *bytes.Buffer, i interface{}, mime string) error {
-	marshalType := mime
-
-	if strings.Contains(mime, "json") {
-		marshalType = "json"
-	} else if strings.Contains(mime, "xml") {
-		marshalType = "xml"
-	}
-
 	v := reflect.ValueOf(i)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -119,8 +199,11 @@ func bytesToInterface(buf *bytes.Buffer, i interface{}, mime string) error {
 		reflect.ValueOf(i).Elem().SetString(buf.String())
 		break
 	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
-		m := GetMarshallerByMime(marshalType)
-		return m.Unmarshal(buf.Bytes(), i)
+		m := marshallerFor(mime)
+		if m == nil {
+			return errors.New("No Marshaller registered for mime type " + mime)
+		}
+		return m.Decode(buf, i)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 
 		n, err := strconv.ParseInt(buf.String(), 10, 64)
@@ -0,0 +1,546 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/rmullinnix/logger"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+//RFC 6455 WebSocket support for endpoints declared with method:"WS". The handler receives the
+//connection as its first argument, followed by any path and query parameters:
+//
+//	type ChatService struct {
+//	    gorest.RestService `root:"/chat/" produces:"application/json,application/xml"`
+//	    room    gorest.EndPoint `method:"WS" path:"/room/{name:string}" security:"oauth2"`
+//	}
+//	func(serv ChatService) Room(conn *gorest.WSConn, name string) {
+//	    var msg Message
+//	    for conn.Receive(&msg) == nil {
+//	        conn.Send(reply(name, msg))
+//	    }
+//	}
+//
+//The connection is upgraded once the request has been authorized, so the security tags protect
+//sockets the same way they protect other endpoints. Messages are marshalled with the Marshaller of
+//the mime type matching the negotiated subprotocol; a client asking for the "xml" subprotocol gets
+//application/xml messages. Without a matching subprotocol the first produces mime type is used.
+//The connection is closed when the handler returns. Browsers may only open sockets from the
+//origins allowed with SetWebSocketOrigins; by default that is the server's own origin.
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const (
+	wsCloseNormal         = 1000
+	wsCloseProtocolError  = 1002
+	wsCloseInvalidPayload = 1007
+	wsCloseTooBig         = 1009
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsCloseTimeout = 5 * time.Second
+)
+
+var (
+	errWSProtocol       = errors.New("WebSocket protocol error")
+	errWSTooBig         = errors.New("WebSocket message exceeds the maximum allowed size")
+	errWSInvalidPayload = errors.New("WebSocket text message is not valid UTF-8")
+	errWSClosed         = errors.New("WebSocket connection is closed")
+)
+
+const wsDefaultMaxMessageSize = 1 << 20
+
+var wsPingInterval = 30 * time.Second
+var wsMaxMessageSize int64 = wsDefaultMaxMessageSize
+var wsAllowedOrigins []string
+
+//Sets how often gorest pings WebSocket clients. A client that sends nothing, not even a pong,
+//for two intervals is disconnected. The default is 30 seconds; a value <= 0 disables pings.
+func SetWebSocketPingInterval(interval time.Duration) {
+	wsPingInterval = interval
+}
+
+//Sets the maximum number of bytes of a message received on a WebSocket, once its fragments are
+//reassembled. Larger messages close the connection with status 1009. The default is 1MB; a value
+//<= 0 restores the default, sockets are always bounded.
+func SetWebSocketMaxMessageSize(size int64) {
+	if size <= 0 {
+		size = wsDefaultMaxMessageSize
+	}
+	wsMaxMessageSize = size
+}
+
+//Sets the origins, e.g. "https://example.com", browsers may open WebSockets from. Without any,
+//only the origin of the server itself is allowed; "*" allows every origin. Requests without an
+//Origin header come from clients other than browsers and are not checked.
+func SetWebSocketOrigins(origins ...string) {
+	wsAllowedOrigins = origins
+}
+
+var wsConnType = reflect.TypeOf((*WSConn)(nil))
+
+//A WSConn is an upgraded WebSocket connection exchanging marshalled messages.
+type WSConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	mimeType    string
+	jsonOptions JSONOptions
+	subprotocol string
+	messages    chan []byte
+	closing     chan struct{}
+	readerDone  chan struct{}
+	closeOnce   sync.Once
+	writeMutex  sync.Mutex
+	closeSent   bool  // guarded by writeMutex
+	lastSeen    int64 // unix nanoseconds of the last frame received
+}
+
+//Whether the request asks to be upgraded to a WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == GET && headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Picks the first subprotocol offered by the client that names one of the produced mime
+//types by its subtype (e.g. json for application/json). Returns the subprotocol, which is
+//empty if none matched, and the mime type used for messages.
+func selectSubprotocol(r *http.Request, produces []string) (string, string) {
+	for _, value := range r.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+		for _, offered := range strings.Split(value, ",") {
+			offered = strings.TrimSpace(offered)
+			for _, mimeType := range produces {
+				if i := strings.Index(mimeType, "/"); i > -1 && strings.EqualFold(mimeType[i+1:], offered) {
+					return offered, mimeType
+				}
+			}
+		}
+	}
+
+	if len(produces) > 0 {
+		return "", produces[0]
+	}
+	return "", Application_Json
+}
+
+//Whether the Origin of the request may open a WebSocket
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(wsAllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range wsAllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+wsGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//Completes the opening handshake and takes over the connection. A Problem is returned if the
+//handshake is invalid; once the connection is hijacked nothing more is written by the ResponseBuilder.
+func upgradeWebSocket(rb *ResponseBuilder, produces []string) (*WSConn, *Problem) {
+	r := rb.ctx.request
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		rb.SetHeader("Sec-WebSocket-Version", "13")
+		return nil, NewProblem(http.StatusUpgradeRequired, "Unsupported WebSocket version, expecting 13")
+	}
+
+	if !checkWebSocketOrigin(r) {
+		return nil, NewProblem(http.StatusForbidden, "WebSocket connections are not allowed from origin " + r.Header.Get("Origin"))
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		return nil, NewProblem(http.StatusBadRequest, "Invalid Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := rb.writer().(http.Hijacker)
+	if !ok {
+		return nil, NewProblem(http.StatusInternalServerError, "WebSocket upgrade is not supported by the server")
+	}
+
+	subprotocol, mimeType := selectSubprotocol(r, produces)
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, NewProblem(http.StatusInternalServerError, "WebSocket upgrade failed: " + err.Error())
+	}
+	rb.ctx.dataHasBeenWritten = true
+	rb.SetResponseCode(http.StatusSwitchingProtocols)
+
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n"
+	if subprotocol != "" {
+		response += "Sec-WebSocket-Protocol: " + subprotocol + "\r\n"
+	}
+	response += "\r\n"
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err = conn.Write([]byte(response)); err != nil {
+		logger.Error.Println("[gen] could not complete WebSocket handshake: " + err.Error())
+		conn.Close()
+		return nil, nil
+	}
+
+	return newWSConn(conn, rw.Reader, subprotocol, mimeType, rb.ctx.jsonOptions), nil
+}
+
+func newWSConn(conn net.Conn, reader *bufio.Reader, subprotocol string, mimeType string, options JSONOptions) *WSConn {
+	ws := &WSConn{
+		conn:        conn,
+		reader:      reader,
+		mimeType:    mimeType,
+		jsonOptions: options,
+		subprotocol: subprotocol,
+		messages:    make(chan []byte),
+		closing:     make(chan struct{}),
+		readerDone:  make(chan struct{}),
+		lastSeen:    time.Now().UnixNano(),
+	}
+
+	go ws.readLoop()
+	go ws.keepalive()
+
+	return ws
+}
+
+//The negotiated subprotocol, empty if none was agreed
+func (this *WSConn) Subprotocol() string {
+	return this.subprotocol
+}
+
+//The mime type messages are marshalled with
+func (this *WSConn) MimeType() string {
+	return this.mimeType
+}
+
+//Returns a channel that is closed once the connection is closed by either side
+func (this *WSConn) Done() <-chan struct{} {
+	return this.readerDone
+}
+
+//Waits for the next message and unmarshals it into v. A *[]byte receives the raw message.
+//Returns io.EOF once the connection is closed.
+func (this *WSConn) Receive(v interface{}) error {
+	data, ok := <-this.messages
+	if !ok {
+		return io.EOF
+	}
+
+	if raw, ok := v.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+
+	if m, isOptions := this.jsonOptions.requestMarshaller(marshallerFor(this.mimeType)).(jsonOptionsDecoder); isOptions {
+		return m.Decode(bytes.NewReader(data), v)
+	}
+	return bytesToInterface(bytes.NewBuffer(data), v, this.mimeType)
+}
+
+//Marshals v and sends it as a message; []byte values are sent as is. Textual mime types
+//are sent as text messages, anything else as binary messages.
+func (this *WSConn) Send(v interface{}) error {
+	data, ok := v.([]byte)
+	if !ok {
+		reader, err := interfaceToBytes(this.jsonOptions.entity(v, this.mimeType), this.mimeType)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if data, err = ioutil.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+
+	opcode := byte(wsOpBinary)
+	if strings.Contains(this.mimeType, "json") || strings.Contains(this.mimeType, "xml") || strings.HasPrefix(this.mimeType, "text/") {
+		opcode = wsOpText
+	}
+
+	return this.writeFrame(opcode, data)
+}
+
+//Starts the closing handshake, waiting a short while for the client to answer before the
+//underlying connection is closed. Safe to call more than once.
+func (this *WSConn) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closing)
+		this.sendClose(wsCloseNormal)
+		select {
+		case <-this.readerDone:
+		case <-time.After(wsCloseTimeout):
+		}
+		this.conn.Close()
+	})
+	return nil
+}
+
+func (this *WSConn) writeFrame(opcode byte, payload []byte) error {
+	this.writeMutex.Lock()
+	defer this.writeMutex.Unlock()
+
+	if this.closeSent {
+		return errWSClosed
+	}
+	if opcode == wsOpClose {
+		this.closeSent = true
+	}
+
+	return this.writeFrameLocked(opcode, payload)
+}
+
+func (this *WSConn) writeFrameLocked(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // server frames are never fragmented nor masked
+	length := len(payload)
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	this.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := this.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *WSConn) sendClose(code int) {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	this.writeFrame(wsOpClose, payload)
+}
+
+//Reads frames until the connection closes, answering control frames and reassembling
+//fragmented messages for Receive
+func (this *WSConn) readLoop() {
+	defer close(this.readerDone)
+	defer close(this.messages)
+	defer this.conn.Close()
+
+	var message []byte
+	var messageOp byte
+
+	for {
+		fin, opcode, payload, err := this.readFrame()
+		if err != nil {
+			switch err {
+			case errWSProtocol:
+				this.sendClose(wsCloseProtocolError)
+			case errWSTooBig:
+				this.sendClose(wsCloseTooBig)
+			}
+			return
+		}
+		atomic.StoreInt64(&this.lastSeen, time.Now().UnixNano())
+
+		switch opcode {
+		case wsOpPing:
+			this.writeFrame(wsOpPong, payload)
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			this.sendClose(code)
+			return
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				this.sendClose(wsCloseProtocolError)
+				return
+			}
+			messageOp = opcode
+			message = payload
+		case wsOpContinuation:
+			if message == nil {
+				this.sendClose(wsCloseProtocolError)
+				return
+			}
+			message = append(message, payload...)
+		default:
+			this.sendClose(wsCloseProtocolError)
+			return
+		}
+
+		if int64(len(message)) > wsMaxMessageSize {
+			this.sendClose(wsCloseTooBig)
+			return
+		}
+
+		if fin {
+			if messageOp == wsOpText && !utf8.Valid(message) {
+				this.sendClose(wsCloseInvalidPayload)
+				return
+			}
+			select {
+			case this.messages <- message:
+			case <-this.closing:
+				return
+			}
+			message = nil
+		}
+	}
+}
+
+func (this *WSConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(this.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	if head[0]&0x70 != 0 || head[1]&0x80 == 0 {
+		// no extensions are negotiated, and clients must mask their frames
+		return false, 0, nil, errWSProtocol
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(this.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(this.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return false, 0, nil, errWSProtocol
+		}
+	}
+
+	if opcode >= wsOpClose && (!fin || length > 125) {
+		return false, 0, nil, errWSProtocol
+	}
+	if length > uint64(wsMaxMessageSize) {
+		return false, 0, nil, errWSTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(this.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(this.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+//Pings the client every interval, dropping it if nothing was received for two intervals
+func (this *WSConn) keepalive() {
+	interval := wsPingInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.readerDone:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&this.lastSeen))) > 2*interval {
+				logger.Warning.Println("[gen] WebSocket client stopped responding, closing connection")
+				this.conn.Close()
+				return
+			}
+			this.writeFrame(wsOpPing, nil)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type WSTestService struct {
+	RestService `root:"/ws-test/" produces:"application/json,application/xml"`
+	echo        EndPoint `method:"WS" path:"/echo/{prefix:string}"`
+}
+
+var wsTestRegister sync.Once
+
+func (serv WSTestService) Echo(conn *WSConn, prefix string) {
+	var msg map[string]string
+	for conn.Receive(&msg) == nil {
+		msg["text"] = prefix + msg["text"]
+		conn.Send(msg)
+	}
+}
+
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) {
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+	conn.Write(frame)
+}
+
+func readServerFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	return head[0] & 0x0F, payload, err
+}
+
+func dialTestSocket(t *testing.T, server *httptest.Server, path string, protocol string, headers ...string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Could not connect to test server:", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET " + path + " HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+	if protocol != "" {
+		request += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	for _, header := range headers {
+		request += header + "\r\n"
+	}
+	conn.Write([]byte(request + "\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal("Could not read handshake response:", err)
+	}
+	return conn, reader, resp
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	wsTestRegister.Do(func() { RegisterService(new(WSTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	conn, reader, resp := dialTestSocket(t, server, "/ws-test/echo/hi-", "chat, json")
+	defer conn.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("Expecting 101 Switching Protocols, got:", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error("Invalid accept key:", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	if resp.Header.Get("Sec-WebSocket-Protocol") != "json" {
+		t.Error("Expecting json subprotocol, got:", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+
+	writeClientFrame(conn, wsOpPing, []byte("ka"))
+	if op, payload, err := readServerFrame(reader); err != nil || op != wsOpPong || string(payload) != "ka" {
+		t.Error("Expecting pong, got:", op, string(payload), err)
+	}
+
+	// fragmented text message
+	first := `{"text":`
+	frame := []byte{wsOpText, 0x80 | byte(len(first)), 0, 0, 0, 0}
+	conn.Write(append(frame, first...))
+	writeClientFrame(conn, wsOpContinuation, []byte(`"there"}`))
+
+	if op, payload, err := readServerFrame(reader); err != nil || op != wsOpText || string(payload) != `{"text":"hi-there"}` {
+		t.Error("Expecting echoed message, got:", op, string(payload), err)
+	}
+
+	writeClientFrame(conn, wsOpClose, []byte{0x03, 0xE8})
+	if op, payload, err := readServerFrame(reader); err != nil || op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Error("Expecting close reply, got:", op, payload, err)
+	}
+}
+
+func TestWebSocketJSONOptions(t *testing.T) {
+	RegisterMarshaller("json", NewJSONMarshaller())
+	server, client := net.Pipe()
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	ws := newWSConn(server, bufio.NewReader(server), "", Application_Json, JSONOptions{Naming: "snake_case"})
+
+	go writeClientFrame(client, wsOpText, []byte(`{"id":"1","first_name":"David"}`))
+	var user User
+	if err := ws.Receive(&user); err != nil || user.Id != "1" || user.FirstName != "David" {
+		t.Error("Expecting the message to be read with the naming of the service, got:", user, err)
+	}
+
+	go ws.Send(user)
+	op, payload, err := readServerFrame(bufio.NewReader(client))
+	expected := `{"id":"1","first_name":"David","last_name":"","age":0,"weight":0}`
+	if err != nil || op != wsOpText || string(payload) != expected {
+		t.Error("Expecting the message to be written with the naming of the service, got:", string(payload), err)
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	wsTestRegister.Do(func() { RegisterService(new(WSTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/ws-test/echo/x", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Error("Expecting 426 for unsupported version, got:", resp.Status)
+	}
+
+	// unmasked client frames are a protocol error
+	conn, reader, _ := dialTestSocket(t, server, "/ws-test/echo/x", "")
+	defer conn.Close()
+	conn.Write([]byte{0x80 | wsOpText, 2, '{', '}'})
+	if op, payload, err := readServerFrame(reader); err != nil || op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseProtocolError {
+		t.Error("Expecting protocol error close, got:", op, payload, err)
+	}
+}
+
+func TestWebSocketOriginAndLimits(t *testing.T) {
+	wsTestRegister.Do(func() { RegisterService(new(WSTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws-test/echo/x")
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Upgrade") != "websocket" {
+		t.Error("Expecting 426 for a plain GET on a WebSocket path, got:", resp.Status)
+	}
+
+	conn, _, resp := dialTestSocket(t, server, "/ws-test/echo/x", "", "Origin: http://evil.example")
+	conn.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Error("Expecting 403 for a foreign origin, got:", resp.Status)
+	}
+
+	conn, _, resp = dialTestSocket(t, server, "/ws-test/echo/x", "", "Origin: http://localhost")
+	conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Error("Expecting the server's own origin to be allowed, got:", resp.Status)
+	}
+
+	SetWebSocketOrigins("http://app.example")
+	defer SetWebSocketOrigins()
+	conn, _, resp = dialTestSocket(t, server, "/ws-test/echo/x", "", "Origin: http://app.example")
+	conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Error("Expecting an allowed origin to connect, got:", resp.Status)
+	}
+
+	SetMaxDecompressedSize(0)
+	defer SetMaxDecompressedSize(defaultMaxDecompressedSize)
+	SetWebSocketMaxMessageSize(8)
+	defer SetWebSocketMaxMessageSize(0)
+
+	conn, reader, _ := dialTestSocket(t, server, "/ws-test/echo/x", "")
+	defer conn.Close()
+	writeClientFrame(conn, wsOpText, []byte(`{"text":"too long"}`))
+	if op, payload, err := readServerFrame(reader); err != nil || op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseTooBig {
+		t.Error("Expecting message too big close, got:", op, payload, err)
+	}
+}
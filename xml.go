@@ -0,0 +1,276 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//A slice, map or primitive written as an xml document of its own, which encoding/xml cannot do. A slice
+//becomes a root element holding an element per item and a map an element per entry, its key in the key
+//attribute:
+//
+//	<items><User key="one"><Id>1</Id>...</User><User key="two">...</User></items>
+//
+//Without the xmlroot and xmlitem tags of the endpoint, or an xmlroot tag of its service, the item is
+//named after its type, or the name in its XMLName tag, and the root is the plural of the item name:
+//Users for User, Categories for Category and items for unnamed types.
+
+type xmlCollection struct {
+	root  string
+	item  string
+	value interface{}
+}
+
+//Wraps v, whose item names are derived from t unless root or item are given
+func newXMLCollection(v interface{}, t reflect.Type, root, item string) xmlCollection {
+	t = derefType(t)
+	if isXMLCollection(t) {
+		if item == "" {
+			item = xmlTypeName(t.Elem())
+		}
+		if root == "" {
+			root = xmlPlural(item)
+		}
+	} else if root == "" {
+		root = xmlTypeName(t)
+	}
+	return xmlCollection{root, item, v}
+}
+
+//Slices (other than []byte, which is text) and maps need a root element to be written as xml
+func isXMLCollection(t reflect.Type) bool {
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Map:
+		return true
+	}
+	return false
+}
+
+//The element name of a type: its XMLName tag, its name, or "item" for unnamed types
+func xmlTypeName(t reflect.Type) string {
+	t = derefType(t)
+	if t.Kind() == reflect.Struct {
+		if f, found := t.FieldByName("XMLName"); found && f.Type == xmlNameType {
+			name := strings.Split(f.Tag.Get("xml"), ",")[0]
+			if i := strings.LastIndex(name, " "); i != -1 {
+				name = name[i+1:] // drop the namespace
+			}
+			if name != "" {
+				return name
+			}
+		}
+	}
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return "item"
+}
+
+//The root and item element names of a collection of the named item type, as they are derived when
+//the xmlroot and xmlitem tags are not given
+func XMLCollectionNames(itemType string, root, item string) (string, string) {
+	if item == "" {
+		item = itemType[strings.LastIndex(itemType, ".")+1:]
+	}
+	if root == "" {
+		root = xmlPlural(item)
+	}
+	return root, item
+}
+
+//The root element name of a collection of items named name
+func xmlPlural(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+func (this xmlCollection) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if this.root != "" {
+		start.Name = xml.Name{Local: this.root}
+	}
+
+	v := reflect.ValueOf(this.value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return e.EncodeElement("", start)
+		}
+		v = v.Elem()
+	}
+	if !isXMLCollection(v.Type()) {
+		return e.EncodeElement(v.Interface(), start)
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Map {
+		for _, key := range sortedMapKeys(v) {
+			attr := xml.Attr{Name: xml.Name{Local: "key"}, Value: formatCell(key)}
+			if err := this.encodeItem(e, v.MapIndex(key), []xml.Attr{attr}); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := 0; i < v.Len(); i++ {
+			if err := this.encodeItem(e, v.Index(i), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+//Writes an item, with the item element name; collections nested in collections are wrapped in turn
+func (this xmlCollection) encodeItem(e *xml.Encoder, v reflect.Value, attrs []xml.Attr) error {
+	start := xml.StartElement{Name: xml.Name{Local: this.item}, Attr: attrs}
+	inner := v
+	for inner.Kind() == reflect.Ptr || inner.Kind() == reflect.Interface {
+		if inner.IsNil() {
+			break
+		}
+		inner = inner.Elem()
+	}
+	if isXMLCollection(inner.Type()) {
+		nested := newXMLCollection(inner.Interface(), inner.Type(), this.item, "")
+		nested.root = ""
+		return e.EncodeElement(nested, start)
+	}
+	return e.EncodeElement(v.Interface(), start)
+}
+
+//Reads a document written by MarshalXML into the slice, array or map value points to. The names of
+//the elements are not checked.
+func (this *xmlCollection) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeXMLCollection(d, reflect.ValueOf(this.value).Elem())
+}
+
+func decodeXMLCollection(d *xml.Decoder, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	case reflect.Array:
+		v.Set(reflect.Zero(v.Type()))
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	}
+
+	for i := 0; ; {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeXMLItem(d, item, element); err != nil {
+				return err
+			}
+
+			switch v.Kind() {
+			case reflect.Slice:
+				v.Set(reflect.Append(v, item))
+			case reflect.Array:
+				if i >= v.Len() {
+					return errors.New("xml: more than " + strconv.Itoa(v.Len()) + " items for " + v.Type().String())
+				}
+				v.Index(i).Set(item)
+			case reflect.Map:
+				key := reflect.New(v.Type().Key()).Elem()
+				for _, attr := range element.Attr {
+					if attr.Name.Local == "key" {
+						if err := setCell(key, attr.Value); err != nil {
+							return err
+						}
+					}
+				}
+				v.SetMapIndex(key, item)
+			}
+			i++
+		}
+	}
+}
+
+func decodeXMLItem(d *xml.Decoder, v reflect.Value, start xml.StartElement) error {
+	if isXMLCollection(v.Type()) {
+		return decodeXMLCollection(d, v)
+	}
+	return d.DecodeElement(v.Addr().Interface(), &start)
+}
+
+//Encodes v as an xml document, wrapping slices and maps in a root element
+func encodeXML(w io.Writer, v interface{}) error {
+	if v != nil && isXMLCollection(reflect.TypeOf(v)) {
+		v = newXMLCollection(v, reflect.TypeOf(v), "", "")
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+//Decodes an xml document into v, reading the items of a slice or map from the root element
+func decodeXML(r io.Reader, v interface{}) error {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = xmlCharsetReader
+	if isUTF8Reader(r) {
+		d.CharsetReader = utf8CharsetReader
+	}
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr && isXMLCollection(t.Elem()) {
+		return d.Decode(&xmlCollection{value: v})
+	}
+	return d.Decode(v)
+}
+
+//Request bodies transcoded to utf-8 from the charset of their Content-Type are read as they are, the
+//encoding their xml declaration still names is not applied again
+func utf8CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
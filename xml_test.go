@@ -0,0 +1,238 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type xmlBook struct {
+	XMLName xml.Name `xml:"book"`
+	Title   string   `xml:"title"`
+}
+
+func encodeXMLString(t *testing.T, v interface{}) string {
+	var buf bytes.Buffer
+	if err := NewXMLMarshaller().Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestXMLEncodeCollections(t *testing.T) {
+	users := []User{{Id: "1", FirstName: "David"}}
+	expected := `<Users><User><Id>1</Id><FirstName>David</FirstName><LastName></LastName><Age>0</Age><Weight>0</Weight></User></Users>`
+	if got := encodeXMLString(t, users); got != expected {
+		t.Error("Unexpected xml of a slice:", got)
+	}
+
+	books := map[string]xmlBook{"b": {Title: "Two"}, "a": {Title: "One"}}
+	expected = `<books><book key="a"><title>One</title></book><book key="b"><title>Two</title></book></books>`
+	if got := encodeXMLString(t, books); got != expected {
+		t.Error("Unexpected xml of a map:", got)
+	}
+
+	nested := [][]int{{1, 2}, {3}}
+	if got := encodeXMLString(t, nested); got != `<items><item><int>1</int><int>2</int></item><item><int>3</int></item></items>` {
+		t.Error("Unexpected xml of nested slices:", got)
+	}
+
+	named := newXMLCollection("hello", reflect.TypeOf(""), "greeting", "")
+	if got := encodeXMLString(t, named); got != `<greeting>hello</greeting>` {
+		t.Error("Unexpected xml of a primitive:", got)
+	}
+}
+
+func TestXMLPlural(t *testing.T) {
+	for name, plural := range map[string]string{"User": "Users", "item": "items", "Address": "Addresses", "box": "boxes",
+		"Match": "Matches", "Category": "Categories", "Key": "Keys", "y": "ys"} {
+		if got := xmlPlural(name); got != plural {
+			t.Error("Expecting", plural, "for", name, "got:", got)
+		}
+	}
+	if root, item := XMLCollectionNames("models.Category", "", ""); root != "Categories" || item != "Category" {
+		t.Error("Expecting the root to be derived from the item type, got:", root, item)
+	}
+}
+
+func TestXMLCharsetReader(t *testing.T) {
+	var item struct {
+		City string `xml:"city"`
+	}
+	declared := `<?xml version="1.0" encoding="ISO-8859-1"?><item><city>M` + "\xfc" + `nchen</city></item>`
+	if err := decodeXML(strings.NewReader(declared), &item); err != nil || item.City != "München" {
+		t.Error("Expecting the declared encoding to be applied to input that was not transcoded, got:", item.City, err)
+	}
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(declared))
+	req.Header.Set("Content-Type", Application_Xml)
+	body, err := openRequestBody(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.City = ""
+	if err := decodeXML(body, &item); err != nil || item.City != "München" {
+		t.Error("Expecting the declared encoding to be applied to bodies without a charset, got:", item.City, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(declared))
+	req.Header.Set("Content-Type", Application_Xml+"; charset=iso-8859-1")
+	if body, err = openRequestBody(req); err != nil {
+		t.Fatal(err)
+	}
+	item.City = ""
+	if err := decodeXML(body, &item); err != nil || item.City != "München" {
+		t.Error("Expecting a transcoded body to be decoded once, got:", item.City, err)
+	}
+}
+
+func TestXMLDecodeCollections(t *testing.T) {
+	var books map[string]xmlBook
+	data := encodeXMLString(t, map[string]xmlBook{"a": {Title: "One"}, "b": {Title: "Two"}})
+	if err := NewXMLMarshaller().Decode(strings.NewReader(data), &books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books["b"].Title != "Two" {
+		t.Error("Unexpected map:", books)
+	}
+
+	var counts map[int][]string
+	data = `<counts><item key="2"><string>a</string><string>b</string></item></counts>`
+	if err := NewXMLMarshaller().Decode(strings.NewReader(data), &counts); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts[2]) != 2 || counts[2][1] != "b" {
+		t.Error("Unexpected nested map:", counts)
+	}
+
+	var users []*User
+	data = `<Users><User><Id>1</Id></User><User><Id>2</Id></User></Users>`
+	if err := NewXMLMarshaller().Decode(strings.NewReader(data), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1].Id != "2" {
+		t.Error("Unexpected slice:", users)
+	}
+
+	var pair [2]User
+	data = `<items><User><Id>1</Id></User><User><Id>2</Id></User><User><Id>3</Id></User></items>`
+	if err := NewXMLMarshaller().Decode(strings.NewReader(data), &pair); err == nil {
+		t.Error("Expecting an error for more items than the array holds")
+	}
+}
+
+type XMLTestService struct {
+	RestService `root:"/xml-test/"`
+	listBooks   EndPoint `method:"GET" path:"/books" output:"[]xmlBook" produces:"application/xml" xmlroot:"library" xmlitem:"entry"`
+	addUsers    EndPoint `method:"POST" path:"/users" postdata:"[]User" output:"int" consumes:"application/xml" produces:"application/xml" xmlroot:"count"`
+}
+
+type XMLRootTestService struct {
+	RestService `root:"/xml-root-test/" xmlroot:"shelf"`
+	listBooks   EndPoint `method:"GET" path:"/books" output:"[]xmlBook" produces:"application/xml"`
+	listUsers   EndPoint `method:"GET" path:"/users" output:"[]User" produces:"application/xml" xmlroot:"people"`
+	getBook     EndPoint `method:"GET" path:"/book" output:"xmlBook" produces:"application/xml"`
+}
+
+var xmlTestRegister sync.Once
+
+func (serv XMLRootTestService) ListBooks() []xmlBook {
+	return []xmlBook{{Title: "One"}}
+}
+
+func (serv XMLRootTestService) ListUsers() []User {
+	return []User{{Id: "1"}}
+}
+
+func (serv XMLRootTestService) GetBook() xmlBook {
+	return xmlBook{Title: "One"}
+}
+
+func (serv XMLTestService) ListBooks() []xmlBook {
+	return []xmlBook{{Title: "One"}}
+}
+
+func (serv XMLTestService) AddUsers(users []User) int {
+	return len(users)
+}
+
+func TestXMLEndpoint(t *testing.T) {
+	xmlTestRegister.Do(func() {
+		RegisterService(new(XMLTestService))
+		RegisterService(new(XMLRootTestService))
+	})
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/xml-test/books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != `<library><entry><title>One</title></entry></library>` {
+		t.Error("Expecting the tags to name the elements, got:", string(data))
+	}
+
+	body := `<Users><User><Id>1</Id></User><User><Id>2</Id></User></Users>`
+	resp, err = http.Post(server.URL+"/xml-test/users", Application_Xml, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || string(data) != `<count>2</count>` {
+		t.Error("Expecting the xml postdata to be decoded, got:", resp.StatusCode, string(data))
+	}
+
+	get := func(url string) string {
+		resp, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(data)
+	}
+	if got := get("/xml-root-test/books"); got != `<shelf><book><title>One</title></book></shelf>` {
+		t.Error("Expecting the xml root of the service, got:", got)
+	}
+	if got := get("/xml-root-test/users"); !strings.HasPrefix(got, `<people><User>`) {
+		t.Error("Expecting the xml root of the endpoint to win, got:", got)
+	}
+	if got := get("/xml-root-test/book"); got != `<book><title>One</title></book>` {
+		t.Error("Expecting the xml root of the service to leave single entities alone, got:", got)
+	}
+}
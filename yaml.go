@@ -0,0 +1,154 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+)
+
+//YAML: This makes the application/yaml Marshaller. Values go through their json form, so fields are
+//named by their json tags and one struct serves both formats; the keys of a struct keep their order.
+func NewYAMLMarshaller() *Marshaller {
+	return yamlBuffered
+}
+
+//The YAML StreamMarshaller, encoding straight to the writer
+func NewYAMLStreamMarshaller() StreamMarshaller {
+	return yamlMarshaller{}
+}
+
+type yamlMarshaller struct{}
+
+func (yamlMarshaller) Encode(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	doc, err := jsonToYAML(dec)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+//Decode returns io.EOF for an empty document
+func (yamlMarshaller) Decode(r io.Reader, v interface{}) error {
+	var doc interface{}
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	data, err := json.Marshal(yamlToJSON(doc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Reads the next json value as the YAML encoder's types, objects becoming a MapSlice to keep their order
+func jsonToYAML(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '{' {
+			object := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				item, err := jsonToYAML(dec)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, yaml.MapItem{Key: key, Value: item})
+			}
+			_, err = dec.Token()
+			return object, err
+		}
+
+		array := make([]interface{}, 0)
+		for dec.More() {
+			item, err := jsonToYAML(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		_, err = dec.Token()
+		return array, err
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n, nil
+		}
+		return value.Float64()
+	}
+	return token, nil
+}
+
+//Makes a decoded YAML document marshallable as json, whose objects only have string keys
+func yamlToJSON(doc interface{}) interface{} {
+	switch value := doc.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			object[fmt.Sprint(k)] = yamlToJSON(v)
+		}
+		return object
+	case []interface{}:
+		for i := range value {
+			value[i] = yamlToJSON(value[i])
+		}
+	}
+	return doc
+}
+
+//The swagger document is offered as json first, then as yaml under any of its names
+var swaggerMimes = []string{Application_Json, Application_Yaml, "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+//The mime type to serve the swagger document as: application/yaml when the Accept header weighs a
+//yaml type above json, otherwise application/json
+func swaggerMime(accept string) string {
+	if mime, found := negotiateMime(accept, swaggerMimes); found && mime != Application_Json {
+		return Application_Yaml
+	}
+	return Application_Json
+}
@@ -0,0 +1,185 @@
+//Copyright 2014  (rmullinnix@yahoo.com). All rights reserved.
+//
+//Redistribution and use in source and binary forms, with or without
+//modification, are permitted provided that the following conditions
+//are met:
+//
+//  1. Redistributions of source code must retain the above copyright
+//     notice, this list of conditions and the following disclaimer.
+//
+//  2. Redistributions in binary form must reproduce the above copyright
+//     notice, this list of conditions and the following disclaimer
+//     in the documentation and/or other materials provided with the
+//     distribution.
+//
+//THIS SOFTWARE IS PROVIDED BY THE AUTHOR ``AS IS'' AND ANY EXPRESS OR
+//IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES
+//OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+//IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+//SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+//PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS;
+//OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+//WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR
+//OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF
+//ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package gorest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type yamlServer struct {
+	Name    string            `json:"name"`
+	Port    int               `json:"port"`
+	Weight  float64           `json:"weight,omitempty"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	Backend *yamlServer       `json:"backend,omitempty"`
+}
+
+const yamlServerDoc = `name: web
+port: 8080
+weight: 0.5
+tags:
+- a
+- b
+labels:
+  env: prod
+backend:
+  name: db
+  port: 5432
+  tags: []
+  labels: {}
+`
+
+func TestYAMLMarshaller(t *testing.T) {
+	server := yamlServer{"web", 8080, 0.5, []string{"a", "b"}, map[string]string{"env": "prod"}, &yamlServer{Name: "db", Port: 5432, Tags: []string{}, Labels: map[string]string{}}}
+
+	var buf bytes.Buffer
+	if err := NewYAMLMarshaller().Encode(&buf, server); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != yamlServerDoc {
+		t.Error("Unexpected yaml, fields should be named by json tags in order:\n" + buf.String())
+	}
+
+	var decoded yamlServer
+	if err := NewYAMLMarshaller().Decode(strings.NewReader(yamlServerDoc), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "web" || decoded.Port != 8080 || decoded.Labels["env"] != "prod" || decoded.Backend.Port != 5432 || len(decoded.Tags) != 2 {
+		t.Error("Unexpected value:", decoded)
+	}
+
+	var generic map[string]interface{}
+	if err := NewYAMLMarshaller().Decode(strings.NewReader("1: one\nnested: {2: two}\n"), &generic); err != nil {
+		t.Fatal(err)
+	}
+	if generic["1"] != "one" || generic["nested"].(map[string]interface{})["2"] != "two" {
+		t.Error("Expecting keys to be made strings, got:", generic)
+	}
+
+	if err := NewYAMLMarshaller().Decode(strings.NewReader(""), &decoded); err != io.EOF {
+		t.Error("Expecting io.EOF for an empty document, got:", err)
+	}
+	if err := NewYAMLMarshaller().Decode(strings.NewReader("port: [unclosed"), &decoded); err == nil {
+		t.Error("Expecting an error for malformed yaml")
+	}
+}
+
+func TestYAMLMimeTypes(t *testing.T) {
+	defer withMarshallers(t)()
+
+	for _, mime := range []string{Application_Yaml, "application/x-yaml", "text/yaml", "application/vnd.config+yaml"} {
+		if !addMimeType(mime) || marshallerFor(mime) == nil {
+			t.Error("Expecting a yaml marshaller for " + mime)
+		}
+	}
+}
+
+type YAMLTestService struct {
+	RestService `root:"/yaml-test/"`
+	putServer   EndPoint `method:"PUT" path:"/servers" postdata:"yamlServer" output:"yamlServer" consumes:"application/yaml,application/x-yaml" produces:"application/yaml,application/json"`
+}
+
+var yamlTestRegister sync.Once
+
+func (serv YAMLTestService) PutServer(server yamlServer) yamlServer {
+	server.Port++
+	return server
+}
+
+func TestYAMLEndpoint(t *testing.T) {
+	yamlTestRegister.Do(func() { RegisterService(new(YAMLTestService)) })
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL+"/yaml-test/servers", strings.NewReader(yamlServerDoc))
+	req.Header.Set("Content-Type", "application/x-yaml")
+	req.Header.Set("Accept", Application_Yaml)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != Application_Yaml || !strings.HasPrefix(string(data), "name: web\nport: 8081\n") {
+		t.Error("Expecting the server back as yaml, got:", resp.StatusCode, resp.Header.Get("Content-Type"), string(data))
+	}
+}
+
+type yamlSpec struct {
+	Swagger string `json:"swagger"`
+	Title   string `json:"title"`
+}
+
+func TestYAMLSwagger(t *testing.T) {
+	RegisterDocumentor("swagger", &Documentor{func(string, map[string]ServiceMetaData, map[string]EndPointStruct, map[string]SecurityStruct) interface{} {
+		return yamlSpec{"2.0", "test"}
+	}})
+	defer func(ep string) { _manager().swaggerEP = ep }(_manager().swaggerEP)
+	_manager().swaggerEP = "/yaml-test/swagger.json"
+
+	server := httptest.NewServer(Handle())
+	defer server.Close()
+
+	get := func(accept string) (string, string) {
+		req, _ := http.NewRequest("GET", server.URL+"/yaml-test/swagger.json", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.Header.Get("Content-Type"), string(data)
+	}
+
+	if mime, body := get("application/yaml, application/json;q=0.5"); mime != Application_Yaml || body != "swagger: \"2.0\"\ntitle: test\n" {
+		t.Error("Expecting the spec as yaml, got:", mime, body)
+	}
+	if mime, body := get(""); mime != Application_Json || body != `{"swagger":"2.0","title":"test"}` {
+		t.Error("Expecting the spec as json, got:", mime, body)
+	}
+	if mime, _ := get("application/json, text/yaml;q=0.9"); mime != Application_Json {
+		t.Error("Expecting json to be preferred, got:", mime)
+	}
+	if mime, _ := get("application/*, application/json;q=0"); mime != Application_Yaml {
+		t.Error("Expecting yaml when json is refused, got:", mime)
+	}
+	if mime, _ := get("text/x-yaml"); mime != Application_Yaml {
+		t.Error("Expecting yaml for text/x-yaml, got:", mime)
+	}
+}